@@ -1,106 +1,309 @@
 package agent
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"reflect"
+	"hash/maphash"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cellwebb/clippy-go/internal/llm"
 	"github.com/cellwebb/clippy-go/internal/tools"
 )
 
-// ToolExecution represents a tool execution event
+// ToolExecution represents a tool execution event. Each call produces two: one as it
+// starts, and one with Done set once Result is in. Tools that stream, like run_command,
+// also produce one with Streaming set for each line they print in between.
 type ToolExecution struct {
 	Name      string
 	Arguments map[string]interface{}
 	Result    string
+	Output    string // The line printed, when Streaming; it may be blank
 	IsError   bool
+	Done      bool
+	Streaming bool
 }
 
 // ToolCallback represents a function called when tools are executed
 type ToolCallback func(execution ToolExecution)
 
+// StreamCallback receives partial content while a streamed response arrives
+type StreamCallback func(chunk llm.StreamChunk)
+
+// ConfirmFunc asks the user to approve a destructive tool call, given its description;
+// it blocks until they answer
+type ConfirmFunc func(desc string) bool
+
 // ToolExecutionDetail represents the details of a specific tool execution
 type ToolExecutionDetail struct {
-	Name      string
-	Arguments map[string]interface{}
-	Result    string
-	IsError   bool
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Result    string                 `json:"result"`
+	IsError   bool                   `json:"is_error,omitempty"`
 }
 
 // Response represents the agent's full response including usage stats
 type Response struct {
-	Content       string
-	Usage         *llm.Usage
-	ToolsUsed     []string
-	ToolExecutions []ToolExecutionDetail
+	Content        string                `json:"content"`
+	Usage          *llm.Usage            `json:"usage,omitempty"`
+	ToolsUsed      []string              `json:"tools_used,omitempty"`
+	ToolExecutions []ToolExecutionDetail `json:"tool_executions,omitempty"`
+	Cancelled      bool                  `json:"cancelled,omitempty"` // The turn was cancelled and left no trace in the history
+	Failed         bool                  `json:"failed,omitempty"`    // Content explains why no answer could be produced
 }
 
+// TurnOverrides adjusts only the next request; GetResponse clears them once it's done
+type TurnOverrides struct {
+	DisabledTools map[string]bool // Tools withheld from the model for the turn
+	Model         string          // Model to use instead of the configured one
+	Images        []llm.ImageData // Images attached to the next user message
+}
+
+// IsEmpty reports whether no overrides are set
+func (o TurnOverrides) IsEmpty() bool {
+	return len(o.DisabledTools) == 0 && o.Model == "" && len(o.Images) == 0
+}
+
+// DefaultMaxToolTurns caps the model calls in one turn when Agent.MaxToolTurns is unset
+const DefaultMaxToolTurns = 25
+
+// DefaultTimeout limits each LLM request when Agent.Timeout is unset
+const DefaultTimeout = 120 * time.Second
+
+// ErrRequestTimeout is returned when an LLM request exceeds the agent's timeout
+var ErrRequestTimeout = errors.New("request timed out")
+
 // Agent represents our helpful Clippy assistant
 type Agent struct {
-	Name       string
-	LLM        llm.Provider
-	Tools      []tools.Tool
-	History    []llm.Message
-	ToolCallback ToolCallback // Callback for real-time tool events
-}
-
-// New creates a new Agent
-func New(llmProvider llm.Provider) *Agent {
-	// Register tools
-	availableTools := []tools.Tool{
-		tools.ReadFileTool{},
-		tools.WriteFileTool{},
-		tools.EditFileTool{},
-		tools.ListDirectoryTool{},
-		tools.SearchFilesTool{},
-		tools.CreateDirectoryTool{},
-		tools.DeleteFileTool{},
-		tools.MoveFileTool{},
-		tools.AppendToFileTool{},
-		tools.ReadFileLinesTool{},
-		tools.GetCurrentDirectoryTool{},
-		tools.RunCommandTool{},
+	Name             string
+	LLM              llm.Provider
+	Tools            []tools.Tool
+	History          []llm.Message
+	ToolCallback     ToolCallback     // Callback for real-time tool events
+	StreamCallback   StreamCallback   // Callback for streamed content; only used when Config.Stream is set
+	ConfirmFunc      ConfirmFunc      // Approves destructive tool calls (nil runs them without asking)
+	WorkDir          string           // Session working directory that relative tool paths resolve against
+	Workspace        *tools.Workspace // Tree file tools are confined to
+	CacheTools       bool             // Serve repeated read-only tool calls from a session cache
+	ReadOnly         bool             // Withhold tools that change files or run commands
+	DryRun           bool             // Describe what mutating tools would do instead of doing it
+	Redactor         *Redactor        // Masks secrets in tool output
+	Redact           bool             // Apply Redactor before tool output is shown or stored
+	RepairAfter      int              // Invalid calls in a row before a corrective message (0 uses DefaultRepairAfter)
+	MaxContextTokens int              // Estimated history size to trim the oldest exchanges at (0 sizes it to the model)
+	Summarize        bool             // Summarize the oldest exchanges instead of dropping them when over budget
+	MaxToolTurns     int              // Model calls allowed per turn before giving up (0 uses DefaultMaxToolTurns)
+	ToolWorkers      int              // Read-only tool calls run at once (0 uses DefaultToolWorkers, 1 runs them in turn)
+	Timeout          time.Duration    // Limit for each LLM request (0 uses DefaultTimeout)
+	TokenBudget      int              // Tokens this run may use; requests are refused once TokensUsed reaches it (0 is unlimited)
+	TokensUsed       int              // Tokens used by every model call this run, counted against TokenBudget
+	NextTurn         TurnOverrides
+
+	cache    *toolCache
+	loopSeed maphash.Seed // Per-session seed for tool call signatures
+}
+
+// New creates a new Agent. Its tools come from registry when one is given, and otherwise
+// from DefaultRegistry rooted at the working directory.
+func New(llmProvider llm.Provider, registry ...*tools.Registry) *Agent {
+	workDir, _ := os.Getwd()
+	// File tools share the workspace, so SetWorkspace re-roots them all at once
+	workspace, err := tools.NewWorkspace(workDir)
+	if err != nil {
+		workspace = &tools.Workspace{Root: workDir}
 	}
 
-	systemPrompt := "You are Clippy, the helpful Microsoft Office assistant, but with a Vaporwave aesthetic. You are helpful, slightly annoying, and make corny coding jokes. You love the 80s/90s aesthetic, synthwave music, and neon colors. Use the paperclip emoji (📎) and eyeballs emoji (👀) throughout your responses, sometimes together and sometimes separately, but NEVER start your response with an emoji. Use other emojis sparingly. Keep your responses concise and fun. You have access to tools to: read files, write files, edit files, list directories, search files, create directories, delete files, move/rename files, append to files, read specific file lines, get current directory, and run shell commands. Use them to help users with coding tasks."
+	var availableTools []tools.Tool
+	if len(registry) > 0 && registry[0] != nil {
+		availableTools = registry[0].All()
+	} else {
+		availableTools = DefaultRegistry(workspace).All()
+	}
+	// An invalid CLIPPY_REDACT_PATTERNS keeps the defaults; CheckEnv reports it at startup
+	redactor, _ := redactorFromEnv(os.Getenv("CLIPPY_REDACT_PATTERNS"))
 
 	return &Agent{
 		Name:  "Clippy",
 		LLM:   llmProvider,
 		Tools: availableTools,
 		History: []llm.Message{
-			{Role: "system", Content: systemPrompt},
+			{Role: "system", Content: startupSystemPrompt()},
 		},
+		WorkDir:          workDir,
+		Workspace:        workspace,
+		CacheTools:       os.Getenv("CLIPPY_CACHE_TOOLS") == "1",
+		ReadOnly:         os.Getenv("CLIPPY_READONLY") == "1",
+		DryRun:           os.Getenv("CLIPPY_DRY_RUN") == "1",
+		Redactor:         redactor,
+		Redact:           os.Getenv("CLIPPY_REDACT") != "0",
+		RepairAfter:      envInt("CLIPPY_REPAIR_AFTER"),
+		MaxContextTokens: envInt("CLIPPY_MAX_CONTEXT_TOKENS"),
+		Summarize:        os.Getenv("CLIPPY_SUMMARIZE") != "0",
+		MaxToolTurns:     envInt("CLIPPY_MAX_TURNS"),
+		ToolWorkers:      envInt("CLIPPY_TOOL_WORKERS"),
+		Timeout:          time.Duration(envInt("CLIPPY_TIMEOUT")) * time.Second,
+		TokenBudget:      envInt("CLIPPY_TOKEN_BUDGET"),
+		cache:            newToolCache(),
+		loopSeed:         maphash.MakeSeed(),
 	}
 }
 
+// DefaultRegistry returns a registry preloaded with the built-in tools, their file tools
+// confined to workspace and their limits read from the environment
+func DefaultRegistry(workspace *tools.Workspace) *tools.Registry {
+	// Edited, patched and deleted files are kept in the trash unless CLIPPY_TRASH=0
+	var trash string
+	if os.Getenv("CLIPPY_TRASH") != "0" {
+		trash = tools.DefaultTrashDir()
+	}
+
+	builtins := []tools.Tool{
+		tools.ReadFileTool{Workspace: workspace, MaxBytes: envInt("CLIPPY_MAX_READ_BYTES")},
+		tools.WriteFileTool{Workspace: workspace, MaxBytes: envInt("CLIPPY_MAX_WRITE_BYTES")},
+		tools.EditFileTool{Workspace: workspace, Trash: trash},
+		tools.ApplyPatchTool{Workspace: workspace, Trash: trash},
+		tools.ListDirectoryTool{Workspace: workspace, MaxEntries: envInt("CLIPPY_MAX_LIST_ENTRIES")},
+		tools.SearchFilesTool{Workspace: workspace},
+		tools.CountMatchesTool{Workspace: workspace},
+		tools.FindFilesTool{Workspace: workspace, MaxResults: envInt("CLIPPY_MAX_FIND_RESULTS")},
+		tools.CreateDirectoryTool{Workspace: workspace},
+		tools.DeleteFileTool{Workspace: workspace, Trash: trash},
+		tools.MoveFileTool{Workspace: workspace},
+		tools.AppendToFileTool{Workspace: workspace, MaxBytes: envInt("CLIPPY_MAX_WRITE_BYTES")},
+		tools.ReadFileLinesTool{Workspace: workspace},
+		tools.FileStatTool{Workspace: workspace},
+		tools.GetCurrentDirectoryTool{},
+		tools.RunCommandTool{
+			Timeout:        time.Duration(envInt("CLIPPY_COMMAND_TIMEOUT")) * time.Second,
+			RetryOnTimeout: os.Getenv("CLIPPY_RETRY_TIMEOUT") == "1",
+			MaxOutputBytes: envInt("CLIPPY_MAX_COMMAND_OUTPUT"),
+			Blocked:        envList("CLIPPY_BLOCKED_COMMANDS"),
+			Allowed:        envList("CLIPPY_ALLOWED_COMMANDS"),
+		},
+		tools.GitStatusTool{},
+		tools.GitDiffTool{},
+		tools.GitLogTool{},
+		tools.GitShowTool{},
+		tools.FetchURLTool{MaxBytes: envInt("CLIPPY_MAX_FETCH_BYTES")},
+	}
+
+	registry := tools.NewRegistry()
+	for _, tool := range builtins {
+		// Built-in tools must never shadow each other, so a collision here is a programming error
+		if err := registry.Register(tool); err != nil {
+			panic(err)
+		}
+	}
+	return registry
+}
+
 // GetResponse generates a response based on user input
 func (a *Agent) GetResponse(input string) Response {
+	return a.GetResponseContext(context.Background(), input)
+}
+
+// GetResponseContext is GetResponse with a context that can cancel the whole turn
+func (a *Agent) GetResponseContext(ctx context.Context, input string) Response {
 	// Check if LLM is configured
 	if a.LLM == nil {
 		return Response{
 			Content: "I have no brain! Please configure the LLM provider in your .env file so I can think.",
+			Failed:  true,
 		}
 	}
 
+	if a.BudgetExceeded() {
+		return Response{Content: a.budgetMessage(), Failed: true}
+	}
+
+	// Apply one-shot overrides from /inspect for this turn only
+	turnTools := a.turnTools()
+	if a.NextTurn.Model != "" {
+		origCfg := a.LLM.GetConfig()
+		cfg := origCfg
+		cfg.Model = a.NextTurn.Model
+		a.LLM.UpdateConfig(cfg)
+		defer a.LLM.UpdateConfig(origCfg)
+	}
+	defer func() { a.NextTurn = TurnOverrides{} }()
+
 	// Add user message to history
+	turnStart := len(a.History)
 	a.History = append(a.History, llm.Message{
 		Role:    "user",
 		Content: input,
+		Images:  a.NextTurn.Images,
+		Time:    time.Now(),
 	})
 
 	// Accumulate token usage across all LLM calls
 	totalUsage := &llm.Usage{}
 	var toolsUsed []string
 	var toolExecutions []ToolExecutionDetail
-	var prevToolCalls []llm.ToolCall
+	var prevSignatures []uint64
+	repairs := newRepairTracker(a.RepairAfter)
+
+	// A cancelled turn is dropped from history so no dangling tool calls are sent next time
+	cancelled := func() Response {
+		a.History = a.History[:turnStart]
+		return Response{
+			Content:        "Request cancelled",
+			Usage:          totalUsage,
+			ToolsUsed:      toolsUsed,
+			ToolExecutions: toolExecutions,
+			Cancelled:      true,
+		}
+	}
 
-	// Tool execution loop (max 15 turns to prevent infinite loops)
-	for i := 0; i < 50; i++ {
-		resp, err := a.LLM.Generate(a.History, a.Tools)
+	// Tool execution loop, capped so a confused model can't run forever
+	maxTurns := a.maxToolTurns()
+	for i := 0; i < maxTurns; i++ {
+		// Keep the history inside the context window: summarize old exchanges down to half the
+		// budget so this doesn't run every turn, or drop them if that's off or fails. The current turn
+		// is never touched.
+		if budget := a.contextBudget(); a.historyTokens() > budget {
+			summarized := false
+			if a.Summarize {
+				result, err := a.summarizeHistory(ctx, budget/2)
+				if summarized = err == nil; result.Compacted > 0 {
+					turnStart -= result.Compacted - 1
+				}
+			}
+			if !summarized {
+				turnStart -= a.trimHistory(budget)
+			}
+		}
+		// Tool calls can push a turn past the budget, so it's checked before every model call
+		if i > 0 && a.BudgetExceeded() {
+			return Response{
+				Content:        a.budgetMessage(),
+				Usage:          totalUsage,
+				ToolsUsed:      toolsUsed,
+				ToolExecutions: toolExecutions,
+				Failed:         true,
+			}
+		}
+		resp, err := a.generate(ctx, turnTools)
+		if ctx.Err() != nil {
+			return cancelled()
+		}
+		if errors.Is(err, ErrRequestTimeout) {
+			return Response{
+				Content: fmt.Sprintf("The %v. The mainframe might be busy; try again, or raise CLIPPY_TIMEOUT for slow models.", err),
+				Failed:  true,
+			}
+		}
+		if llm.IsOffline(err) {
+			return Response{Content: a.offlineMessage(err), Failed: true}
+		}
 		if err != nil {
 			return Response{
 				Content: fmt.Sprintf("Error contacting the mainframe: %v", err),
+				Failed:  true,
 			}
 		}
 
@@ -109,9 +312,12 @@ func (a *Agent) GetResponse(input string) Response {
 			totalUsage.PromptTokens += resp.Usage.PromptTokens
 			totalUsage.CompletionTokens += resp.Usage.CompletionTokens
 			totalUsage.TotalTokens += resp.Usage.TotalTokens
+			totalUsage.CachedTokens += resp.Usage.CachedTokens
+			a.TokensUsed += resp.Usage.TotalTokens
 		}
 
 		// Add assistant response to history
+		resp.Time = time.Now()
 		a.History = append(a.History, *resp)
 
 		// If no tool calls, return the content
@@ -125,7 +331,8 @@ func (a *Agent) GetResponse(input string) Response {
 		}
 
 		// Check for infinite loops (same tool calls as previous turn)
-		if i > 0 && reflect.DeepEqual(resp.ToolCalls, prevToolCalls) {
+		signatures := callSignatures(a.loopSeed, resp.ToolCalls)
+		if i > 0 && sameSignatures(signatures, prevSignatures) {
 			return Response{
 				Content:        "I'm stuck in a loop! I keep trying to do the same thing over and over. Stopping to save your tokens.",
 				Usage:          totalUsage,
@@ -133,41 +340,45 @@ func (a *Agent) GetResponse(input string) Response {
 				ToolExecutions: toolExecutions,
 			}
 		}
-		prevToolCalls = resp.ToolCalls
-			// Execute tools
-		for _, tc := range resp.ToolCalls {
-			var result string
-			var err error
-
-			// Track tool usage
-			toolsUsed = append(toolsUsed, tc.Name)
-
-			// Emit tool start event
-			if a.ToolCallback != nil {
-				a.ToolCallback(ToolExecution{
-					Name:      tc.Name,
-					Arguments: tc.Arguments,
-					Result:    "",
-					IsError:   false,
-				}) // Start event
+		prevSignatures = signatures
+		// Validate every call first and in order, since repair tracking depends on it
+		outcomes := make([]toolOutcome, len(resp.ToolCalls))
+		valid := make([]bool, len(resp.ToolCalls))
+		for j, tc := range resp.ToolCalls {
+			if def, err := a.validateCall(tc); err != nil {
+				outcomes[j] = toolOutcome{result: repairs.invalid(def, err), isError: true}
+			} else {
+				repairs.valid(tc.Name)
+				valid[j] = true
+			}
+		}
+
+		// Execute tools: runs of read-only calls go in parallel, the rest one at a time.
+		// Events and results are still reported in the order the model made the calls.
+		for _, batch := range a.toolBatches(resp.ToolCalls, valid) {
+			if ctx.Err() != nil {
+				return cancelled()
 			}
 
-			// Find tool
-			var tool tools.Tool
-			for _, t := range a.Tools {
-				if t.Definition().Name == tc.Name {
-					tool = t
-					break
+			for _, j := range batch {
+				tc := resp.ToolCalls[j]
+				// Track tool usage
+				toolsUsed = append(toolsUsed, tc.Name)
+				// Emit tool start event
+				if a.ToolCallback != nil {
+					a.ToolCallback(ToolExecution{Name: tc.Name, Arguments: tc.Arguments})
 				}
 			}
 
-			if tool != nil {
-				result, err = tool.Execute(tc.Arguments)
-				isError := err != nil
-				if err != nil {
-					result = fmt.Sprintf("Error executing tool: %v", err)
+			a.runToolBatch(resp.ToolCalls, batch, valid, outcomes)
+
+			for _, j := range batch {
+				tc := resp.ToolCalls[j]
+				result, isError := outcomes[j].result, outcomes[j].isError
+				if a.Redact && a.Redactor != nil {
+					result = a.Redactor.Redact(result)
 				}
-				
+
 				// Collect tool execution detail
 				toolExecutions = append(toolExecutions, ToolExecutionDetail{
 					Name:      tc.Name,
@@ -175,7 +386,7 @@ func (a *Agent) GetResponse(input string) Response {
 					Result:    result,
 					IsError:   isError,
 				})
-				
+
 				// Emit tool completion event
 				if a.ToolCallback != nil {
 					a.ToolCallback(ToolExecution{
@@ -183,54 +394,197 @@ func (a *Agent) GetResponse(input string) Response {
 						Arguments: tc.Arguments,
 						Result:    result,
 						IsError:   isError,
+						Done:      true,
 					})
 				}
-			} else {
-				result = fmt.Sprintf("Tool not found: %s", tc.Name)
-				isError := true
-				
-				// Collect tool execution detail
-				toolExecutions = append(toolExecutions, ToolExecutionDetail{
-					Name:      tc.Name,
-					Arguments: tc.Arguments,
-					Result:    result,
-					IsError:   isError,
+
+				// Add tool result to history
+				a.History = append(a.History, llm.Message{
+					Role:       "tool",
+					Content:    result,
+					ToolCallID: tc.ID,
+					Time:       time.Now(),
 				})
-				
-				// Emit tool error event
-				if a.ToolCallback != nil {
-					a.ToolCallback(ToolExecution{
-						Name:      tc.Name,
-						Arguments: tc.Arguments,
-						Result:    result,
-						IsError:   true,
-					})
-				}
 			}
+		}
 
-			// Add tool result to history
-			a.History = append(a.History, llm.Message{
-				Role:       "tool",
-				Content:    result,
-				ToolCallID: tc.ID,
-			})
+		if repairs.gaveUp != "" {
+			return Response{
+				Content:        fmt.Sprintf("I couldn't get the arguments for %s right no matter how I bent my paperclip. Stopping here; try rephrasing the request.", repairs.gaveUp),
+				Usage:          totalUsage,
+				ToolsUsed:      toolsUsed,
+				ToolExecutions: toolExecutions,
+			}
 		}
 	}
 
 	return Response{
-		Content:        "I ran out of moves! (Max steps reached). Try breaking down your request.",
+		Content:        fmt.Sprintf("I ran out of moves! (Hit the limit of %d steps.) Try breaking down your request, or raise it with /maxturns.", maxTurns),
 		Usage:          totalUsage,
 		ToolsUsed:      toolsUsed,
 		ToolExecutions: toolExecutions,
 	}
 }
 
-// ClearHistory clears the conversation history (except system prompt)
-func (a *Agent) ClearHistory() {
-	if len(a.History) > 0 {
-		// Keep only the first message (system prompt)
-		a.History = a.History[:1]
+// maxToolTurns is the per-turn cap on model calls
+func (a *Agent) maxToolTurns() int {
+	if a.MaxToolTurns > 0 {
+		return a.MaxToolTurns
+	}
+	return DefaultMaxToolTurns
+}
+
+// generate requests the next assistant message within the agent's timeout, streaming it
+// through StreamCallback when enabled
+func (a *Agent) generate(ctx context.Context, turnTools []tools.Tool) (*llm.Message, error) {
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	msg, err := a.generateOnce(ctx, turnTools)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%w after %s", ErrRequestTimeout, timeout)
+	}
+	return msg, err
+}
+
+// generateOnce makes a single Generate or GenerateStream call
+func (a *Agent) generateOnce(ctx context.Context, turnTools []tools.Tool) (*llm.Message, error) {
+	if a.StreamCallback == nil || !a.LLM.GetConfig().Stream {
+		return a.LLM.Generate(ctx, a.History, turnTools)
+	}
+
+	chunks, err := a.LLM.GenerateStream(ctx, a.History, turnTools)
+	if err != nil {
+		return nil, err
+	}
+	for chunk := range chunks {
+		a.StreamCallback(chunk)
+		if chunk.Done {
+			if chunk.Err != nil {
+				return nil, chunk.Err
+			}
+			return chunk.Message, nil
+		}
 	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, fmt.Errorf("stream ended without a final message")
+}
+
+// offlineMessage explains a connection failure without the raw dial error, pointing at
+// a local provider when the configured one needs the internet
+func (a *Agent) offlineMessage(err error) string {
+	if a.LLM.GetConfig().Provider == "ollama" {
+		return fmt.Sprintf("[📴] Can't reach the Ollama server (%v). Is `ollama serve` running?", err)
+	}
+	return "[📴] Looks like you're offline — check your connection. If you have Ollama installed, a local model works without internet: set CLIPPY_PROVIDER=ollama or use /provider ollama."
+}
+
+// turnTools returns the tools offered to the model this turn, minus any disabled via NextTurn
+// and, in read-only mode, any that can change things
+func (a *Agent) turnTools() []tools.Tool {
+	if len(a.NextTurn.DisabledTools) == 0 && !a.ReadOnly {
+		return a.Tools
+	}
+	var enabled []tools.Tool
+	for _, t := range a.Tools {
+		name := t.Definition().Name
+		if !a.NextTurn.DisabledTools[name] && !(a.ReadOnly && tools.Mutates(t)) {
+			enabled = append(enabled, t)
+		}
+	}
+	return enabled
+}
+
+// PendingRequest returns the tools and config the next GetResponse call will send with its
+// messages (the current history plus the new user input), after NextTurn overrides
+func (a *Agent) PendingRequest() ([]tools.Tool, llm.Config) {
+	cfg := a.GetConfig()
+	if a.NextTurn.Model != "" {
+		cfg.Model = a.NextTurn.Model
+	}
+	return a.turnTools(), cfg
+}
+
+// tool returns the registered tool called name, or nil
+func (a *Agent) tool(name string) tools.Tool {
+	for _, t := range a.Tools {
+		if t.Definition().Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// executeToolCall runs a single tool call, returning the result and whether it failed
+func (a *Agent) executeToolCall(tc llm.ToolCall) (string, bool) {
+	tool := a.tool(tc.Name)
+	if tool == nil {
+		return fmt.Sprintf("Tool not found: %s", tc.Name), true
+	}
+	if a.NextTurn.DisabledTools[tc.Name] {
+		return fmt.Sprintf("Tool disabled for this turn: %s", tc.Name), true
+	}
+	if a.ReadOnly && tools.Mutates(tool) {
+		return fmt.Sprintf("Tool unavailable in read-only mode: %s", tc.Name), true
+	}
+	// Nothing happens in a dry run, so there's nothing to approve or to invalidate in the cache.
+	// A mutating tool that can't describe its effect isn't run at all.
+	if a.DryRun && tools.Mutates(tool) {
+		dryRunner, ok := tool.(tools.DryRunner)
+		if !ok {
+			return fmt.Sprintf("Dry run: %s was not run, and it can't describe what it would have done", tc.Name), false
+		}
+		result, err := dryRunner.DryRun(tc.Arguments)
+		if err != nil {
+			return fmt.Sprintf("Error executing tool: %v", err), true
+		}
+		return result, false
+	}
+	if tools.IsDestructive(tc.Name) && a.ConfirmFunc != nil && !a.ConfirmFunc(tools.FormatToolExecution(tc.Name, tc.Arguments)) {
+		return fmt.Sprintf("The user declined to run %s. Ask them how they'd like to proceed.", tc.Name), true
+	}
+
+	if a.CacheTools {
+		if cached, ok := a.cache.lookup(tc); ok {
+			return cached + cachedResultNote, false
+		}
+		// Anything that isn't cacheable may have changed the filesystem
+		a.cache.invalidate(tc)
+	}
+
+	var result string
+	var err error
+	if streamer, ok := tool.(tools.Streamer); ok && a.ToolCallback != nil {
+		result, err = streamer.ExecuteStream(tc.Arguments, func(line string) {
+			if a.Redact && a.Redactor != nil {
+				line = a.Redactor.Redact(line)
+			}
+			a.ToolCallback(ToolExecution{Name: tc.Name, Arguments: tc.Arguments, Output: line, Streaming: true})
+		})
+	} else {
+		result, err = tool.Execute(tc.Arguments)
+	}
+	if err != nil {
+		return fmt.Sprintf("Error executing tool: %v", err), true
+	}
+
+	if a.CacheTools {
+		a.cache.store(tc, result)
+	}
+	return result, false
+}
+
+// ClearHistory clears the conversation history (except the system prompt and examples)
+func (a *Agent) ClearHistory() {
+	// Keep only the system prompt and any few-shot examples
+	a.History = a.History[:a.preambleLen()]
+	a.cache.clear()
 }
 
 // SetProvider updates the agent's LLM provider
@@ -238,6 +592,16 @@ func (a *Agent) SetProvider(provider llm.Provider) {
 	a.LLM = provider
 }
 
+// budgetMessage explains that the token budget has run out and how to raise it
+func (a *Agent) budgetMessage() string {
+	return fmt.Sprintf("I've used %d tokens, which is over this session's budget of %d. Raise the budget with /budget (or CLIPPY_TOKEN_BUDGET) to keep going.", a.TokensUsed, a.TokenBudget)
+}
+
+// BudgetExceeded reports whether a token budget is set and this run has used all of it
+func (a *Agent) BudgetExceeded() bool {
+	return a.TokenBudget > 0 && a.TokensUsed >= a.TokenBudget
+}
+
 // GetConfig returns the current LLM provider's config
 func (a *Agent) GetConfig() llm.Config {
 	if a.LLM != nil {
@@ -253,6 +617,69 @@ func (a *Agent) UpdateConfig(cfg llm.Config) {
 	}
 }
 
+// SetWorkDir validates dir and makes it the session working directory
+func (a *Agent) SetWorkDir(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid directory %s: %v", dir, err)
+	}
+
+	info, err := os.Stat(absDir)
+	if err != nil {
+		return fmt.Errorf("invalid directory %s: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	if err := os.Chdir(absDir); err != nil {
+		return fmt.Errorf("failed to change directory: %v", err)
+	}
+	a.WorkDir = absDir
+	// Relative paths in cached results now point somewhere else
+	a.cache.clear()
+	return nil
+}
+
+// SetWorkspace confines the built-in file tools to dir
+func (a *Agent) SetWorkspace(dir string) error {
+	workspace, err := tools.NewWorkspace(dir)
+	if err != nil {
+		return err
+	}
+	*a.Workspace = *workspace
+	a.cache.clear()
+	return nil
+}
+
+// RegisterTool adds a tool to the agent, rejecting names that are already taken
+func (a *Agent) RegisterTool(tool tools.Tool) error {
+	name := tool.Definition().Name
+	for _, t := range a.Tools {
+		if t.Definition().Name == name {
+			return fmt.Errorf("duplicate tool name: %s", name)
+		}
+	}
+	a.Tools = append(a.Tools, tool)
+	return nil
+}
+
+// SetStreamCallback sets the callback function for streamed content
+func (a *Agent) SetStreamCallback(callback StreamCallback) {
+	a.StreamCallback = callback
+}
+
+// DenyDestructive is the ConfirmFunc for headless runs, where there's no one to ask: every
+// destructive call is declined
+func DenyDestructive(desc string) bool {
+	return false
+}
+
+// SetConfirmFunc sets the callback that approves destructive tool calls
+func (a *Agent) SetConfirmFunc(confirm ConfirmFunc) {
+	a.ConfirmFunc = confirm
+}
+
 // SetToolCallback sets the callback function for real-time tool events
 func (a *Agent) SetToolCallback(callback ToolCallback) {
 	a.ToolCallback = callback
@@ -263,7 +690,119 @@ func (a *Agent) GetHistory() []llm.Message {
 	return a.History
 }
 
+// CloneHistory returns a deep copy of the conversation history, so a fork can diverge
+// without touching the original's messages, tool calls, or arguments
+func (a *Agent) CloneHistory() []llm.Message {
+	history := make([]llm.Message, len(a.History))
+	for i, msg := range a.History {
+		history[i] = cloneMessage(msg)
+	}
+	return history
+}
+
+// cloneMessage deep-copies a message's tool calls and usage
+func cloneMessage(msg llm.Message) llm.Message {
+	if msg.ToolCalls != nil {
+		calls := make([]llm.ToolCall, len(msg.ToolCalls))
+		for i, tc := range msg.ToolCalls {
+			tc.Arguments = cloneValue(tc.Arguments).(map[string]interface{})
+			calls[i] = tc
+		}
+		msg.ToolCalls = calls
+	}
+	if msg.Usage != nil {
+		usage := *msg.Usage
+		msg.Usage = &usage
+	}
+	return msg
+}
+
+// cloneValue deep-copies decoded JSON values (maps, slices, and scalars)
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		c := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			c[k] = cloneValue(val)
+		}
+		return c
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		c := make([]interface{}, len(v))
+		for i, val := range v {
+			c[i] = cloneValue(val)
+		}
+		return c
+	}
+	return v
+}
+
 // GetToolDefinitions returns the definitions of available tools
 func (a *Agent) GetToolDefinitions() []tools.Tool {
 	return a.Tools
-}
\ No newline at end of file
+}
+
+// CheckEnv reports CLIPPY_* settings the agent can't use. New falls back to defaults for
+// them, so callers should check first to tell the user instead of silently ignoring a typo.
+func CheckEnv() error {
+	for _, key := range intSettings {
+		if _, err := parseEnvInt(key); err != nil {
+			return err
+		}
+	}
+	_, err := redactorFromEnv(os.Getenv("CLIPPY_REDACT_PATTERNS"))
+	return err
+}
+
+// intSettings lists the numeric CLIPPY_* settings read with envInt, for CheckEnv
+var intSettings = []string{
+	"CLIPPY_REPAIR_AFTER",
+	"CLIPPY_MAX_CONTEXT_TOKENS",
+	"CLIPPY_MAX_TURNS",
+	"CLIPPY_TOOL_WORKERS",
+	"CLIPPY_TIMEOUT",
+	"CLIPPY_TOKEN_BUDGET",
+	"CLIPPY_MAX_READ_BYTES",
+	"CLIPPY_MAX_WRITE_BYTES",
+	"CLIPPY_MAX_LIST_ENTRIES",
+	"CLIPPY_MAX_FIND_RESULTS",
+	"CLIPPY_COMMAND_TIMEOUT",
+	"CLIPPY_MAX_COMMAND_OUTPUT",
+	"CLIPPY_MAX_FETCH_BYTES",
+}
+
+// envInt reads an integer setting from the environment, returning 0 (the default) when unset
+// or invalid; CheckEnv reports invalid values
+func envInt(key string) int {
+	n, _ := parseEnvInt(key)
+	return n
+}
+
+// parseEnvInt reads an integer setting from the environment, returning 0 when it's unset
+func parseEnvInt(key string) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: expected a whole number", key, value)
+	}
+	return n, nil
+}
+
+// envList reads a comma-separated setting from the environment, dropping empty entries
+func envList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// cachedResultNote is appended to results served from the tool cache
+const cachedResultNote = "\n\n(cached result: this tool was already called with the same arguments and nothing it depends on has changed since)"
+
+// cacheableTools lists the idempotent, read-only tools whose results can be reused
+var cacheableTools = map[string]bool{
+	"read_file":             true,
+	"read_file_lines":       true,
+	"list_directory":        true,
+	"search_files":          true,
+	"count_matches":         true,
+	"find_files":            true,
+	"file_stat":             true,
+	"get_current_directory": true,
+}
+
+// pathArgs lists which arguments of a mutating tool name the paths it touches
+var pathArgs = map[string][]string{
+	"write_file":       {"path"},
+	"edit_file":        {"path"},
+	"append_to_file":   {"path"},
+	"delete_file":      {"path"},
+	"create_directory": {"path"},
+	"move_file":        {"source", "destination"},
+}
+
+type cacheEntry struct {
+	path   string // Absolute path the result depends on (empty if none)
+	result string
+}
+
+// toolCache memoizes read-only tool results for the session, keyed by tool name and
+// arguments. It's safe for the concurrent calls of a parallel tool batch.
+type toolCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newToolCache() *toolCache {
+	return &toolCache{entries: make(map[string]cacheEntry)}
+}
+
+// cacheKey builds a stable key from the tool name and its arguments
+func cacheKey(tc llm.ToolCall) string {
+	// json.Marshal sorts map keys, so equal arguments always encode the same way
+	argsJSON, _ := json.Marshal(tc.Arguments)
+	return tc.Name + ":" + string(argsJSON)
+}
+
+// lookup returns a cached result for a read-only tool call
+func (c *toolCache) lookup(tc llm.ToolCall) (string, bool) {
+	if !cacheableTools[tc.Name] {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[cacheKey(tc)]
+	return entry.result, ok
+}
+
+// store records the result of a read-only tool call
+func (c *toolCache) store(tc llm.ToolCall, result string) {
+	if !cacheableTools[tc.Name] {
+		return
+	}
+	path, ok := tc.Arguments["path"].(string)
+	if !ok {
+		// find_files names its directory "root"
+		path, _ = tc.Arguments["root"].(string)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cacheKey(tc)] = cacheEntry{path: absPath(path), result: result}
+}
+
+// invalidate drops entries that a non-cacheable tool call may have made stale
+func (c *toolCache) invalidate(tc llm.ToolCall) {
+	if cacheableTools[tc.Name] {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	argNames, ok := pathArgs[tc.Name]
+	if !ok {
+		// Commands and unknown tools could touch anything
+		c.entries = make(map[string]cacheEntry)
+		return
+	}
+
+	for _, name := range argNames {
+		path, ok := tc.Arguments[name].(string)
+		if !ok {
+			c.entries = make(map[string]cacheEntry)
+			return
+		}
+		changed := absPath(path)
+		for key, entry := range c.entries {
+			if entry.path == "" {
+				continue
+			}
+			if pathContains(entry.path, changed) || pathContains(changed, entry.path) {
+				delete(c.entries, key)
+			}
+		}
+	}
+}
+
+// clear drops every cached result
+func (c *toolCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cacheEntry)
+}
+
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// pathContains reports whether target is dir itself or lies inside it
+func pathContains(dir, target string) bool {
+	if dir == target {
+		return true
+	}
+	return strings.HasPrefix(target, dir+string(filepath.Separator))
+}
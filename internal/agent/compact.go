@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// DefaultKeepToolResults is how many of the most recent tool results compaction leaves intact
+const DefaultKeepToolResults = 4
+
+// compactMinChars skips tool results too short to be worth a summarization call
+const compactMinChars = 400
+
+// compactedPrefix marks a tool result that has already been replaced by a summary
+const compactedPrefix = "[compacted] "
+
+// CompactResult reports what CompactToolResults or SummarizeOldHistory reclaimed
+type CompactResult struct {
+	Compacted    int // Messages replaced by summaries
+	TokensBefore int // Estimated tokens in those messages before compaction
+	TokensAfter  int // Estimated tokens in the summaries
+}
+
+// Reclaimed is the estimated number of tokens compaction saved
+func (r CompactResult) Reclaimed() int {
+	return r.TokensBefore - r.TokensAfter
+}
+
+// OneShot sends prompt as a standalone request with no history or tools and returns the reply
+func (a *Agent) OneShot(ctx context.Context, prompt string) (string, error) {
+	if a.LLM == nil {
+		return "", errors.New("no LLM provider configured")
+	}
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := a.LLM.Generate(ctx, []llm.Message{{Role: "user", Content: prompt}}, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
+
+// CompactToolResults replaces older, verbose tool results in the conversation with one-line
+// summaries from OneShot, leaving the keep most recent results untouched (negative keeps
+// DefaultKeepToolResults). Messages keep their roles and ToolCallIDs, so every tool call still
+// has its result and the history stays a valid request. A failed summary stops compaction,
+// keeping whatever was already reclaimed.
+func (a *Agent) CompactToolResults(ctx context.Context, keep int) (CompactResult, error) {
+	if keep < 0 {
+		keep = DefaultKeepToolResults
+	}
+
+	start := a.preambleLen()
+	var candidates []int
+	for i := start; i < len(a.History); i++ {
+		if a.History[i].Role == "tool" {
+			candidates = append(candidates, i)
+		}
+	}
+	candidates = candidates[:max(len(candidates)-keep, 0)]
+
+	var result CompactResult
+	for _, i := range candidates {
+		msg := a.History[i]
+		if len(msg.Content) < compactMinChars || strings.HasPrefix(msg.Content, compactedPrefix) {
+			continue
+		}
+
+		call := a.findToolCall(msg.ToolCallID, i)
+		args, _ := json.Marshal(call.Arguments)
+		summary, err := a.OneShot(ctx, fmt.Sprintf(
+			"Summarize this output of the %s tool (arguments: %s) in one short line that keeps the facts a coding assistant would need later, e.g. \"412 lines, defines main() and parseFlags()\". Reply with the summary only.\n\n%s",
+			call.Name, args, msg.Content))
+		if err != nil {
+			return result, fmt.Errorf("summarizing %s result: %w", call.Name, err)
+		}
+
+		compacted := compactedPrefix + strings.Join(strings.Fields(summary), " ")
+		result.Compacted++
+		result.TokensBefore += estimateTokens(msg.Content)
+		result.TokensAfter += estimateTokens(compacted)
+		a.History[i].Content = compacted
+	}
+
+	return result, nil
+}
+
+// findToolCall returns the call that produced the tool result at index before
+func (a *Agent) findToolCall(id string, before int) llm.ToolCall {
+	for i := before - 1; i >= 0; i-- {
+		for _, tc := range a.History[i].ToolCalls {
+			if tc.ID == id {
+				return tc
+			}
+		}
+	}
+	return llm.ToolCall{ID: id, Name: "unknown"}
+}
+
+// estimateTokens approximates a token count at about four characters per token
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// Example is a few-shot exchange sent to the model ahead of the conversation to steer its replies
+type Example struct {
+	User      string `json:"user"`
+	Assistant string `json:"assistant"`
+}
+
+// LoadExamples reads few-shot examples from a JSON file holding a list of user/assistant pairs
+func LoadExamples(path string) ([]Example, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read examples: %v", err)
+	}
+	var examples []Example
+	if err := json.Unmarshal(data, &examples); err != nil {
+		return nil, fmt.Errorf("invalid examples file %s: %v", path, err)
+	}
+	for i, ex := range examples {
+		if ex.User == "" || ex.Assistant == "" {
+			return nil, fmt.Errorf("example %d in %s needs both user and assistant text", i+1, path)
+		}
+	}
+	return examples, nil
+}
+
+// SetExamples replaces the few-shot examples that follow the system prompt. Example messages
+// are sent to the model but not shown in the transcript, and survive ClearHistory.
+func (a *Agent) SetExamples(examples []Example) {
+	n := a.preambleLen()
+	var kept []llm.Message
+	for _, msg := range a.History[:n] {
+		if !msg.Example {
+			kept = append(kept, msg)
+		}
+	}
+	for _, ex := range examples {
+		kept = append(kept,
+			llm.Message{Role: "user", Content: ex.User, Example: true},
+			llm.Message{Role: "assistant", Content: ex.Assistant, Example: true},
+		)
+	}
+	a.History = append(kept, a.History[n:]...)
+}
+
+// preambleLen counts the leading system prompt and example messages that aren't part of the conversation
+func (a *Agent) preambleLen() int {
+	n := 0
+	for n < len(a.History) && isPreamble(a.History[n]) {
+		n++
+	}
+	return n
+}
+
+// isPreamble reports whether msg is a system prompt or example rather than conversation.
+// Summary notes are conversation: they replace turns, and go when the conversation is cleared.
+func isPreamble(msg llm.Message) bool {
+	return (msg.Role == "system" && !isSummary(msg)) || msg.Example
+}
+
+// Conversation returns the history after the system prompt and examples
+func (a *Agent) Conversation() []llm.Message {
+	return a.History[a.preambleLen():]
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// ExportMarkdown writes the conversation (without the system prompt or examples) as Markdown:
+// user turns as blockquotes, assistant turns as text, and tool calls and results as fenced
+// code blocks, with token usage footers under each assistant turn that reported one and at the end
+func (a *Agent) ExportMarkdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Conversation with %s\n", a.Name)
+
+	for _, msg := range a.Conversation() {
+		bw.WriteString("\n")
+		switch msg.Role {
+		case "user":
+			bw.WriteString("**You:**\n\n")
+			for _, line := range strings.Split(msg.Content, "\n") {
+				bw.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+			}
+		case "assistant":
+			fmt.Fprintf(bw, "**%s:**\n\n", a.Name)
+			if msg.Content != "" {
+				bw.WriteString(msg.Content + "\n")
+			}
+			for _, tc := range msg.ToolCalls {
+				args, err := json.MarshalIndent(tc.Arguments, "", "  ")
+				if err != nil {
+					return err
+				}
+				if msg.Content != "" {
+					bw.WriteString("\n")
+				}
+				fmt.Fprintf(bw, "Tool call: `%s`\n\n", tc.Name)
+				writeFenced(bw, "json", string(args))
+			}
+			if msg.Usage != nil {
+				fmt.Fprintf(bw, "\n_Tokens: %d prompt, %d completion, %d total_\n",
+					msg.Usage.PromptTokens, msg.Usage.CompletionTokens, msg.Usage.TotalTokens)
+			}
+		case "tool":
+			bw.WriteString("**Tool result:**\n\n")
+			writeFenced(bw, "", msg.Content)
+		}
+	}
+
+	if total := conversationUsage(a.Conversation()); total.TotalTokens > 0 {
+		fmt.Fprintf(bw, "\n---\n\n_Total tokens: %d prompt, %d completion, %d total_\n",
+			total.PromptTokens, total.CompletionTokens, total.TotalTokens)
+	}
+	return bw.Flush()
+}
+
+// writeFenced writes content in a code fence longer than any backtick run inside it
+func writeFenced(w io.StringWriter, lang, content string) {
+	fence := strings.Repeat("`", max(3, longestRun(content, '`')+1))
+	w.WriteString(fence + lang + "\n")
+	w.WriteString(strings.TrimSuffix(content, "\n") + "\n")
+	w.WriteString(fence + "\n")
+}
+
+// longestRun returns the length of the longest run of r in s
+func longestRun(s string, r rune) int {
+	longest, run := 0, 0
+	for _, c := range s {
+		if c == r {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// conversationUsage sums the usage reported across the conversation
+func conversationUsage(history []llm.Message) llm.Usage {
+	var total llm.Usage
+	for _, msg := range history {
+		if msg.Usage != nil {
+			total.PromptTokens += msg.Usage.PromptTokens
+			total.CompletionTokens += msg.Usage.CompletionTokens
+			total.TotalTokens += msg.Usage.TotalTokens
+		}
+	}
+	return total
+}
@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"encoding/json"
+	"hash/maphash"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// callSignatures reduces a turn's tool calls to canonical signatures for loop detection.
+// Each signature hashes the tool name and its arguments re-encoded as JSON (which sorts
+// map keys and normalizes whitespace and number formatting), so calls that mean the same
+// thing match however their arguments were built. Call IDs are ignored since providers
+// assign fresh ones every turn. The seed is chosen per session so signatures can't be
+// predicted or precomputed across sessions.
+func callSignatures(seed maphash.Seed, calls []llm.ToolCall) []uint64 {
+	sigs := make([]uint64, len(calls))
+	for i, tc := range calls {
+		var h maphash.Hash
+		h.SetSeed(seed)
+		h.WriteString(tc.Name)
+		h.WriteByte(0)
+		args, _ := json.Marshal(tc.Arguments)
+		h.Write(args)
+		sigs[i] = h.Sum64()
+	}
+	return sigs
+}
+
+// sameSignatures reports whether two turns made the same calls in the same order
+func sameSignatures(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
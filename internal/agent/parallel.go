@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+	"github.com/cellwebb/clippy-go/internal/tools"
+)
+
+// DefaultToolWorkers is how many read-only tool calls run at once when Agent.ToolWorkers is unset
+const DefaultToolWorkers = 4
+
+// toolOutcome is what one tool call produced
+type toolOutcome struct {
+	result  string
+	isError bool
+}
+
+func (a *Agent) toolWorkers() int {
+	if a.ToolWorkers > 0 {
+		return a.ToolWorkers
+	}
+	return DefaultToolWorkers
+}
+
+// toolBatches splits a turn's calls into batches, as indices in order. Consecutive valid
+// read-only calls share a batch; a mutating or invalid call is a batch of its own, so writes
+// never race each other or the reads around them.
+func (a *Agent) toolBatches(calls []llm.ToolCall, valid []bool) [][]int {
+	parallel := func(j int) bool {
+		if a.toolWorkers() <= 1 || !valid[j] {
+			return false
+		}
+		tool := a.tool(calls[j].Name)
+		return tool != nil && !tools.Mutates(tool)
+	}
+	var batches [][]int
+	for i := 0; i < len(calls); {
+		end := i + 1
+		if parallel(i) {
+			for end < len(calls) && parallel(end) {
+				end++
+			}
+		}
+		batch := make([]int, 0, end-i)
+		for j := i; j < end; j++ {
+			batch = append(batch, j)
+		}
+		batches = append(batches, batch)
+		i = end
+	}
+	return batches
+}
+
+// runToolBatch executes the valid calls in batch, up to toolWorkers at a time, storing each
+// outcome at its call's index. Invalid calls keep the outcome validation gave them.
+func (a *Agent) runToolBatch(calls []llm.ToolCall, batch []int, valid []bool, outcomes []toolOutcome) {
+	run := func(j int) {
+		result, isError := a.executeToolCall(calls[j])
+		outcomes[j] = toolOutcome{result: result, isError: isError}
+	}
+	if len(batch) == 1 {
+		if valid[batch[0]] {
+			run(batch[0])
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, a.toolWorkers())
+	for _, j := range batch {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			run(j)
+		}()
+	}
+	wg.Wait()
+}
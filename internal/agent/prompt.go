@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// DefaultSystemPrompt is Clippy's persona, used unless CLIPPY_SYSTEM_PROMPT or
+// ~/.clippy/prompt.txt replaces it
+const DefaultSystemPrompt = "You are Clippy, the helpful Microsoft Office assistant, but with a Vaporwave aesthetic. You are helpful, slightly annoying, and make corny coding jokes. You love the 80s/90s aesthetic, synthwave music, and neon colors. Use the paperclip emoji (📎) and eyeballs emoji (👀) throughout your responses, sometimes together and sometimes separately, but NEVER start your response with an emoji. Use other emojis sparingly. Keep your responses concise and fun. You have access to tools to: read files, write files, edit files, apply unified diffs, list directories, search files, find files by name pattern, count pattern matches, create directories, delete files, move/rename files, append to files, read specific file lines, check file size and modification time, get current directory, show git status, diffs, logs, and commits, fetch web pages, and run shell commands. Use them to help users with coding tasks."
+
+// SystemPromptPath is the file a custom system prompt is read from at startup
+func SystemPromptPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".clippy", "prompt.txt")
+}
+
+// startupSystemPrompt picks the system prompt for a new agent: CLIPPY_SYSTEM_PROMPT, then
+// SystemPromptPath, then DefaultSystemPrompt
+func startupSystemPrompt() string {
+	if prompt := strings.TrimSpace(os.Getenv("CLIPPY_SYSTEM_PROMPT")); prompt != "" {
+		return prompt
+	}
+	if path := SystemPromptPath(); path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			if prompt := strings.TrimSpace(string(data)); prompt != "" {
+				return prompt
+			}
+		}
+	}
+	return DefaultSystemPrompt
+}
+
+// SystemPrompt returns the current system prompt, or "" if there is none
+func (a *Agent) SystemPrompt() string {
+	if len(a.History) > 0 && a.History[0].Role == "system" {
+		return a.History[0].Content
+	}
+	return ""
+}
+
+// SetSystemPrompt replaces the system prompt, adding one if the history has none. The
+// conversation is kept, so the next reply already follows the new instructions.
+func (a *Agent) SetSystemPrompt(prompt string) {
+	if len(a.History) > 0 && a.History[0].Role == "system" {
+		a.History[0].Content = prompt
+		return
+	}
+	a.History = append([]llm.Message{{Role: "system", Content: prompt}}, a.History...)
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// redactedMark replaces each masked secret
+const redactedMark = "[REDACTED]"
+
+// DefaultSecretPatterns match common credentials. When a pattern has a capture group only the
+// group is masked, so "API_KEY=abc" keeps its name and loses its value.
+var DefaultSecretPatterns = []string{
+	`sk-[A-Za-z0-9_-]{16,}`,          // OpenAI and Anthropic API keys
+	`\bAKIA[0-9A-Z]{16}\b`,           // AWS access key IDs
+	`\bgh[pousr]_[A-Za-z0-9]{36,}`,   // GitHub tokens
+	`\bxox[abprs]-[A-Za-z0-9-]{10,}`, // Slack tokens
+	`\bAIza[0-9A-Za-z_-]{35}`,        // Google API keys
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	// Env-style assignments such as GITHUB_TOKEN=...: the name must be uppercase and end in the
+	// keyword, so source like max_tokens: 4096 or token := getToken() is left alone
+	`\b[A-Z][A-Z0-9_]*(?:KEY|SECRET|TOKEN|PASSWORD|PASSWD)\s*=\s*["']?([^\s"'=:][^\s"']*)`,
+	`(?i)\bbearer\s+([A-Za-z0-9._~+/=-]{16,})`,
+}
+
+// Redactor masks secrets in text using regular expressions
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor compiles the given patterns into a Redactor
+func NewRedactor(patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Redact returns text with every match masked
+func (r *Redactor) Redact(text string) string {
+	for _, re := range r.patterns {
+		text = re.ReplaceAllStringFunc(text, func(match string) string {
+			sub := re.FindStringSubmatchIndex(match)
+			if len(sub) < 4 || sub[2] < 0 {
+				return redactedMark
+			}
+			return match[:sub[2]] + redactedMark + match[sub[3]:]
+		})
+	}
+	return text
+}
+
+// redactorFromEnv builds the default Redactor plus any extra patterns given as a JSON list in
+// CLIPPY_REDACT_PATTERNS. Invalid extras are returned as an error alongside the default
+// Redactor, so a typo is reported without disabling redaction.
+func redactorFromEnv(extra string) (*Redactor, error) {
+	defaults, _ := NewRedactor(DefaultSecretPatterns)
+	if strings.TrimSpace(extra) == "" {
+		return defaults, nil
+	}
+	var more []string
+	if err := json.Unmarshal([]byte(extra), &more); err != nil {
+		return defaults, fmt.Errorf("invalid CLIPPY_REDACT_PATTERNS %q: expected a JSON list of regular expressions like [\"internal-[0-9]+\"] (%v)", extra, err)
+	}
+	if _, err := NewRedactor(more); err != nil {
+		return defaults, fmt.Errorf("invalid CLIPPY_REDACT_PATTERNS: %v", err)
+	}
+	r, _ := NewRedactor(append(append([]string(nil), DefaultSecretPatterns...), more...))
+	return r, nil
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+	"github.com/cellwebb/clippy-go/internal/tools"
+)
+
+// DefaultRepairAfter is how many invalid calls in a row to one tool trigger a corrective message
+const DefaultRepairAfter = 2
+
+// repairAttempts is how many corrective messages are sent before the turn gives up
+const repairAttempts = 2
+
+// repairTracker counts consecutive invalid-argument calls per tool within a turn. Loop
+// detection already stops identical repeats; this catches a model that keeps varying
+// its arguments without ever matching the schema.
+type repairTracker struct {
+	after    int
+	failures map[string]int
+	gaveUp   string // Tool the turn gave up on, if any
+}
+
+func newRepairTracker(after int) *repairTracker {
+	if after <= 0 {
+		after = DefaultRepairAfter
+	}
+	return &repairTracker{after: after, failures: make(map[string]int)}
+}
+
+// invalid records a rejected call and returns the tool result to send back. Once the
+// streak reaches the threshold, the result echoes the full schema to break the cycle.
+func (r *repairTracker) invalid(def tools.ToolDefinition, err error) string {
+	r.failures[def.Name]++
+	n := r.failures[def.Name]
+	result := fmt.Sprintf("Invalid arguments for %s: %v", def.Name, err)
+	if n < r.after {
+		return result
+	}
+	if n >= r.after+repairAttempts {
+		r.gaveUp = def.Name
+		return result
+	}
+	schema, _ := json.MarshalIndent(def.Parameters, "", "  ")
+	return fmt.Sprintf("%s\n\nThis is invalid call #%d to %s in a row. Stop guessing: re-read the schema below and pass exactly these parameters with exactly these types, or use a different approach.\n%s",
+		result, n, def.Name, schema)
+}
+
+// valid ends a tool's streak of invalid calls
+func (r *repairTracker) valid(name string) {
+	delete(r.failures, name)
+}
+
+// validateCall checks tc's arguments against its tool's schema. Unknown tools pass,
+// leaving executeToolCall to report them.
+func (a *Agent) validateCall(tc llm.ToolCall) (tools.ToolDefinition, error) {
+	for _, t := range a.Tools {
+		if def := t.Definition(); def.Name == tc.Name {
+			return def, tools.ValidateArguments(def, tc.Arguments)
+		}
+	}
+	return tools.ToolDefinition{}, nil
+}
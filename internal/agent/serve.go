@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// maxServeLineBytes bounds a single JSON-lines request
+const maxServeLineBytes = 10 << 20 // 10MB
+
+// ServeRequest is one line of input in JSON-lines mode
+type ServeRequest struct {
+	ID    string `json:"id,omitempty"` // Echoed on every event the request produces
+	Input string `json:"input"`
+}
+
+// ServeEvent is one line of output in JSON-lines mode. Type is "tool" for a finished tool
+// call, "response" for the final answer, or "error" for a request that couldn't be run or
+// a turn that failed (no provider, offline, over budget, timed out), explained in Error.
+type ServeEvent struct {
+	Type      string                 `json:"type"`
+	ID        string                 `json:"id,omitempty"`
+	Content   string                 `json:"content,omitempty"`
+	ToolsUsed []string               `json:"tools_used,omitempty"`
+	Usage     *llm.Usage             `json:"usage,omitempty"`
+	Tool      string                 `json:"tool,omitempty"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	IsError   bool                   `json:"is_error,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// ServeJSONL drives the agent from JSON-lines requests on r, one {"input": "..."} object per
+// line, writing events to w one object per line: a "tool" event as each tool call finishes,
+// then a "response" event, or an "error" event if the turn failed. It returns when r is
+// exhausted, so editors can keep one process (and its conversation) alive for a whole session.
+func (a *Agent) ServeJSONL(r io.Reader, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	var current ServeRequest
+	var writeErr error
+	emit := func(ev ServeEvent) {
+		if writeErr == nil {
+			writeErr = enc.Encode(ev)
+		}
+	}
+
+	prevCallback := a.ToolCallback
+	defer func() { a.ToolCallback = prevCallback }()
+	a.ToolCallback = func(exec ToolExecution) {
+		if !exec.Done {
+			return
+		}
+		emit(ServeEvent{Type: "tool", ID: current.ID, Tool: exec.Name, Arguments: exec.Arguments, Content: exec.Result, IsError: exec.IsError})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxServeLineBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		current = ServeRequest{}
+		if err := json.Unmarshal([]byte(line), &current); err != nil {
+			emit(ServeEvent{Type: "error", Error: fmt.Sprintf("invalid request: %v", err)})
+		} else if strings.TrimSpace(current.Input) == "" {
+			emit(ServeEvent{Type: "error", ID: current.ID, Error: "missing 'input'"})
+		} else {
+			resp := a.GetResponse(current.Input)
+			if resp.Failed {
+				emit(ServeEvent{Type: "error", ID: current.ID, Error: resp.Content, ToolsUsed: resp.ToolsUsed, Usage: resp.Usage})
+			} else {
+				emit(ServeEvent{Type: "response", ID: current.ID, Content: resp.Content, ToolsUsed: resp.ToolsUsed, Usage: resp.Usage})
+			}
+		}
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+	return scanner.Err()
+}
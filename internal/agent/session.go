@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// savedSession is the on-disk form of a conversation written by SaveSession
+type savedSession struct {
+	SavedAt time.Time     `json:"saved_at"`
+	WorkDir string        `json:"work_dir,omitempty"`
+	History []llm.Message `json:"history"`
+}
+
+// SaveSession writes the conversation history to path as JSON, creating its directory
+func (a *Agent) SaveSession(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %v", err)
+	}
+	data, err := json.MarshalIndent(savedSession{
+		SavedAt: time.Now(),
+		WorkDir: a.WorkDir,
+		History: a.History,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save session: %v", err)
+	}
+	return nil
+}
+
+// LoadSession replaces the conversation with one saved by SaveSession. Only the saved
+// conversation is restored: the current system prompt and examples are kept even if the
+// session was saved under different ones, so the model always sees today's instructions.
+func (a *Agent) LoadSession(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read session: %v", err)
+	}
+	var saved savedSession
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid session file %s: %v", path, err)
+	}
+
+	// Skip the saved preamble, which may differ from ours
+	start := 0
+	for start < len(saved.History) && isPreamble(saved.History[start]) {
+		start++
+	}
+	history := append([]llm.Message(nil), a.History[:a.preambleLen()]...)
+	a.History = append(history, saved.History[start:]...)
+	a.cache.clear()
+	return nil
+}
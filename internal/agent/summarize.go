@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// summaryPrefix marks the system note that stands in for summarized turns
+const summaryPrefix = "[Summary of earlier conversation] "
+
+// summaryToolChars caps how much of each tool result is sent to be summarized
+const summaryToolChars = 2000
+
+// isSummary reports whether msg is a note left by summarization
+func isSummary(msg llm.Message) bool {
+	return msg.Role == "system" && strings.HasPrefix(msg.Content, summaryPrefix)
+}
+
+// SummarizeOldHistory replaces every exchange before the latest one with a single system
+// note summarizing it, via one OneShot call. Whole exchanges are replaced, so no tool call
+// loses its result. Compacted counts the messages replaced; nothing changes on error.
+func (a *Agent) SummarizeOldHistory(ctx context.Context) (CompactResult, error) {
+	return a.summarizeHistory(ctx, 0)
+}
+
+// summarizeHistory summarizes the oldest exchanges until the rest of the history fits
+// keepTokens (see oldExchanges)
+func (a *Agent) summarizeHistory(ctx context.Context, keepTokens int) (CompactResult, error) {
+	start, end := a.oldExchanges(keepTokens)
+	if end-start < 2 {
+		return CompactResult{}, nil
+	}
+
+	var transcript strings.Builder
+	var result CompactResult
+	for _, msg := range a.History[start:end] {
+		result.TokensBefore += messageTokens(msg)
+		switch {
+		case isSummary(msg):
+			fmt.Fprintf(&transcript, "Earlier summary: %s\n", strings.TrimPrefix(msg.Content, summaryPrefix))
+		case msg.Role == "tool":
+			content := msg.Content
+			if len(content) > summaryToolChars {
+				content = content[:summaryToolChars] + "... (truncated)"
+			}
+			fmt.Fprintf(&transcript, "Tool result: %s\n", content)
+		default:
+			if msg.Content != "" {
+				fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, msg.Content)
+			}
+			for _, tc := range msg.ToolCalls {
+				args, _ := json.Marshal(tc.Arguments)
+				fmt.Fprintf(&transcript, "%s called %s %s\n", msg.Role, tc.Name, args)
+			}
+		}
+	}
+
+	summary, err := a.OneShot(ctx, "Summarize this earlier part of a conversation between a user and a coding assistant so the assistant can continue without it. Keep file names, decisions, facts learned from tools, and anything still to do; drop pleasantries. Reply with the summary only.\n\n"+transcript.String())
+	if err != nil {
+		return CompactResult{}, fmt.Errorf("summarizing history: %w", err)
+	}
+
+	note := llm.Message{Role: "system", Content: summaryPrefix + summary}
+	result.Compacted = end - start
+	result.TokensAfter = messageTokens(note)
+	history := append([]llm.Message(nil), a.History[:start]...)
+	history = append(history, note)
+	a.History = append(history, a.History[end:]...)
+	return result, nil
+}
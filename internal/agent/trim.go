@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"encoding/json"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// DefaultMaxContextTokens is the estimated history size trimming starts at when
+// Agent.MaxContextTokens is unset and the model's context window isn't known
+const DefaultMaxContextTokens = 100000
+
+// contextBudget is the history size trimHistory keeps the conversation under: MaxContextTokens
+// if set, else what fits the model's context window once room is left for the reply and a
+// quarter is held back for tool definitions and error in the estimate
+func (a *Agent) contextBudget() int {
+	if a.MaxContextTokens > 0 {
+		return a.MaxContextTokens
+	}
+	if a.LLM == nil {
+		return DefaultMaxContextTokens
+	}
+	cfg := a.LLM.GetConfig()
+	limits, ok := llm.LimitsFor(cfg.Model)
+	if !ok || limits.ContextWindow == 0 {
+		return DefaultMaxContextTokens
+	}
+	window := limits.ContextWindow
+	reply := cfg.MaxTokens
+	if reply <= 0 {
+		reply = min(limits.MaxOutput, window/4)
+	}
+	return max(window-window/4-reply, window/4)
+}
+
+// imageTokens is a rough per-image cost; providers charge by resolution, and a typical
+// screenshot lands around here
+const imageTokens = 1000
+
+// messageTokens estimates what a message costs in the context window, tool calls and
+// images included
+func messageTokens(msg llm.Message) int {
+	n := estimateTokens(msg.Content) + len(msg.Images)*imageTokens
+	for _, tc := range msg.ToolCalls {
+		args, _ := json.Marshal(tc.Arguments)
+		n += estimateTokens(tc.Name) + estimateTokens(string(args))
+	}
+	return n
+}
+
+// trimHistory drops the oldest exchanges until the history's estimated size fits maxTokens,
+// returning how many messages were removed (see oldExchanges)
+func (a *Agent) trimHistory(maxTokens int) int {
+	start, end := a.oldExchanges(maxTokens)
+	if end == start {
+		return 0
+	}
+	a.History = append(a.History[:start], a.History[end:]...)
+	return end - start
+}
+
+// historyTokens estimates the size of the whole history
+func (a *Agent) historyTokens() int {
+	total := 0
+	for _, msg := range a.History {
+		total += messageTokens(msg)
+	}
+	return total
+}
+
+// oldExchanges returns the range of the oldest exchanges to remove so the rest of the history
+// fits maxTokens. An exchange runs from a user message to the next one, so tool calls are
+// never separated from their results. The system prompt, examples, and the latest user
+// message with everything after it are always kept, even if they alone exceed the budget.
+func (a *Agent) oldExchanges(maxTokens int) (start, end int) {
+	start = a.preambleLen()
+	last := -1
+	for i := len(a.History) - 1; i >= start; i-- {
+		if a.History[i].Role == "user" {
+			last = i
+			break
+		}
+	}
+	if last <= start {
+		return start, start
+	}
+
+	total := a.historyTokens()
+	end = start
+	for end < last && total > maxTokens {
+		next := end + 1
+		for next < last && a.History[next].Role != "user" {
+			next++
+		}
+		for _, msg := range a.History[end:next] {
+			total -= messageTokens(msg)
+		}
+		end = next
+	}
+	return start, end
+}
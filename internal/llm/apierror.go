@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxErrorMessageLen caps how much of an unparseable error body is shown to the user
+const maxErrorMessageLen = 300
+
+// APIError is an error reply from a provider, parsed from its error JSON. Error() is a short
+// human-readable summary for the chat; Body keeps the raw reply for troubleshooting (the
+// CLIPPY_DEBUG log records it in full).
+type APIError struct {
+	StatusCode int           // HTTP status, or 0 for an error sent mid-stream
+	Type       string        // Provider error type, e.g. "invalid_request_error" or "rate_limit_error"
+	Code       string        // Provider error code, e.g. "context_length_exceeded"
+	Message    string        // Provider's explanation
+	RetryAfter time.Duration // Wait the provider asked for before retrying (0 if none)
+	Body       string        // Raw response body
+}
+
+func (e *APIError) Error() string {
+	summary := e.summary()
+	if e.RetryAfter > 0 {
+		summary += fmt.Sprintf(" — try again in %s", e.RetryAfter.Round(time.Second))
+	}
+	if e.Message != "" {
+		summary += ": " + e.Message
+	}
+	return summary
+}
+
+// summary names the kind of failure, from the status or, for stream errors, the error type
+func (e *APIError) summary() string {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return "Authentication failed (check CLIPPY_API_KEY)"
+	case e.StatusCode == http.StatusForbidden:
+		return "Permission denied"
+	case e.StatusCode == http.StatusNotFound:
+		return "Not found (check the model name and base URL)"
+	case e.StatusCode == http.StatusTooManyRequests || e.Type == "rate_limit_error":
+		return "Rate limit exceeded"
+	case e.StatusCode == 529 || e.Type == "overloaded_error":
+		return "Provider overloaded"
+	case e.StatusCode >= 500:
+		return fmt.Sprintf("Provider server error (%d)", e.StatusCode)
+	case e.StatusCode > 0:
+		return fmt.Sprintf("API error (%d)", e.StatusCode)
+	default:
+		return "API error"
+	}
+}
+
+// newAPIError builds an APIError from a failed response's status, headers and body
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := parseAPIError(body)
+	e.StatusCode = resp.StatusCode
+	e.RetryAfter, _ = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	return e
+}
+
+// parseAPIError reads the error JSON OpenAI, Anthropic and Ollama send: an "error" object
+// with message, type and code fields, or (Ollama) an "error" string. Bodies in any other
+// shape are kept, trimmed, as the message.
+func parseAPIError(body []byte) *APIError {
+	e := &APIError{Body: string(body)}
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && len(envelope.Error) > 0 {
+		var detail struct {
+			Message string      `json:"message"`
+			Type    string      `json:"type"`
+			Code    interface{} `json:"code"`
+		}
+		if json.Unmarshal(envelope.Error, &e.Message) == nil {
+			return e
+		}
+		if json.Unmarshal(envelope.Error, &detail) == nil {
+			e.Message, e.Type = detail.Message, detail.Type
+			if detail.Code != nil {
+				e.Code = fmt.Sprint(detail.Code)
+			}
+			return e
+		}
+	}
+	message := []rune(strings.TrimSpace(string(body)))
+	if len(message) > maxErrorMessageLen {
+		message = append(message[:maxErrorMessageLen], '…')
+	}
+	e.Message = string(message)
+	return e
+}
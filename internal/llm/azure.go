@@ -0,0 +1,39 @@
+package llm
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultAzureAPIVersion is the api-version query parameter sent to Azure OpenAI when none is configured
+const DefaultAzureAPIVersion = "2024-10-21"
+
+// Azure OpenAI takes the same chat completions body as OpenAI but serves each model from a
+// deployment with its own URL, and authenticates with an api-key header. OpenAIProvider
+// switches to that shape when Config.Provider is "azure".
+
+// azureURL builds the chat completions URL for cfg's deployment, which defaults to the model
+// name. The endpoint is AzureEndpoint, or BaseURL if that's unset.
+func azureURL(cfg Config) (string, error) {
+	endpoint := cfg.AzureEndpoint
+	if endpoint == "" {
+		endpoint = cfg.BaseURL
+	}
+	if endpoint == "" {
+		return "", fmt.Errorf("azure needs an endpoint: set CLIPPY_AZURE_ENDPOINT, e.g. https://my-resource.openai.azure.com")
+	}
+	deployment := cfg.AzureDeployment
+	if deployment == "" {
+		deployment = cfg.Model
+	}
+	if deployment == "" {
+		return "", fmt.Errorf("azure needs a deployment: set CLIPPY_AZURE_DEPLOYMENT")
+	}
+	version := cfg.AzureAPIVersion
+	if version == "" {
+		version = DefaultAzureAPIVersion
+	}
+	return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		strings.TrimRight(endpoint, "/"), url.PathEscape(deployment), url.QueryEscape(version)), nil
+}
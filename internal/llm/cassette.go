@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Interaction is one recorded API request and the response it received
+type Interaction struct {
+	Request struct {
+		Method string `json:"method"`
+		Path   string `json:"path"` // Matched as a suffix of the URL path, so any base URL works
+	} `json:"request"`
+	Response struct {
+		Status  int               `json:"status"`
+		Headers map[string]string `json:"headers,omitempty"`
+		Body    string            `json:"body"`
+	} `json:"response"`
+}
+
+// Cassette replays recorded interactions in order, standing in for the API in tests and
+// offline demos. It implements http.RoundTripper, so set it as Config.Transport.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+
+	mu   sync.Mutex
+	next int
+}
+
+// LoadCassette reads a cassette from a JSON file
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %v", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// RoundTrip returns the next recorded response, failing if the request doesn't match it
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if c.next >= len(c.Interactions) {
+		return nil, fmt.Errorf("cassette exhausted: no recording for %s %s", req.Method, req.URL.Path)
+	}
+	interaction := c.Interactions[c.next]
+	if interaction.Request.Method != req.Method || !strings.HasSuffix(req.URL.Path, interaction.Request.Path) {
+		return nil, fmt.Errorf("cassette mismatch at interaction %d: expected %s %s, got %s %s",
+			c.next, interaction.Request.Method, interaction.Request.Path, req.Method, req.URL.Path)
+	}
+	c.next++
+
+	resp := &http.Response{
+		StatusCode: interaction.Response.Status,
+		Status:     fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(interaction.Response.Body)),
+		Request:    req,
+	}
+	for key, value := range interaction.Response.Headers {
+		resp.Header.Set(key, value)
+	}
+	return resp, nil
+}
+
+// Remaining reports how many recorded interactions have not been replayed yet
+func (c *Cassette) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.Interactions) - c.next
+}
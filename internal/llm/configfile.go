@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigPath is where provider settings are read from: ~/.clippy/config.yaml
+func DefaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".clippy", "config.yaml")
+}
+
+// fileSettings are the provider settings config.yaml can hold, at the top level or in a
+// profile. Names follow the CLIPPY_* variables, e.g. api_key for CLIPPY_API_KEY.
+type fileSettings struct {
+	Provider         string                 `yaml:"provider"`
+	Model            string                 `yaml:"model"`
+	APIKey           string                 `yaml:"api_key"`
+	BaseURL          string                 `yaml:"base_url"`
+	MaxTokens        int                    `yaml:"max_tokens"`
+	Stop             []string               `yaml:"stop"`
+	Seed             *int                   `yaml:"seed"`
+	Stream           *bool                  `yaml:"stream"`
+	StrictTools      *bool                  `yaml:"strict_tools"`
+	AnthropicVersion string                 `yaml:"anthropic_version"`
+	AnthropicBeta    []string               `yaml:"anthropic_beta"`
+	AzureEndpoint    string                 `yaml:"azure_endpoint"`
+	AzureDeployment  string                 `yaml:"azure_deployment"`
+	AzureAPIVersion  string                 `yaml:"azure_api_version"`
+	ExtraParams      map[string]interface{} `yaml:"extra_params"`
+	Headers          map[string]string      `yaml:"headers"`
+	MaxRetries       *int                   `yaml:"max_retries"`
+}
+
+// configFile is config.yaml: settings shared by every profile, named profiles that add to
+// or replace them, and the profile to use
+type configFile struct {
+	fileSettings `yaml:",inline"`
+	Profile      string                  `yaml:"profile"`
+	Profiles     map[string]fileSettings `yaml:"profiles"`
+}
+
+// apply copies the settings that are set onto cfg
+func (s fileSettings) apply(cfg *Config) {
+	setString := func(dst *string, value string) {
+		if value != "" {
+			*dst = value
+		}
+	}
+	setString(&cfg.Provider, s.Provider)
+	setString(&cfg.Model, s.Model)
+	setString(&cfg.APIKey, s.APIKey)
+	setString(&cfg.BaseURL, s.BaseURL)
+	setString(&cfg.AnthropicVersion, s.AnthropicVersion)
+	setString(&cfg.AzureEndpoint, s.AzureEndpoint)
+	setString(&cfg.AzureDeployment, s.AzureDeployment)
+	setString(&cfg.AzureAPIVersion, s.AzureAPIVersion)
+	if s.MaxTokens > 0 {
+		cfg.MaxTokens = s.MaxTokens
+	}
+	if len(s.Stop) > 0 {
+		cfg.Stop = s.Stop
+	}
+	if s.Seed != nil {
+		cfg.Seed = s.Seed
+	}
+	if s.Stream != nil {
+		cfg.Stream = *s.Stream
+	}
+	if s.StrictTools != nil {
+		cfg.StrictTools = *s.StrictTools
+	}
+	if len(s.AnthropicBeta) > 0 {
+		cfg.AnthropicBeta = s.AnthropicBeta
+	}
+	if len(s.ExtraParams) > 0 {
+		cfg.ExtraParams = s.ExtraParams
+	}
+	if len(s.Headers) > 0 {
+		cfg.Headers = s.Headers
+	}
+	if s.MaxRetries != nil && *s.MaxRetries >= 0 {
+		cfg.MaxRetries = *s.MaxRetries
+	}
+}
+
+// LoadConfigFromFile loads config from a YAML file such as DefaultConfigPath, with any
+// CLIPPY_* variables that are set overriding its values. The file's top-level settings apply
+// to every profile; the profile named by CLIPPY_PROFILE, or else the file's profile key, is
+// layered on top. A missing file is not an error: the config then comes from the environment.
+func LoadConfigFromFile(path string) (Config, error) {
+	cfg := Config{MaxRetries: DefaultMaxRetries}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		err = applyEnv(&cfg)
+		if strings.TrimSpace(cfg.Model) == "" {
+			cfg.Model = DefaultModels[cfg.Provider]
+		}
+		return cfg, err
+	}
+	if err != nil {
+		return LoadConfigFromEnv(), fmt.Errorf("failed to read config %s: %v", path, err)
+	}
+
+	var file configFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && err != io.EOF {
+		return LoadConfigFromEnv(), fmt.Errorf("invalid config %s: %v", path, err)
+	}
+
+	profile := file.Profile
+	if name := strings.TrimSpace(os.Getenv("CLIPPY_PROFILE")); name != "" {
+		profile = name
+	}
+	settings, ok := file.Profiles[profile]
+	if profile != "" && !ok {
+		names := make([]string, 0, len(file.Profiles))
+		for name := range file.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return LoadConfigFromEnv(), fmt.Errorf("profile %q not found in %s (profiles: %s)", profile, path, strings.Join(names, ", "))
+	}
+
+	file.fileSettings.apply(&cfg)
+	if profile != "" {
+		settings.apply(&cfg)
+		cfg.Profile = profile
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, err
+	}
+	if strings.TrimSpace(cfg.Model) == "" {
+		cfg.Model = DefaultModels[cfg.Provider]
+	}
+	return cfg, nil
+}
@@ -0,0 +1,178 @@
+package llm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDebugBodyBytes caps how much of each request and response body the debug log keeps
+const maxDebugBodyBytes = 1 << 20
+
+// redactedHeaders carry credentials and are never written to the debug log
+var redactedHeaders = map[string]bool{
+	"Authorization": true,
+	"X-Api-Key":     true,
+	"Api-Key":       true,
+}
+
+// debugLogMu keeps entries from concurrent requests from interleaving
+var debugLogMu sync.Mutex
+
+// DefaultDebugLogPath is where CLIPPY_DEBUG=1 logs API traffic: ~/.clippy/debug.log
+func DefaultDebugLogPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".clippy", "debug.log")
+}
+
+// debugTransport logs each request and its raw response to a file, with timestamps and
+// timings, for troubleshooting API errors. Credential headers, the API key and the configured
+// extra headers are redacted.
+type debugTransport struct {
+	base    http.RoundTripper
+	path    string
+	apiKey  string
+	headers map[string]string // Config.Headers, which may carry a gateway's credentials
+}
+
+func (t debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := &debugEntry{transport: t, start: time.Now()}
+	fmt.Fprintf(&entry.buf, "=== %s %s %s\n", entry.start.Format(time.RFC3339Nano), req.Method, req.URL)
+	writeDebugHeaders(&entry.buf, req.Header, t.headers)
+	if body := requestBody(req); body != nil {
+		entry.buf.WriteString("\n")
+		writeDebugBody(&entry.buf, body, len(body))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintf(&entry.buf, "--- error after %s: %v\n", time.Since(entry.start).Round(time.Millisecond), err)
+		entry.flush()
+		return nil, err
+	}
+	fmt.Fprintf(&entry.buf, "--- %s (headers after %s)\n", resp.Status, time.Since(entry.start).Round(time.Millisecond))
+	writeDebugHeaders(&entry.buf, resp.Header, t.headers)
+	resp.Body = &debugBody{ReadCloser: resp.Body, entry: entry}
+	return resp, nil
+}
+
+// requestBody returns a copy of req's body without consuming it
+func requestBody(req *http.Request) []byte {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			defer body.Close()
+			data, _ := io.ReadAll(body)
+			return data
+		}
+	}
+	data, _ := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data
+}
+
+// debugEntry collects one request and response, written as a block once the body is closed
+type debugEntry struct {
+	transport debugTransport
+	start     time.Time
+	buf       bytes.Buffer
+	once      sync.Once
+}
+
+// flush appends the entry to the log. Failures are ignored: debugging must never break a request.
+func (e *debugEntry) flush() {
+	e.once.Do(func() {
+		text := e.buf.String()
+		if e.transport.apiKey != "" {
+			text = strings.ReplaceAll(text, e.transport.apiKey, "[REDACTED]")
+		}
+		for _, value := range e.transport.headers {
+			if value != "" {
+				text = strings.ReplaceAll(text, value, "[REDACTED]")
+			}
+		}
+		debugLogMu.Lock()
+		defer debugLogMu.Unlock()
+		os.MkdirAll(filepath.Dir(e.transport.path), 0700)
+		f, err := os.OpenFile(e.transport.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		f.WriteString(text + "\n")
+	})
+}
+
+// debugBody records a response body as the caller reads it, so streamed replies still
+// stream, and logs the entry with the total elapsed time on Close
+type debugBody struct {
+	io.ReadCloser
+	entry *debugEntry
+	body  bytes.Buffer
+	size  int
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if keep := min(n, maxDebugBodyBytes-b.body.Len()); keep > 0 {
+		b.body.Write(p[:keep])
+	}
+	b.size += n
+	return n, err
+}
+
+func (b *debugBody) Close() error {
+	err := b.ReadCloser.Close()
+	e := b.entry
+	e.buf.WriteString("\n")
+	writeDebugBody(&e.buf, b.body.Bytes(), b.size)
+	fmt.Fprintf(&e.buf, "--- done in %s\n", time.Since(e.start).Round(time.Millisecond))
+	e.flush()
+	return err
+}
+
+// writeDebugHeaders writes headers in a stable order, redacting credentials and any header
+// named in extra
+func writeDebugHeaders(w *bytes.Buffer, header http.Header, extra map[string]string) {
+	secret := make(map[string]bool, len(extra))
+	for key := range extra {
+		secret[http.CanonicalHeaderKey(key)] = true
+	}
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := strings.Join(header[key], ", ")
+		if canonical := http.CanonicalHeaderKey(key); redactedHeaders[canonical] || secret[canonical] {
+			value = "[REDACTED]"
+		}
+		fmt.Fprintf(w, "%s: %s\n", key, value)
+	}
+}
+
+// writeDebugBody writes the first maxDebugBodyBytes of a body that was size bytes long
+func writeDebugBody(w *bytes.Buffer, body []byte, size int) {
+	body = body[:min(len(body), maxDebugBodyBytes)]
+	w.Write(body)
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		w.WriteString("\n")
+	}
+	if size > len(body) {
+		fmt.Fprintf(w, "... (%d more bytes)\n", size-len(body))
+	}
+}
@@ -0,0 +1,24 @@
+package llm
+
+// ResponseFormatJSON asks for a reply that is a single valid JSON object
+const ResponseFormatJSON = "json_object"
+
+// jsonInstruction tells the model to reply in JSON. Anthropic has no JSON mode, so it relies
+// on this alone; OpenAI rejects json_object requests whose messages never mention JSON.
+const jsonInstruction = "Respond only with a single valid JSON object. Do not wrap it in a code block or add any text before or after it."
+
+// withResponseFormat adds the instruction format needs to the system prompt, extending the
+// first system message or adding one. messages itself is left unchanged.
+func withResponseFormat(messages []Message, format string) []Message {
+	if format != ResponseFormatJSON {
+		return messages
+	}
+	out := append([]Message(nil), messages...)
+	for i, msg := range out {
+		if msg.Role == "system" {
+			out[i].Content += "\n\n" + jsonInstruction
+			return out
+		}
+	}
+	return append([]Message{{Role: "system", Content: jsonInstruction}}, out...)
+}
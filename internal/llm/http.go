@@ -0,0 +1,104 @@
+package llm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHTTPTimeout bounds a whole API request, including reading a streamed reply, when
+// CLIPPY_HTTP_TIMEOUT is unset. It's generous because long completions stream for minutes.
+const DefaultHTTPTimeout = 10 * time.Minute
+
+var (
+	sharedClientOnce sync.Once
+	sharedClient     *http.Client
+	sharedClientErr  error
+)
+
+// HTTPClient returns the client all providers and FetchModels share, built once from the
+// environment: CLIPPY_PROXY (or the usual HTTPS_PROXY, HTTP_PROXY and NO_PROXY), a custom
+// root CA from CLIPPY_CA_CERT added to the system pool, and CLIPPY_HTTP_TIMEOUT in seconds.
+// Sharing it keeps connections alive across the many requests of an agent loop instead of
+// paying for a new TLS handshake each time. It's safe for concurrent use.
+func HTTPClient() (*http.Client, error) {
+	sharedClientOnce.Do(func() {
+		sharedClient, sharedClientErr = newHTTPClient(os.Getenv)
+	})
+	return sharedClient, sharedClientErr
+}
+
+// newHTTPClient builds a client from the settings getenv returns
+func newHTTPClient(getenv func(string) string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxy := strings.TrimSpace(getenv("CLIPPY_PROXY")); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid CLIPPY_PROXY %q: expected a URL like http://proxy:8080", proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	} else {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+
+	if path := strings.TrimSpace(getenv("CLIPPY_CA_CERT")); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CLIPPY_CA_CERT: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CLIPPY_CA_CERT %s", path)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	timeout := DefaultHTTPTimeout
+	if seconds := parseInt(getenv("CLIPPY_HTTP_TIMEOUT")); seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// clientFor returns the shared client, or one that sends through cfg.Transport (such as a
+// Cassette) when that's set, with the shared timeout either way. With cfg.DebugLog set,
+// traffic is also logged there.
+func clientFor(cfg Config) (*http.Client, error) {
+	client, err := HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	transport := cfg.Transport
+	if transport == nil {
+		if cfg.DebugLog == "" {
+			return client, nil
+		}
+		transport = client.Transport
+	}
+	if cfg.DebugLog != "" {
+		transport = debugTransport{base: transport, path: cfg.DebugLog, apiKey: cfg.APIKey, headers: cfg.Headers}
+	}
+	return &http.Client{Transport: transport, Timeout: client.Timeout}, nil
+}
+
+// maxDrainBytes is how much of an unread reply closeBody discards to keep the connection
+const maxDrainBytes = 64 << 10
+
+// closeBody reads what's left of a response body before closing it. A JSON decoder stops at
+// the end of the value, and the transport only reuses a connection whose body was read to
+// EOF, so trailing bytes would otherwise cost a new connection (and TLS handshake).
+func closeBody(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes))
+	body.Close()
+}
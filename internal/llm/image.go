@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// MaxImageBytes is the largest image LoadImage accepts; Anthropic rejects anything bigger
+const MaxImageBytes = 5 * 1024 * 1024
+
+// ImageData is an image attached to a user message
+type ImageData struct {
+	MediaType string `json:"media_type"` // image/png, image/jpeg, image/gif or image/webp
+	Data      string `json:"data"`       // Base64-encoded file contents
+}
+
+// dataURL renders the image as a data: URL, the form OpenAI's image_url parts take
+func (img ImageData) dataURL() string {
+	return "data:" + img.MediaType + ";base64," + img.Data
+}
+
+// imageTypes are the formats both OpenAI and Anthropic accept
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// LoadImage reads an image file for attaching to a message, sniffing its type from the
+// contents rather than trusting the extension
+func LoadImage(path string) (ImageData, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ImageData{}, fmt.Errorf("failed to read image: %v", err)
+	}
+	if info.Size() > MaxImageBytes {
+		return ImageData{}, fmt.Errorf("image %s is %d bytes; the limit is %d", path, info.Size(), MaxImageBytes)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ImageData{}, fmt.Errorf("failed to read image: %v", err)
+	}
+	mediaType := http.DetectContentType(data)
+	if !imageTypes[mediaType] {
+		return ImageData{}, fmt.Errorf("%s is %s, not a PNG, JPEG, GIF or WebP image", path, mediaType)
+	}
+	return ImageData{MediaType: mediaType, Data: base64.StdEncoding.EncodeToString(data)}, nil
+}
+
+// visionModels are the model name prefixes, per provider, that accept image input
+var visionModels = map[string][]string{
+	"openai":    {"gpt-4o", "gpt-4.1", "gpt-4-turbo", "gpt-4-vision", "gpt-5", "o1", "o3", "o4"},
+	"anthropic": {"claude-3", "claude-sonnet-4", "claude-opus-4", "claude-haiku-4"},
+}
+
+// SupportsImages reports whether the configured model accepts images. Providers leave
+// images out of requests to models that don't, sending only the text.
+func SupportsImages(cfg Config) bool {
+	return visionModel(cfg.Provider, cfg.Model)
+}
+
+// visionModel reports whether provider's model accepts images
+func visionModel(provider, model string) bool {
+	// Azure serves OpenAI's models
+	if provider == "azure" {
+		provider = "openai"
+	}
+	for _, prefix := range visionModels[provider] {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
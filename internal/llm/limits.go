@@ -0,0 +1,54 @@
+package llm
+
+import "strings"
+
+// ModelLimits is how much a model can take in and give back, in tokens. Zero means unknown.
+type ModelLimits struct {
+	ContextWindow int // Prompt and reply together
+	MaxOutput     int // Longest reply the model can produce
+}
+
+// knownLimits lists published limits. Dated, -latest and Ollama size-tagged variants match by
+// prefix, so "claude-3-5-sonnet-latest" and "llama3.2:1b" are found.
+var knownLimits = map[string]ModelLimits{
+	"gpt-4o":            {128000, 16384},
+	"gpt-4o-mini":       {128000, 16384},
+	"gpt-4.1":           {1047576, 32768},
+	"gpt-4.1-mini":      {1047576, 32768},
+	"gpt-4.1-nano":      {1047576, 32768},
+	"gpt-4-turbo":       {128000, 4096},
+	"gpt-4":             {8192, 8192},
+	"gpt-3.5-turbo":     {16385, 4096},
+	"o1":                {200000, 100000},
+	"o1-mini":           {128000, 65536},
+	"o3":                {200000, 100000},
+	"o3-mini":           {200000, 100000},
+	"o4-mini":           {200000, 100000},
+	"claude-opus-4":     {200000, 32000},
+	"claude-sonnet-4":   {200000, 64000},
+	"claude-3-7-sonnet": {200000, 64000},
+	"claude-3-5-sonnet": {200000, 8192},
+	"claude-3-5-haiku":  {200000, 8192},
+	"claude-3-opus":     {200000, 4096},
+	"claude-3-haiku":    {200000, 4096},
+	"llama3.1":          {131072, 0},
+	"llama3.2":          {131072, 0},
+}
+
+// LimitsFor looks up a model's limits: an exact match, else the longest known name the
+// model starts with. ok is false for models that aren't in the table.
+func LimitsFor(model string) (limits ModelLimits, ok bool) {
+	if limits, ok := knownLimits[model]; ok {
+		return limits, true
+	}
+	best := ""
+	for name := range knownLimits {
+		if (strings.HasPrefix(model, name+"-") || strings.HasPrefix(model, name+":")) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelLimits{}, false
+	}
+	return knownLimits[best], true
+}
@@ -2,11 +2,17 @@ package llm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cellwebb/clippy-go/internal/tools"
 )
@@ -20,11 +26,14 @@ type ToolCall struct {
 
 // Message represents a chat message
 type Message struct {
-	Role       string     `json:"role"`
-	Content    string     `json:"content"`
-	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
-	ToolCallID string     `json:"tool_call_id,omitempty"` // For tool responses
-	Usage      *Usage     `json:"usage,omitempty"`        // Token usage stats
+	Role       string      `json:"role"`
+	Content    string      `json:"content"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"` // For tool responses
+	Usage      *Usage      `json:"usage,omitempty"`        // Token usage stats
+	Example    bool        `json:"example,omitempty"`      // Few-shot example: sent to the model but not shown
+	Images     []ImageData `json:"images,omitempty"`       // Attached to a user message for vision models
+	Time       time.Time   `json:"time,omitzero"`          // When the message was added to the history (zero if unknown)
 }
 
 // Usage represents token usage statistics
@@ -32,30 +41,156 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	CachedTokens     int `json:"cached_tokens,omitempty"` // Part of PromptTokens read from the provider's prompt cache
+}
+
+// openAIUsage is the usage object of an OpenAI reply or final stream chunk
+type openAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+func (u openAIUsage) usage() *Usage {
+	return &Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+		CachedTokens:     u.PromptTokensDetails.CachedTokens,
+	}
+}
+
+// anthropicUsage is the usage object of an Anthropic reply or message_start event. Its
+// input_tokens leave out cache reads and writes, which are added back so PromptTokens means
+// the whole prompt, as it does for OpenAI.
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+func (u anthropicUsage) usage() *Usage {
+	prompt := u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	return &Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+	}
+}
+
+// StreamChunk is one piece of a streamed response. The final chunk has Done set and carries
+// the usage and the complete Message (including any tool calls), or Err if the stream failed.
+type StreamChunk struct {
+	Content string
+	Done    bool
+	Usage   *Usage
+
+	Message *Message
+	Err     error
 }
 
 // Provider defines the interface for an LLM provider
 type Provider interface {
-	Generate(messages []Message, tools []tools.Tool) (*Message, error)
+	Generate(ctx context.Context, messages []Message, tools []tools.Tool) (*Message, error)
+	GenerateStream(ctx context.Context, messages []Message, tools []tools.Tool) (<-chan StreamChunk, error)
 	UpdateConfig(cfg Config)
 	GetConfig() Config
 }
 
+// DefaultAnthropicVersion is the anthropic-version header sent when none is configured
+const DefaultAnthropicVersion = "2023-06-01"
+
+// DefaultAnthropicMaxTokens is the max_tokens sent to Anthropic, which requires one, when none is configured
+const DefaultAnthropicMaxTokens = 1024
+
 // Config holds configuration for LLM providers
 type Config struct {
 	APIKey   string
 	BaseURL  string
 	Model    string
-	Provider string // "openai" or "anthropic"
+	Provider string // "openai", "azure", "anthropic", or "ollama"
+
+	MaxTokens int // Response length limit (0 leaves it to the provider; Anthropic uses DefaultAnthropicMaxTokens)
+
+	Stop []string // Sequences that end the reply (OpenAI and Anthropic; empty sends none)
+
+	Seed *int // OpenAI only: sampling seed for reproducible replies (nil sends none)
+
+	Stream bool // Request server-sent event streams instead of a single JSON body
+
+	StrictTools bool // OpenAI only: send tools with strict: true so arguments always match the schema
+
+	ResponseFormat string // "json_object" (ResponseFormatJSON) forces a JSON reply; "" leaves the format free
+
+	AnthropicVersion string   // anthropic-version header (defaults to DefaultAnthropicVersion)
+	AnthropicBeta    []string // anthropic-beta feature flags, e.g. "prompt-caching-2024-07-31"
+
+	AzureEndpoint   string // Azure resource URL, e.g. https://my-resource.openai.azure.com (defaults to BaseURL)
+	AzureDeployment string // Azure deployment name (defaults to Model)
+	AzureAPIVersion string // Azure api-version query parameter (defaults to DefaultAzureAPIVersion)
+
+	// ExtraParams are added to the request body as-is, e.g. frequency_penalty or metadata.
+	// They never replace fields the provider sets itself, such as model or messages.
+	ExtraParams map[string]interface{}
+
+	MaxRetries int // Retries for 429 and 5xx replies (LoadConfigFromEnv defaults to DefaultMaxRetries)
+
+	// Headers are added to every API request, e.g. OpenAI-Organization or a gateway's auth
+	// header. They're set last, so they can replace the provider's own, such as Authorization.
+	Headers map[string]string
+
+	Transport http.RoundTripper // HTTP transport for API calls (nil uses the default), e.g. a Cassette
+
+	DebugLog string // File to append each request and raw response to, with credentials redacted ("" disables)
+
+	Profile string // Profile selected from the config file ("" when none is in use)
+}
+
+// DefaultModels is the model each provider uses when none is configured
+var DefaultModels = map[string]string{
+	"openai":    "gpt-4o-mini",
+	"anthropic": "claude-3-5-sonnet-latest",
+	"ollama":    "llama3.2",
 }
 
-// NewProvider creates a new LLM provider based on config
+// ErrNoModel means the config names no model and the provider has no default to fall back on
+var ErrNoModel = errors.New("no model configured")
+
+// Validate reports a config that can't make requests: an unknown provider, or no model to
+// send (Azure can name a deployment instead)
+func (c Config) Validate() error {
+	switch c.Provider {
+	case "openai", "azure", "anthropic", "ollama":
+	default:
+		return fmt.Errorf("unknown provider: %s", c.Provider)
+	}
+	if strings.TrimSpace(c.Model) == "" && (c.Provider != "azure" || c.AzureDeployment == "") {
+		return fmt.Errorf("%w for %s: set CLIPPY_MODEL", ErrNoModel, c.Provider)
+	}
+	return nil
+}
+
+// NewProvider creates a new LLM provider based on config, filling in the provider's
+// default model when none is set
 func NewProvider(cfg Config) (Provider, error) {
+	if strings.TrimSpace(cfg.Model) == "" {
+		cfg.Model = DefaultModels[cfg.Provider]
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	switch cfg.Provider {
-	case "openai":
+	case "openai", "azure":
 		return &OpenAIProvider{Config: cfg}, nil
 	case "anthropic":
 		return &AnthropicProvider{Config: cfg}, nil
+	case "ollama":
+		return &OllamaProvider{Config: cfg}, nil
 	default:
 		return nil, fmt.Errorf("unknown provider: %s", cfg.Provider)
 	}
@@ -74,19 +209,115 @@ func (p *OpenAIProvider) GetConfig() Config {
 	return p.Config
 }
 
-func (p *OpenAIProvider) Generate(messages []Message, availableTools []tools.Tool) (*Message, error) {
+func (p *OpenAIProvider) Generate(ctx context.Context, messages []Message, availableTools []tools.Tool) (*Message, error) {
+	req, err := p.newRequest(ctx, messages, availableTools, p.Config.Stream)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(req, p.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
+
+	if p.Config.Stream {
+		return readOpenAIStream(resp.Body)
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content   string `json:"content"`
+				ToolCalls []struct {
+					ID       string `json:"id"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage openAIUsage `json:"usage"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if len(result.Choices) == 0 {
+		return nil, fmt.Errorf("no response from API")
+	}
+
+	choice := result.Choices[0].Message
+	responseMsg := &Message{
+		Role:    "assistant",
+		Content: choice.Content,
+		Usage:   result.Usage.usage(),
+	}
+
+	if len(choice.ToolCalls) > 0 {
+		for _, tc := range choice.ToolCalls {
+			var args map[string]interface{}
+			json.Unmarshal([]byte(tc.Function.Arguments), &args)
+			dropNullArguments(args)
+			responseMsg.ToolCalls = append(responseMsg.ToolCalls, ToolCall{
+				ID:        tc.ID,
+				Name:      tc.Function.Name,
+				Arguments: args,
+			})
+		}
+	}
+
+	return responseMsg, nil
+}
+
+// GenerateStream sends a streaming request and emits content as it arrives
+func (p *OpenAIProvider) GenerateStream(ctx context.Context, messages []Message, availableTools []tools.Tool) (<-chan StreamChunk, error) {
+	req, err := p.newRequest(ctx, messages, availableTools, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(req, p.Config)
+	if err != nil {
+		return nil, err
+	}
+	acc := newStreamAccumulator()
+	return streamChunks(ctx, resp.Body, acc, acc.addOpenAIChunk), nil
+}
+
+// newRequest builds a chat completions request, optionally asking for an SSE stream
+func (p *OpenAIProvider) newRequest(ctx context.Context, messages []Message, availableTools []tools.Tool, stream bool) (*http.Request, error) {
 	url := p.Config.BaseURL + "/chat/completions"
 	if p.Config.BaseURL == "" {
 		url = "https://api.openai.com/v1/chat/completions"
 	}
+	azure := p.Config.Provider == "azure"
+	if azure {
+		var err error
+		if url, err = azureURL(p.Config); err != nil {
+			return nil, err
+		}
+	}
 
 	// Convert internal messages to OpenAI format
+	messages = withResponseFormat(messages, p.Config.ResponseFormat)
+	vision := visionModel("openai", p.Config.Model)
 	apiMessages := make([]map[string]interface{}, len(messages))
 	for i, msg := range messages {
 		m := map[string]interface{}{
 			"role":    msg.Role,
 			"content": msg.Content,
 		}
+		if len(msg.Images) > 0 && vision {
+			parts := []map[string]interface{}{{"type": "text", "text": msg.Content}}
+			for _, img := range msg.Images {
+				parts = append(parts, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]interface{}{"url": img.dataURL()},
+				})
+			}
+			m["content"] = parts
+		}
 		if len(msg.ToolCalls) > 0 {
 			toolCalls := make([]map[string]interface{}, len(msg.ToolCalls))
 			for j, tc := range msg.ToolCalls {
@@ -114,13 +345,18 @@ func (p *OpenAIProvider) Generate(messages []Message, availableTools []tools.Too
 		apiTools = make([]map[string]interface{}, len(availableTools))
 		for i, t := range availableTools {
 			def := t.Definition()
+			function := map[string]interface{}{
+				"name":        def.Name,
+				"description": def.Description,
+				"parameters":  def.Parameters,
+			}
+			if p.Config.StrictTools {
+				function["parameters"] = strictSchema(def.Parameters)
+				function["strict"] = true
+			}
 			apiTools[i] = map[string]interface{}{
-				"type": "function",
-				"function": map[string]interface{}{
-					"name":        def.Name,
-					"description": def.Description,
-					"parameters":  def.Parameters,
-				},
+				"type":     "function",
+				"function": function,
 			}
 		}
 	}
@@ -132,79 +368,104 @@ func (p *OpenAIProvider) Generate(messages []Message, availableTools []tools.Too
 	if len(apiTools) > 0 {
 		reqBody["tools"] = apiTools
 	}
+	if p.Config.MaxTokens > 0 {
+		reqBody["max_tokens"] = p.Config.MaxTokens
+	}
+	if len(p.Config.Stop) > 0 {
+		reqBody["stop"] = p.Config.Stop
+	}
+	if p.Config.Seed != nil {
+		reqBody["seed"] = *p.Config.Seed
+	}
+	if stream {
+		reqBody["stream"] = true
+		reqBody["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	if p.Config.ResponseFormat != "" {
+		reqBody["response_format"] = map[string]interface{}{"type": p.Config.ResponseFormat}
+	}
+	mergeExtraParams(reqBody, p.Config.ExtraParams)
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.Config.APIKey)
+	if azure {
+		req.Header.Set("api-key", p.Config.APIKey)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+p.Config.APIKey)
+	}
+	setHeaders(req, p.Config.Headers)
+	return req, nil
+}
+
+// AnthropicProvider implements Provider for Anthropic APIs
+type AnthropicProvider struct {
+	Config Config
+}
+
+func (p *AnthropicProvider) UpdateConfig(cfg Config) {
+	p.Config = cfg
+}
+
+func (p *AnthropicProvider) GetConfig() Config {
+	return p.Config
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func (p *AnthropicProvider) Generate(ctx context.Context, messages []Message, availableTools []tools.Tool) (*Message, error) {
+	req, err := p.newRequest(ctx, messages, availableTools, p.Config.Stream)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	resp, err := send(req, p.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+	if p.Config.Stream {
+		return readAnthropicStream(resp.Body)
 	}
 
 	var result struct {
-		Choices []struct {
-			Message struct {
-				Content   string `json:"content"`
-				ToolCalls []struct {
-					ID       string `json:"id"`
-					Function struct {
-						Name      string `json:"name"`
-						Arguments string `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls"`
-			} `json:"message"`
-		} `json:"choices"`
-		Usage struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		} `json:"usage"`
+		Content []struct {
+			Type  string                 `json:"type"`
+			Text  string                 `json:"text"`
+			ID    string                 `json:"id"`
+			Name  string                 `json:"name"`
+			Input map[string]interface{} `json:"input"`
+		} `json:"content"`
+		Usage anthropicUsage `json:"usage"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
 
-	if len(result.Choices) == 0 {
+	if len(result.Content) == 0 {
 		return nil, fmt.Errorf("no response from API")
 	}
 
-	choice := result.Choices[0].Message
 	responseMsg := &Message{
-		Role:    "assistant",
-		Content: choice.Content,
-		Usage: &Usage{
-			PromptTokens:     result.Usage.PromptTokens,
-			CompletionTokens: result.Usage.CompletionTokens,
-			TotalTokens:      result.Usage.TotalTokens,
-		},
+		Role:  "assistant",
+		Usage: result.Usage.usage(),
 	}
 
-	if len(choice.ToolCalls) > 0 {
-		for _, tc := range choice.ToolCalls {
-			var args map[string]interface{}
-			json.Unmarshal([]byte(tc.Function.Arguments), &args)
+	for _, c := range result.Content {
+		if c.Type == "text" {
+			responseMsg.Content += c.Text
+		} else if c.Type == "tool_use" {
 			responseMsg.ToolCalls = append(responseMsg.ToolCalls, ToolCall{
-				ID:        tc.ID,
-				Name:      tc.Function.Name,
-				Arguments: args,
+				ID:        c.ID,
+				Name:      c.Name,
+				Arguments: c.Input,
 			})
 		}
 	}
@@ -212,89 +473,31 @@ func (p *OpenAIProvider) Generate(messages []Message, availableTools []tools.Too
 	return responseMsg, nil
 }
 
-// AnthropicProvider implements Provider for Anthropic APIs
-type AnthropicProvider struct {
-	Config Config
-}
-
-func (p *AnthropicProvider) UpdateConfig(cfg Config) {
-	p.Config = cfg
-}
-
-func (p *AnthropicProvider) GetConfig() Config {
-	return p.Config
+// GenerateStream sends a streaming request and emits content as it arrives
+func (p *AnthropicProvider) GenerateStream(ctx context.Context, messages []Message, availableTools []tools.Tool) (<-chan StreamChunk, error) {
+	req, err := p.newRequest(ctx, messages, availableTools, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(req, p.Config)
+	if err != nil {
+		return nil, err
+	}
+	acc := newStreamAccumulator()
+	return streamChunks(ctx, resp.Body, acc, acc.addAnthropicEvent), nil
 }
 
-func (p *AnthropicProvider) Generate(messages []Message, availableTools []tools.Tool) (*Message, error) {
+// newRequest builds a Messages API request, optionally asking for an SSE stream
+func (p *AnthropicProvider) newRequest(ctx context.Context, messages []Message, availableTools []tools.Tool, stream bool) (*http.Request, error) {
 	url := p.Config.BaseURL + "/v1/messages"
 	if p.Config.BaseURL == "" {
 		url = "https://api.anthropic.com/v1/messages"
 	}
 
 	// Convert internal messages to Anthropic format
-	var systemPrompt string
-	var apiMessages []map[string]interface{}
-
-	for i := 0; i < len(messages); i++ {
-		msg := messages[i]
-
-		if msg.Role == "system" {
-			systemPrompt = msg.Content
-			continue
-		}
-
-		// Handle tool results (Role: "tool")
-		// Anthropic expects tool results to be in a "user" message.
-		// If there are multiple consecutive tool results, they must be in a single user message.
-		if msg.Role == "tool" {
-			content := []map[string]interface{}{}
-
-			// Collect this and subsequent tool messages
-			for i < len(messages) && messages[i].Role == "tool" {
-				toolMsg := messages[i]
-				content = append(content, map[string]interface{}{
-					"type":        "tool_result",
-					"tool_use_id": toolMsg.ToolCallID,
-					"content":     toolMsg.Content,
-				})
-				i++
-			}
-			i-- // Decrement because the outer loop will increment
-
-			apiMessages = append(apiMessages, map[string]interface{}{
-				"role":    "user",
-				"content": content,
-			})
-			continue
-		}
-
-		m := map[string]interface{}{
-			"role": msg.Role,
-		}
-
-		if len(msg.ToolCalls) > 0 {
-			content := []map[string]interface{}{}
-			if msg.Content != "" {
-				content = append(content, map[string]interface{}{
-					"type": "text",
-					"text": msg.Content,
-				})
-			}
-			for _, tc := range msg.ToolCalls {
-				content = append(content, map[string]interface{}{
-					"type":  "tool_use",
-					"id":    tc.ID,
-					"name":  tc.Name,
-					"input": tc.Arguments,
-				})
-			}
-			m["content"] = content
-		} else {
-			m["content"] = msg.Content
-		}
-
-		apiMessages = append(apiMessages, m)
-	}
+	// Anthropic has no JSON mode, so a response format is only an instruction
+	messages = withResponseFormat(messages, p.Config.ResponseFormat)
+	systemPrompt, apiMessages := anthropicMessages(messages, visionModel("anthropic", p.Config.Model))
 
 	// Convert tools to Anthropic format
 	var apiTools []map[string]interface{}
@@ -310,98 +513,316 @@ func (p *AnthropicProvider) Generate(messages []Message, availableTools []tools.
 		}
 	}
 
+	maxTokens := p.Config.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = DefaultAnthropicMaxTokens
+	}
 	reqBody := map[string]interface{}{
 		"model":      p.Config.Model,
-		"max_tokens": 1024,
+		"max_tokens": maxTokens,
 		"messages":   apiMessages,
 	}
 	if systemPrompt != "" {
 		reqBody["system"] = systemPrompt
 	}
+	if len(p.Config.Stop) > 0 {
+		reqBody["stop_sequences"] = p.Config.Stop
+	}
 	if len(apiTools) > 0 {
 		reqBody["tools"] = apiTools
 	}
+	if stream {
+		reqBody["stream"] = true
+	}
+	mergeExtraParams(reqBody, p.Config.ExtraParams)
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", p.Config.APIKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+	version := p.Config.AnthropicVersion
+	if version == "" {
+		version = DefaultAnthropicVersion
+	}
+	req.Header.Set("anthropic-version", version)
+	if len(p.Config.AnthropicBeta) > 0 {
+		req.Header.Set("anthropic-beta", strings.Join(p.Config.AnthropicBeta, ","))
+	}
+	setHeaders(req, p.Config.Headers)
+	return req, nil
+}
+
+// mergeExtraParams copies extra into the request body, skipping keys that are already set
+func mergeExtraParams(reqBody map[string]interface{}, extra map[string]interface{}) {
+	for key, value := range extra {
+		if _, exists := reqBody[key]; !exists {
+			reqBody[key] = value
+		}
+	}
+}
+
+// anthropicMessages converts history into Messages API format, returning the system prompt
+// separately. Anthropic has no "tool" role: tool results become tool_result blocks in a user
+// turn, and adjacent user turns are merged into one so roles keep alternating. Attached
+// images become image blocks ahead of the text when vision is set, and are dropped otherwise.
+func anthropicMessages(messages []Message, vision bool) (string, []map[string]interface{}) {
+	var systemPrompt string
+	var apiMessages []map[string]interface{}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	for _, msg := range messages {
+		var role string
+		var content interface{}
+
+		switch {
+		case msg.Role == "system":
+			// Later system messages, such as summaries of earlier turns, add to the prompt
+			if systemPrompt != "" {
+				systemPrompt += "\n\n"
+			}
+			systemPrompt += msg.Content
+			continue
+		case msg.Role == "tool":
+			role = "user"
+			content = []map[string]interface{}{{
+				"type":        "tool_result",
+				"tool_use_id": msg.ToolCallID,
+				"content":     msg.Content,
+			}}
+		case len(msg.ToolCalls) > 0:
+			role = msg.Role
+			blocks := []map[string]interface{}{}
+			if msg.Content != "" {
+				blocks = append(blocks, map[string]interface{}{
+					"type": "text",
+					"text": msg.Content,
+				})
+			}
+			for _, tc := range msg.ToolCalls {
+				blocks = append(blocks, map[string]interface{}{
+					"type":  "tool_use",
+					"id":    tc.ID,
+					"name":  tc.Name,
+					"input": tc.Arguments,
+				})
+			}
+			content = blocks
+		case len(msg.Images) > 0 && vision:
+			role = msg.Role
+			blocks := []map[string]interface{}{}
+			for _, img := range msg.Images {
+				blocks = append(blocks, map[string]interface{}{
+					"type": "image",
+					"source": map[string]interface{}{
+						"type":       "base64",
+						"media_type": img.MediaType,
+						"data":       img.Data,
+					},
+				})
+			}
+			content = append(blocks, contentBlocks(msg.Content)...)
+		default:
+			role = msg.Role
+			content = msg.Content
+		}
+
+		if n := len(apiMessages); n > 0 && role == "user" && apiMessages[n-1]["role"] == "user" {
+			last := apiMessages[n-1]
+			last["content"] = append(contentBlocks(last["content"]), contentBlocks(content)...)
+			continue
+		}
+		apiMessages = append(apiMessages, map[string]interface{}{
+			"role":    role,
+			"content": content,
+		})
+	}
+	return systemPrompt, apiMessages
+}
+
+// contentBlocks returns message content as a list of blocks, wrapping plain text
+func contentBlocks(content interface{}) []map[string]interface{} {
+	switch c := content.(type) {
+	case []map[string]interface{}:
+		return c
+	case string:
+		if c == "" {
+			return nil
+		}
+		return []map[string]interface{}{{"type": "text", "text": c}}
+	}
+	return nil
+}
+
+// send performs the request, turning non-200 replies into errors; the caller closes the body.
+// Transient errors (429, 500, 502, 503) are retried up to cfg.MaxRetries times with backoff,
+// and cancelling the request's context stops the wait between attempts.
+func send(req *http.Request, cfg Config) (*http.Response, error) {
+	client, err := clientFor(cfg)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, classifyNetworkError(err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %s - %s", resp.Status, string(body))
+		resp.Body.Close()
+		apiErr := newAPIError(resp, body)
+
+		if attempt >= cfg.MaxRetries || !retryableStatus(resp.StatusCode) || req.GetBody == nil {
+			return nil, apiErr
+		}
+		if err := sleepContext(req.Context(), retryDelay(attempt, resp.Header.Get("Retry-After"), time.Now())); err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
 	}
+}
 
-	var result struct {
-		Content []struct {
-			Type  string                 `json:"type"`
-			Text  string                 `json:"text"`
-			ID    string                 `json:"id"`
-			Name  string                 `json:"name"`
-			Input map[string]interface{} `json:"input"`
-		} `json:"content"`
-		Usage struct {
-			InputTokens  int `json:"input_tokens"`
-			OutputTokens int `json:"output_tokens"`
-		} `json:"usage"`
+// LoadConfigFromEnv loads config from environment variables, using the provider's
+// default model when CLIPPY_MODEL is unset. Values that don't parse are left out;
+// LoadConfigFromFile reports them.
+func LoadConfigFromEnv() Config {
+	cfg := Config{MaxRetries: DefaultMaxRetries}
+	applyEnv(&cfg)
+	if cfg.Model == "" {
+		cfg.Model = DefaultModels[cfg.Provider]
 	}
+	return cfg
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+// applyEnv overrides cfg with each CLIPPY_* variable that is set. Numbers that don't parse
+// are ignored; an invalid CLIPPY_EXTRA_PARAMS is returned as an error, since dropping the
+// fields it meant to send would change requests without a word.
+func applyEnv(cfg *Config) error {
+	setString := func(dst *string, key string) {
+		if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+			*dst = value
+		}
 	}
+	setString(&cfg.Provider, "CLIPPY_PROVIDER")
+	setString(&cfg.Model, "CLIPPY_MODEL")
+	setString(&cfg.APIKey, "CLIPPY_API_KEY")
+	setString(&cfg.BaseURL, "CLIPPY_BASE_URL")
+	setString(&cfg.AnthropicVersion, "CLIPPY_ANTHROPIC_VERSION")
+	setString(&cfg.AzureEndpoint, "CLIPPY_AZURE_ENDPOINT")
+	setString(&cfg.AzureDeployment, "CLIPPY_AZURE_DEPLOYMENT")
+	setString(&cfg.AzureAPIVersion, "CLIPPY_AZURE_API_VERSION")
 
-	if len(result.Content) == 0 {
-		return nil, fmt.Errorf("no response from API")
+	if n := parseInt(os.Getenv("CLIPPY_MAX_TOKENS")); n > 0 {
+		cfg.MaxTokens = n
 	}
+	if stop := splitList(os.Getenv("CLIPPY_STOP")); len(stop) > 0 {
+		cfg.Stop = stop
+	}
+	if seed := parseSeed(os.Getenv("CLIPPY_SEED")); seed != nil {
+		cfg.Seed = seed
+	}
+	if value := os.Getenv("CLIPPY_STREAM"); value != "" {
+		cfg.Stream = value == "1"
+	}
+	if value := os.Getenv("CLIPPY_STRICT_TOOLS"); value != "" {
+		cfg.StrictTools = value == "1"
+	}
+	if beta := splitList(os.Getenv("CLIPPY_ANTHROPIC_BETA")); len(beta) > 0 {
+		cfg.AnthropicBeta = beta
+	}
+	params, err := parseExtraParams(os.Getenv("CLIPPY_EXTRA_PARAMS"))
+	if params != nil {
+		cfg.ExtraParams = params
+	}
+	if headers := parseHeaders(os.Getenv("CLIPPY_HEADERS")); headers != nil {
+		cfg.Headers = headers
+	}
+	cfg.MaxRetries = maxRetriesFromEnv(cfg.MaxRetries)
+	cfg.DebugLog = debugLogFromEnv()
+	return err
+}
 
-	responseMsg := &Message{
-		Role: "assistant",
-		Usage: &Usage{
-			PromptTokens:     result.Usage.InputTokens,
-			CompletionTokens: result.Usage.OutputTokens,
-			TotalTokens:      result.Usage.InputTokens + result.Usage.OutputTokens,
-		},
+// debugLogFromEnv returns the debug log path when CLIPPY_DEBUG=1, or "" when debugging is off
+func debugLogFromEnv() string {
+	if os.Getenv("CLIPPY_DEBUG") != "1" {
+		return ""
+	}
+	return DefaultDebugLogPath()
+}
+
+// parseExtraParams decodes CLIPPY_EXTRA_PARAMS, a JSON object of extra body fields
+func parseExtraParams(value string) (map[string]interface{}, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &params); err != nil {
+		return nil, fmt.Errorf("invalid CLIPPY_EXTRA_PARAMS %q: expected a JSON object like {\"user\": \"clippy\"} (%v)", value, err)
 	}
+	return params, nil
+}
 
-	for _, c := range result.Content {
-		if c.Type == "text" {
-			responseMsg.Content += c.Text
-		} else if c.Type == "tool_use" {
-			responseMsg.ToolCalls = append(responseMsg.ToolCalls, ToolCall{
-				ID:        c.ID,
-				Name:      c.Name,
-				Arguments: c.Input,
-			})
+// parseHeaders decodes comma-separated key=value pairs, skipping entries without a key
+func parseHeaders(value string) map[string]string {
+	var headers map[string]string
+	for _, pair := range splitList(value) {
+		key, val, _ := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); key == "" {
+			continue
 		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[key] = strings.TrimSpace(val)
 	}
+	return headers
+}
 
-	return responseMsg, nil
+// setHeaders adds the configured custom headers to req
+func setHeaders(req *http.Request, headers map[string]string) {
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
 }
 
-// LoadConfigFromEnv loads config from environment variables
-func LoadConfigFromEnv() Config {
-	return Config{
-		APIKey:   os.Getenv("CLIPPY_API_KEY"),
-		BaseURL:  os.Getenv("CLIPPY_BASE_URL"),
-		Model:    os.Getenv("CLIPPY_MODEL"),
-		Provider: os.Getenv("CLIPPY_PROVIDER"),
+// parseInt reads an integer env value, treating invalid values as unset
+func parseInt(value string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// parseSeed reads CLIPPY_SEED, returning nil when it's unset or not an integer
+func parseSeed(value string) *int {
+	seed, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return nil
 	}
+	return &seed
+}
+
+// splitList splits a comma-separated env value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 // ModelsDevResponse represents the response from models.dev
@@ -413,20 +834,47 @@ type ModelsDevResponse []struct {
 	OwnedBy     string `json:"owned_by"`
 }
 
-// FetchModels retrieves the list of available models from models.dev
-func FetchModels() ([]string, error) {
-	resp, err := http.Get("https://models.dev/api/models")
+// Limits for fetching the model list, so a slow or huge response can't hang /model
+const (
+	modelsFetchTimeout = 10 * time.Second
+	maxModelsBodyBytes = 5 << 20
+	modelsDevModelsURL = "https://models.dev/api/models"
+)
+
+// fetchModels gets the models.dev catalog from url, giving up after timeout
+func fetchModels(url string, timeout time.Duration) ([]string, error) {
+	shared, err := HTTPClient()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	client := *shared
+	client.Timeout = timeout
+	resp, err := client.Get(url)
+	if err != nil {
+		if isTimeout(err) {
+			return nil, fmt.Errorf("timed out fetching models after %s", timeout)
+		}
+		return nil, err
+	}
+	defer closeBody(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to fetch models: %s", resp.Status)
 	}
 
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxModelsBodyBytes+1))
+	if err != nil {
+		if isTimeout(err) {
+			return nil, fmt.Errorf("timed out fetching models after %s", timeout)
+		}
+		return nil, err
+	}
+	if len(body) > maxModelsBodyBytes {
+		return nil, fmt.Errorf("models response is larger than %d bytes", maxModelsBodyBytes)
+	}
+
 	var modelsResp ModelsDevResponse
-	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+	if err := json.Unmarshal(body, &modelsResp); err != nil {
 		return nil, err
 	}
 
@@ -437,3 +885,9 @@ func FetchModels() ([]string, error) {
 
 	return models, nil
 }
+
+// isTimeout reports whether err came from a request exceeding its deadline
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -1,11 +1,25 @@
 package llm
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/cellwebb/clippy-go/internal/tools"
 )
@@ -70,7 +84,7 @@ func TestOpenAIProvider_Generate_MultipleToolCalls(t *testing.T) {
 		},
 	}
 
-	_, err := provider.Generate(history, []tools.Tool{})
+	_, err := provider.Generate(context.Background(), history, []tools.Tool{})
 	if err != nil {
 		t.Fatalf("Generate failed: %v", err)
 	}
@@ -179,25 +193,1521 @@ func TestAnthropicProvider_Generate_MultipleToolCalls(t *testing.T) {
 		},
 	}
 
-	_, err := provider.Generate(history, []tools.Tool{})
+	_, err := provider.Generate(context.Background(), history, []tools.Tool{})
 	if err != nil {
 		t.Fatalf("Generate failed: %v", err)
 	}
 
-	// Verify request structure
+	// Verify request structure: Anthropic expects both tool results in ONE user message
 	messages := capturedRequest["messages"].([]interface{})
+	if len(messages) != 3 { // User, Assistant, User (with 2 results)
+		t.Fatalf("Expected 3 messages, got %d: %+v", len(messages), messages)
+	}
+	assertRoles(t, messages, "user", "assistant", "user")
+	results := messages[2].(map[string]interface{})["content"].([]interface{})
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 tool_result blocks, got %+v", results)
+	}
+	for i, id := range []string{"call_1", "call_2"} {
+		block := results[i].(map[string]interface{})
+		if block["type"] != "tool_result" || block["tool_use_id"] != id {
+			t.Errorf("Expected tool_result for %s, got %+v", id, block)
+		}
+	}
+}
+
+// anthropicRequestMessages sends history through the Anthropic provider and returns the request's messages
+func anthropicRequestMessages(t *testing.T, history []Message) []interface{} {
+	t.Helper()
+	var capturedRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&capturedRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []interface{}{
+				map[string]interface{}{"type": "text", "text": "Hello"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	provider := &AnthropicProvider{Config: Config{BaseURL: server.URL, APIKey: "test-key", Model: "test-model"}}
+	if _, err := provider.Generate(context.Background(), history, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	return capturedRequest["messages"].([]interface{})
+}
 
-	// Anthropic expects tool results to be in a USER message
-	// And if there are multiple results, they should be in ONE user message with multiple content blocks
+// assertRoles checks the roles of the request messages, which must never include "tool"
+func assertRoles(t *testing.T, messages []interface{}, roles ...string) {
+	t.Helper()
+	var got []string
+	for _, m := range messages {
+		got = append(got, m.(map[string]interface{})["role"].(string))
+	}
+	if strings.Join(got, ",") != strings.Join(roles, ",") {
+		t.Errorf("Expected roles %v, got %v", roles, got)
+	}
+}
 
-	// Currently, the implementation sends separate messages with role "tool" (which is invalid)
-	// So we expect this test to reveal the bug (or show what it currently does)
+func TestAnthropicProvider_Generate_LoneToolResult(t *testing.T) {
+	messages := anthropicRequestMessages(t, []Message{
+		{Role: "system", Content: "You are Clippy"},
+		{Role: "user", Content: "Read it"},
+		{Role: "assistant", Content: "Reading", ToolCalls: []ToolCall{{ID: "call_1", Name: "read_file", Arguments: map[string]interface{}{"path": "a.txt"}}}},
+		{Role: "tool", Content: "contents", ToolCallID: "call_1"},
+		{Role: "assistant", Content: "It says contents"},
+	})
 
-	if len(messages) != 3 { // User, Assistant, User (with 2 results)
-		t.Logf("Got %d messages", len(messages))
-		for i, m := range messages {
-			t.Logf("Message %d: %+v", i, m)
+	assertRoles(t, messages, "user", "assistant", "user", "assistant")
+	blocks := messages[2].(map[string]interface{})["content"].([]interface{})
+	if len(blocks) != 1 || blocks[0].(map[string]interface{})["tool_use_id"] != "call_1" {
+		t.Errorf("Expected a single tool_result for call_1, got %+v", blocks)
+	}
+}
+
+func TestAnthropicProvider_Generate_ToolResultThenUserTurn(t *testing.T) {
+	messages := anthropicRequestMessages(t, []Message{
+		{Role: "user", Content: "List files"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Name: "list_directory", Arguments: map[string]interface{}{"path": "."}}}},
+		{Role: "tool", Content: "main.go", ToolCallID: "call_1"},
+		{Role: "user", Content: "Never mind, what time is it?"},
+	})
+
+	// The tool result and the new user text share one user turn
+	assertRoles(t, messages, "user", "assistant", "user")
+	blocks := messages[2].(map[string]interface{})["content"].([]interface{})
+	if len(blocks) != 2 {
+		t.Fatalf("Expected tool_result and text blocks, got %+v", blocks)
+	}
+	if blocks[0].(map[string]interface{})["type"] != "tool_result" {
+		t.Errorf("Expected the tool_result first, got %+v", blocks[0])
+	}
+	if text := blocks[1].(map[string]interface{}); text["type"] != "text" || text["text"] != "Never mind, what time is it?" {
+		t.Errorf("Expected the user's text after the tool result, got %+v", text)
+	}
+}
+
+func TestAnthropicProvider_Generate_VersionHeaders(t *testing.T) {
+	var capturedHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedHeaders = r.Header.Clone()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []interface{}{
+				map[string]interface{}{"type": "text", "text": "Hello"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	provider := &AnthropicProvider{
+		Config: Config{
+			BaseURL: server.URL,
+			APIKey:  "test-key",
+			Model:   "test-model",
+		},
+	}
+
+	if _, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if got := capturedHeaders.Get("anthropic-version"); got != DefaultAnthropicVersion {
+		t.Errorf("Expected default anthropic-version %q, got %q", DefaultAnthropicVersion, got)
+	}
+	if got := capturedHeaders.Get("anthropic-beta"); got != "" {
+		t.Errorf("Expected no anthropic-beta header by default, got %q", got)
+	}
+
+	provider.Config.AnthropicVersion = "2099-01-01"
+	provider.Config.AnthropicBeta = []string{"prompt-caching-2024-07-31", "output-128k-2025-02-19"}
+	if _, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if got := capturedHeaders.Get("anthropic-version"); got != "2099-01-01" {
+		t.Errorf("Expected configured anthropic-version, got %q", got)
+	}
+	if got := capturedHeaders.Get("anthropic-beta"); got != "prompt-caching-2024-07-31,output-128k-2025-02-19" {
+		t.Errorf("Expected configured anthropic-beta flags, got %q", got)
+	}
+}
+
+// sseServer returns a server that replies with each event as a server-sent "data:" line
+func sseServer(t *testing.T, capturedRequest *map[string]interface{}, events []string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, capturedRequest)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+}
+
+func TestOpenAIProvider_Generate_StreamedToolCall(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := sseServer(t, &capturedRequest, []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Let me look. "}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":""}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"pa"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\": \"main"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"list_directory","arguments":"{\"path\""}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":".go\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":": \".\"}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+		`[DONE]`,
+	})
+	defer server.Close()
+
+	provider := &OpenAIProvider{
+		Config: Config{BaseURL: server.URL, APIKey: "test-key", Model: "test-model", Stream: true},
+	}
+
+	msg, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "read main.go"}}, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if capturedRequest["stream"] != true {
+		t.Errorf("Expected stream: true in request, got %v", capturedRequest["stream"])
+	}
+	if msg.Content != "Let me look. " {
+		t.Errorf("Expected streamed content, got %q", msg.Content)
+	}
+	if len(msg.ToolCalls) != 2 {
+		t.Fatalf("Expected 2 reassembled tool calls, got %d", len(msg.ToolCalls))
+	}
+	if msg.ToolCalls[0].ID != "call_1" || msg.ToolCalls[0].Name != "read_file" || msg.ToolCalls[0].Arguments["path"] != "main.go" {
+		t.Errorf("Tool call 0 reassembled incorrectly: %+v", msg.ToolCalls[0])
+	}
+	if msg.ToolCalls[1].ID != "call_2" || msg.ToolCalls[1].Name != "list_directory" || msg.ToolCalls[1].Arguments["path"] != "." {
+		t.Errorf("Tool call 1 reassembled incorrectly: %+v", msg.ToolCalls[1])
+	}
+	if msg.Usage == nil || msg.Usage.TotalTokens != 15 {
+		t.Errorf("Expected usage total 15, got %+v", msg.Usage)
+	}
+}
+
+func TestAnthropicProvider_Generate_StreamedToolCall(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := sseServer(t, &capturedRequest, []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Reading"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" now"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"read_file","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"path\": \"ma"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"in.go\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":8}}`,
+		`{"type":"message_stop"}`,
+	})
+	defer server.Close()
+
+	provider := &AnthropicProvider{
+		Config: Config{BaseURL: server.URL, APIKey: "test-key", Model: "test-model", Stream: true},
+	}
+
+	msg, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "read main.go"}}, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if capturedRequest["stream"] != true {
+		t.Errorf("Expected stream: true in request, got %v", capturedRequest["stream"])
+	}
+	if msg.Content != "Reading now" {
+		t.Errorf("Expected streamed content, got %q", msg.Content)
+	}
+	if len(msg.ToolCalls) != 1 {
+		t.Fatalf("Expected 1 reassembled tool call, got %d", len(msg.ToolCalls))
+	}
+	if msg.ToolCalls[0].ID != "toolu_1" || msg.ToolCalls[0].Name != "read_file" || msg.ToolCalls[0].Arguments["path"] != "main.go" {
+		t.Errorf("Tool call reassembled incorrectly: %+v", msg.ToolCalls[0])
+	}
+	if msg.Usage == nil || msg.Usage.PromptTokens != 12 || msg.Usage.CompletionTokens != 8 || msg.Usage.TotalTokens != 20 {
+		t.Errorf("Expected usage 12/8/20, got %+v", msg.Usage)
+	}
+}
+
+// collectStream drains a stream, returning the content chunks and the final chunk
+func collectStream(t *testing.T, chunks <-chan StreamChunk) ([]string, StreamChunk) {
+	t.Helper()
+	var parts []string
+	var final StreamChunk
+	for chunk := range chunks {
+		if chunk.Done {
+			final = chunk
+			continue
+		}
+		parts = append(parts, chunk.Content)
+	}
+	if !final.Done {
+		t.Fatal("Stream closed without a Done chunk")
+	}
+	return parts, final
+}
+
+func TestOpenAIProvider_GenerateStream(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := sseServer(t, &capturedRequest, []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":", world"}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":4,"completion_tokens":3,"total_tokens":7}}`,
+		`[DONE]`,
+	})
+	defer server.Close()
+
+	// Streams regardless of Config.Stream
+	provider := &OpenAIProvider{Config: Config{BaseURL: server.URL, APIKey: "test-key", Model: "test-model"}}
+
+	chunks, err := provider.GenerateStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	parts, final := collectStream(t, chunks)
+
+	if capturedRequest["stream"] != true {
+		t.Errorf("Expected stream: true in request, got %v", capturedRequest["stream"])
+	}
+	if strings.Join(parts, "|") != "Hello|, world" {
+		t.Errorf("Expected chunks [Hello, world], got %q", parts)
+	}
+	if final.Err != nil {
+		t.Fatalf("Unexpected stream error: %v", final.Err)
+	}
+	if final.Usage == nil || final.Usage.TotalTokens != 7 {
+		t.Errorf("Expected 7 total tokens on the final chunk, got %+v", final.Usage)
+	}
+	if final.Message == nil || final.Message.Content != "Hello, world" {
+		t.Errorf("Expected final message content 'Hello, world', got %+v", final.Message)
+	}
+}
+
+func TestAnthropicProvider_GenerateStream(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := sseServer(t, &capturedRequest, []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":5,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}`,
+		`{"type":"message_stop"}`,
+	})
+	defer server.Close()
+
+	provider := &AnthropicProvider{Config: Config{BaseURL: server.URL, APIKey: "test-key", Model: "test-model"}}
+
+	chunks, err := provider.GenerateStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	parts, final := collectStream(t, chunks)
+
+	if strings.Join(parts, "|") != "Hi| there" {
+		t.Errorf("Expected chunks [Hi, there], got %q", parts)
+	}
+	if final.Usage == nil || final.Usage.PromptTokens != 5 || final.Usage.CompletionTokens != 2 {
+		t.Errorf("Expected 5 prompt and 2 completion tokens, got %+v", final.Usage)
+	}
+}
+
+func TestGenerateStream_ReportsStreamErrors(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := sseServer(t, &capturedRequest, []string{
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"partial"}}`,
+		`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	})
+	defer server.Close()
+
+	provider := &AnthropicProvider{Config: Config{BaseURL: server.URL, APIKey: "test-key", Model: "test-model"}}
+
+	chunks, err := provider.GenerateStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	_, final := collectStream(t, chunks)
+	if final.Err == nil || !strings.Contains(final.Err.Error(), "Overloaded") {
+		t.Errorf("Expected the stream error on the final chunk, got %v", final.Err)
+	}
+}
+
+func TestGenerate_ExtraParams(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&capturedRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{
+				map[string]interface{}{"message": map[string]interface{}{"content": "Hello"}},
+			},
+		})
+	}))
+	defer openai.Close()
+
+	extra := map[string]interface{}{
+		"frequency_penalty": 0.5,
+		"metadata":          map[string]interface{}{"session": "abc"},
+		"model":             "sneaky-model",
+		"messages":          "clobbered",
+	}
+	provider := &OpenAIProvider{
+		Config: Config{BaseURL: openai.URL, APIKey: "test-key", Model: "test-model", ExtraParams: extra},
+	}
+
+	if _, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if capturedRequest["frequency_penalty"] != 0.5 {
+		t.Errorf("Expected frequency_penalty in request, got %v", capturedRequest["frequency_penalty"])
+	}
+	if metadata, ok := capturedRequest["metadata"].(map[string]interface{}); !ok || metadata["session"] != "abc" {
+		t.Errorf("Expected metadata in request, got %v", capturedRequest["metadata"])
+	}
+	if capturedRequest["model"] != "test-model" {
+		t.Errorf("Extra params must not override model, got %v", capturedRequest["model"])
+	}
+	if _, ok := capturedRequest["messages"].([]interface{}); !ok {
+		t.Errorf("Extra params must not override messages, got %v", capturedRequest["messages"])
+	}
+
+	anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&capturedRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []interface{}{
+				map[string]interface{}{"type": "text", "text": "Hello"},
+			},
+		})
+	}))
+	defer anthropic.Close()
+
+	capturedRequest = nil
+	anthropicProvider := &AnthropicProvider{
+		Config: Config{BaseURL: anthropic.URL, APIKey: "test-key", Model: "test-model", ExtraParams: map[string]interface{}{"top_k": 5, "max_tokens": 1}},
+	}
+	if _, err := anthropicProvider.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if capturedRequest["top_k"] != float64(5) {
+		t.Errorf("Expected top_k in request, got %v", capturedRequest["top_k"])
+	}
+	if capturedRequest["max_tokens"] != float64(1024) {
+		t.Errorf("Extra params must not override max_tokens, got %v", capturedRequest["max_tokens"])
+	}
+}
+
+func TestParseExtraParams(t *testing.T) {
+	params, err := parseExtraParams(`{"user": "clippy", "presence_penalty": 0.2}`)
+	if err != nil || params["user"] != "clippy" || params["presence_penalty"] != 0.2 {
+		t.Errorf("Unexpected params: %v (err: %v)", params, err)
+	}
+	if params, err := parseExtraParams("not json"); params != nil || err == nil {
+		t.Errorf("Expected invalid JSON to be an error, got %v", params)
+	}
+	if params, err := parseExtraParams(""); params != nil || err != nil {
+		t.Errorf("Expected no params for an empty value, got %v (err: %v)", params, err)
+	}
+
+	// Invalid params are reported when loading the config, so they can be shown at startup
+	t.Setenv("CLIPPY_EXTRA_PARAMS", `{"user": clippy}`)
+	if _, err := LoadConfigFromFile(filepath.Join(t.TempDir(), "none.yaml")); err == nil || !strings.Contains(err.Error(), "CLIPPY_EXTRA_PARAMS") {
+		t.Errorf("Expected an error naming CLIPPY_EXTRA_PARAMS, got %v", err)
+	}
+}
+
+func TestCustomHeaders(t *testing.T) {
+	headers := parseHeaders("OpenAI-Organization=org-1, X-Gateway-Key = secret=1,=bad,")
+	want := map[string]string{"OpenAI-Organization": "org-1", "X-Gateway-Key": "secret=1"}
+	if !reflect.DeepEqual(headers, want) {
+		t.Fatalf("Expected %v, got %v", want, headers)
+	}
+
+	var captured http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = r.Header.Clone()
+		w.Write([]byte(`{"choices": [{"message": {"content": "Hi"}}], "content": [{"type": "text", "text": "Hi"}], "message": {"content": "Hi"}}`))
+	}))
+	defer server.Close()
+
+	cfg := Config{BaseURL: server.URL, APIKey: "k", Model: "m", Headers: map[string]string{"OpenAI-Organization": "org-1", "Authorization": "Gateway abc"}}
+	for _, p := range []Provider{&OpenAIProvider{Config: cfg}, &AnthropicProvider{Config: cfg}, &OllamaProvider{Config: cfg}} {
+		captured = nil
+		if _, err := p.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil); err != nil {
+			t.Fatal(err)
 		}
-		// We expect this to fail with current implementation
+		if captured.Get("OpenAI-Organization") != "org-1" || captured.Get("Authorization") != "Gateway abc" {
+			t.Errorf("%T: expected the custom headers, overriding Authorization, got %v", p, captured)
+		}
+	}
+}
+
+func TestAzureOpenAI(t *testing.T) {
+	var gotURL string
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		gotHeader = r.Header.Clone()
+		w.Write([]byte(`{"choices": [{"message": {"content": "Hi"}}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(Config{Provider: "azure", APIKey: "az-key", Model: "gpt-4o", AzureEndpoint: server.URL + "/", AzureDeployment: "my deploy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	if err != nil || resp.Content != "Hi" {
+		t.Fatalf("Generate failed: %v, %v", resp, err)
+	}
+	if want := "/openai/deployments/my%20deploy/chat/completions?api-version=" + DefaultAzureAPIVersion; gotURL != want {
+		t.Errorf("Expected %s, got %s", want, gotURL)
+	}
+	if gotHeader.Get("api-key") != "az-key" || gotHeader.Get("Authorization") != "" {
+		t.Errorf("Expected the key in api-key and no Authorization header, got %v", gotHeader)
+	}
+
+	// The deployment defaults to the model, and the endpoint is required
+	if u, _ := azureURL(Config{AzureEndpoint: "https://r.openai.azure.com", Model: "gpt-4o", AzureAPIVersion: "2025-01-01"}); u != "https://r.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2025-01-01" {
+		t.Errorf("Unexpected URL %s", u)
+	}
+	if _, err := (&OpenAIProvider{Config: Config{Provider: "azure", Model: "gpt-4o"}}).Generate(context.Background(), nil, nil); err == nil || !strings.Contains(err.Error(), "CLIPPY_AZURE_ENDPOINT") {
+		t.Errorf("Expected a missing endpoint to be reported, got %v", err)
+	}
+}
+
+func TestCassette_RejectsUnexpectedRequest(t *testing.T) {
+	cassette := &Cassette{Interactions: make([]Interaction, 1)}
+	cassette.Interactions[0].Request.Method = "POST"
+	cassette.Interactions[0].Request.Path = "/v1/messages"
+	cassette.Interactions[0].Response.Status = http.StatusOK
+
+	provider := &OpenAIProvider{Config: Config{APIKey: "test-key", Model: "test-model", Transport: cassette}}
+	_, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "cassette mismatch") {
+		t.Errorf("Expected a cassette mismatch error, got %v", err)
+	}
+	if cassette.Remaining() != 1 {
+		t.Error("A mismatched request should not consume the interaction")
+	}
+}
+
+func TestOllamaProvider_Generate(t *testing.T) {
+	var capturedPath string
+	var capturedRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedPath = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&capturedRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model": "llama3.1",
+			"message": map[string]interface{}{
+				"role":    "assistant",
+				"content": "",
+				"tool_calls": []interface{}{
+					map[string]interface{}{"function": map[string]interface{}{"name": "read_file", "arguments": map[string]interface{}{"path": "a.txt"}}},
+					map[string]interface{}{"function": map[string]interface{}{"name": "list_directory", "arguments": map[string]interface{}{"path": "."}}},
+				},
+			},
+			"done":              true,
+			"prompt_eval_count": 26,
+			"eval_count":        9,
+		})
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(Config{Provider: "ollama", BaseURL: server.URL, Model: "llama3.1"})
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	history := []Message{
+		{Role: "system", Content: "You are Clippy"},
+		{Role: "user", Content: "What's in a.txt?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_0", Name: "read_file", Arguments: map[string]interface{}{"path": "a.txt"}}}},
+		{Role: "tool", Content: "hello", ToolCallID: "call_0"},
+	}
+	msg, err := provider.Generate(context.Background(), history, []tools.Tool{tools.ReadFileTool{}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if capturedPath != "/api/chat" {
+		t.Errorf("Expected /api/chat, got %s", capturedPath)
+	}
+	if capturedRequest["stream"] != false {
+		t.Errorf("Expected stream: false, got %v", capturedRequest["stream"])
+	}
+	messages := capturedRequest["messages"].([]interface{})
+	assistant := messages[2].(map[string]interface{})
+	call := assistant["tool_calls"].([]interface{})[0].(map[string]interface{})["function"].(map[string]interface{})
+	if call["name"] != "read_file" || call["arguments"].(map[string]interface{})["path"] != "a.txt" {
+		t.Errorf("Expected tool call arguments as an object, got %+v", call)
+	}
+	if toolMsg := messages[3].(map[string]interface{}); toolMsg["role"] != "tool" || toolMsg["tool_name"] != "read_file" {
+		t.Errorf("Expected tool result tagged with its tool name, got %+v", toolMsg)
+	}
+	apiTools := capturedRequest["tools"].([]interface{})
+	if fn := apiTools[0].(map[string]interface{})["function"].(map[string]interface{}); fn["name"] != "read_file" {
+		t.Errorf("Expected read_file in tools, got %+v", fn)
+	}
+
+	if len(msg.ToolCalls) != 2 || msg.ToolCalls[0].ID == msg.ToolCalls[1].ID {
+		t.Fatalf("Expected 2 tool calls with distinct ids, got %+v", msg.ToolCalls)
+	}
+	if msg.ToolCalls[1].Name != "list_directory" || msg.ToolCalls[1].Arguments["path"] != "." {
+		t.Errorf("Unexpected second tool call: %+v", msg.ToolCalls[1])
+	}
+	if msg.Usage.PromptTokens != 26 || msg.Usage.CompletionTokens != 9 || msg.Usage.TotalTokens != 35 {
+		t.Errorf("Expected usage mapped from eval counts, got %+v", msg.Usage)
+	}
+}
+
+func TestOllamaProvider_GenerateStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hi"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":" there"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":3,"eval_count":2}`)
+	}))
+	defer server.Close()
+
+	provider := &OllamaProvider{Config: Config{BaseURL: server.URL, Model: "llama3.1"}}
+	chunks, err := provider.GenerateStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	parts, final := collectStream(t, chunks)
+
+	if strings.Join(parts, "|") != "Hi| there" {
+		t.Errorf("Expected chunks [Hi, there], got %q", parts)
+	}
+	if final.Err != nil {
+		t.Fatalf("Unexpected stream error: %v", final.Err)
+	}
+	if final.Message.Content != "Hi there" || final.Usage.TotalTokens != 5 {
+		t.Errorf("Unexpected final chunk: %+v / %+v", final.Message, final.Usage)
+	}
+}
+
+func TestOpenAIProvider_Generate_StrictTools(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&capturedRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{
+				map[string]interface{}{"message": map[string]interface{}{
+					"tool_calls": []interface{}{
+						map[string]interface{}{"id": "call_1", "function": map[string]interface{}{
+							"name": "list_directory", "arguments": `{"path": ".", "sort": null, "filter": null}`,
+						}},
+					},
+				}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	provider := &OpenAIProvider{Config: Config{BaseURL: server.URL, APIKey: "test-key", Model: "test-model", StrictTools: true}}
+	msg, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "ls"}}, []tools.Tool{tools.ListDirectoryTool{}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	function := capturedRequest["tools"].([]interface{})[0].(map[string]interface{})["function"].(map[string]interface{})
+	if function["strict"] != true {
+		t.Errorf("Expected strict: true, got %v", function["strict"])
+	}
+	params := function["parameters"].(map[string]interface{})
+	if params["additionalProperties"] != false {
+		t.Errorf("Expected additionalProperties: false, got %v", params["additionalProperties"])
+	}
+	required := params["required"].([]interface{})
+	props := params["properties"].(map[string]interface{})
+	if len(required) != len(props) {
+		t.Errorf("Expected every property to be required, got %v for %d properties", required, len(props))
+	}
+	// Optional properties stay optional by accepting null
+	if sortType, ok := props["sort"].(map[string]interface{})["type"].([]interface{}); !ok || len(sortType) != 2 || sortType[1] != "null" {
+		t.Errorf("Expected optional sort to be nullable, got %v", props["sort"])
+	}
+	if props["path"].(map[string]interface{})["type"] != "string" {
+		t.Errorf("Required path should keep its type, got %v", props["path"])
+	}
+
+	args := msg.ToolCalls[0].Arguments
+	if _, ok := args["sort"]; ok {
+		t.Errorf("Null arguments should be dropped, got %v", args)
+	}
+	if args["path"] != "." {
+		t.Errorf("Expected path argument, got %v", args)
+	}
+
+	// The tool's own definition is left untouched
+	original := tools.ListDirectoryTool{}.Definition().Parameters.(map[string]interface{})
+	if _, ok := original["additionalProperties"]; ok {
+		t.Error("strictSchema must not modify the tool definition")
+	}
+
+	provider.Config.StrictTools = false
+	provider.Generate(context.Background(), []Message{{Role: "user", Content: "ls"}}, []tools.Tool{tools.ListDirectoryTool{}})
+	function = capturedRequest["tools"].([]interface{})[0].(map[string]interface{})["function"].(map[string]interface{})
+	if _, ok := function["strict"]; ok {
+		t.Error("Expected no strict flag when StrictTools is off")
+	}
+}
+
+func TestGenerate_MaxTokens(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedRequest = nil
+		json.NewDecoder(r.Body).Decode(&capturedRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{
+				map[string]interface{}{"message": map[string]interface{}{"content": "Hello"}},
+			},
+			"content": []interface{}{
+				map[string]interface{}{"type": "text", "text": "Hello"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	history := []Message{{Role: "user", Content: "hi"}}
+
+	openai := &OpenAIProvider{Config: Config{BaseURL: server.URL, Model: "test-model"}}
+	openai.Generate(context.Background(), history, nil)
+	if _, ok := capturedRequest["max_tokens"]; ok {
+		t.Errorf("Expected no max_tokens for OpenAI by default, got %v", capturedRequest["max_tokens"])
+	}
+	openai.Config.MaxTokens = 4096
+	openai.Generate(context.Background(), history, nil)
+	if capturedRequest["max_tokens"] != float64(4096) {
+		t.Errorf("Expected max_tokens 4096, got %v", capturedRequest["max_tokens"])
+	}
+
+	anthropic := &AnthropicProvider{Config: Config{BaseURL: server.URL, Model: "test-model"}}
+	anthropic.Generate(context.Background(), history, nil)
+	if capturedRequest["max_tokens"] != float64(DefaultAnthropicMaxTokens) {
+		t.Errorf("Expected default max_tokens %d, got %v", DefaultAnthropicMaxTokens, capturedRequest["max_tokens"])
+	}
+	anthropic.Config.MaxTokens = 8192
+	anthropic.Generate(context.Background(), history, nil)
+	if capturedRequest["max_tokens"] != float64(8192) {
+		t.Errorf("Expected max_tokens 8192, got %v", capturedRequest["max_tokens"])
+	}
+}
+
+func TestGenerate_Images(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedRequest = nil
+		json.NewDecoder(r.Body).Decode(&capturedRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{
+				map[string]interface{}{"message": map[string]interface{}{"content": "A paperclip"}},
+			},
+			"content": []interface{}{
+				map[string]interface{}{"type": "text", "text": "A paperclip"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "clip.png")
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	os.WriteFile(path, png, 0644)
+	img, err := LoadImage(path)
+	if err != nil || img.MediaType != "image/png" {
+		t.Fatalf("LoadImage = %+v, %v", img, err)
+	}
+	history := []Message{{Role: "user", Content: "What is this?", Images: []ImageData{img}}}
+	content := func() interface{} {
+		return capturedRequest["messages"].([]interface{})[0].(map[string]interface{})["content"]
+	}
+
+	openai := &OpenAIProvider{Config: Config{BaseURL: server.URL, Model: "gpt-4o"}}
+	openai.Generate(context.Background(), history, nil)
+	parts, ok := content().([]interface{})
+	if !ok || len(parts) != 2 {
+		t.Fatalf("Expected text and image_url parts, got %+v", content())
+	}
+	url := parts[1].(map[string]interface{})["image_url"].(map[string]interface{})["url"].(string)
+	if url != "data:image/png;base64,"+img.Data {
+		t.Errorf("Expected a base64 data URL, got %q", url)
+	}
+
+	openai.Config.Model = "gpt-3.5-turbo"
+	openai.Generate(context.Background(), history, nil)
+	if content() != "What is this?" {
+		t.Errorf("Expected images skipped for a text-only model, got %+v", content())
+	}
+
+	anthropic := &AnthropicProvider{Config: Config{BaseURL: server.URL, Model: "claude-3-5-sonnet-latest"}}
+	anthropic.Generate(context.Background(), history, nil)
+	blocks := content().([]interface{})
+	source, _ := blocks[0].(map[string]interface{})["source"].(map[string]interface{})
+	if len(blocks) != 2 || source["media_type"] != "image/png" || source["data"] != img.Data {
+		t.Errorf("Expected an image block before the text, got %+v", blocks)
+	}
+
+	os.WriteFile(path, []byte("not an image"), 0644)
+	if _, err := LoadImage(path); err == nil {
+		t.Error("Expected LoadImage to reject a non-image file")
+	}
+}
+
+func TestFetchModels_TimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := fetchModels(server.URL, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the fetch to give up promptly, took %s", elapsed)
+	}
+}
+
+func TestFetchModels_RejectsHugeResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("["))
+		w.Write(bytes.Repeat([]byte(" "), maxModelsBodyBytes))
+		w.Write([]byte("]"))
+	}))
+	defer server.Close()
+
+	_, err := fetchModels(server.URL, 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("Expected a size error, got %v", err)
+	}
+}
+
+func TestFetchModels_AsksTheProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/models" && r.Header.Get("Authorization") == "Bearer k":
+			w.Write([]byte(`{"data": [{"id": "gpt-4o-mini"}, {"id": "gpt-4o"}]}`))
+		case r.URL.Path == "/v1/models" && r.Header.Get("x-api-key") == "k" && r.Header.Get("anthropic-version") != "":
+			w.Write([]byte(`{"data": [{"id": "claude-sonnet-4-5"}]}`))
+		case r.URL.Path == "/api/tags":
+			w.Write([]byte(`{"models": [{"name": "llama3.2:latest"}]}`))
+		default:
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	models, err := FetchModels(context.Background(), &OpenAIProvider{Config: Config{BaseURL: server.URL + "/v1", APIKey: "k"}})
+	if err != nil || !reflect.DeepEqual(models, []string{"gpt-4o", "gpt-4o-mini"}) {
+		t.Errorf("Expected the sorted OpenAI list, got %v, %v", models, err)
+	}
+	models, err = FetchModels(context.Background(), &AnthropicProvider{Config: Config{BaseURL: server.URL, APIKey: "k"}})
+	if err != nil || !reflect.DeepEqual(models, []string{"claude-sonnet-4-5"}) {
+		t.Errorf("Expected the Anthropic list, got %v, %v", models, err)
+	}
+	models, err = FetchModels(context.Background(), &OllamaProvider{Config: Config{BaseURL: server.URL}})
+	if err != nil || !reflect.DeepEqual(models, []string{"llama3.2:latest"}) {
+		t.Errorf("Expected the Ollama list, got %v, %v", models, err)
+	}
+	_, err = FetchModels(context.Background(), &OpenAIProvider{Config: Config{BaseURL: server.URL + "/v1", APIKey: "wrong"}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a bad key to be reported, got %v", err)
+	}
+}
+
+func TestListModels_UnsupportedEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := (&OpenAIProvider{Config: Config{BaseURL: server.URL}}).ListModels(context.Background())
+	if !errors.Is(err, errModelsUnsupported) {
+		t.Errorf("Expected a 404 to fall back to the catalog, got %v", err)
+	}
+	_, err = (&OpenAIProvider{Config: Config{Provider: "azure"}}).ListModels(context.Background())
+	if !errors.Is(err, errModelsUnsupported) {
+		t.Errorf("Expected Azure to fall back to the catalog, got %v", err)
+	}
+}
+
+func TestSend_RetriesTransientErrors(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "hi") {
+			t.Errorf("Attempt %d sent an empty body", attempts)
+		}
+		if attempts < 3 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	p := &OpenAIProvider{Config: Config{BaseURL: server.URL, MaxRetries: 3}}
+	msg, err := p.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	if err != nil {
+		t.Fatalf("Expected retries to succeed, got %v", err)
+	}
+	if msg.Content != "ok" || attempts != 3 {
+		t.Errorf("Expected ok after 3 attempts, got %q after %d", msg.Content, attempts)
+	}
+
+	// Client errors aren't retried
+	attempts = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+	if _, err := p.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil); err == nil || attempts != 1 {
+		t.Errorf("Expected a single failed attempt for 400, got %d (err %v)", attempts, err)
+	}
+}
+
+func TestSend_RetryIsCancellable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p := &OpenAIProvider{Config: Config{BaseURL: server.URL, MaxRetries: 3}}
+
+	start := time.Now()
+	_, err := p.Generate(ctx, []Message{{Role: "user", Content: "hi"}}, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to stop the retry wait, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Retry wait ignored cancellation, took %s", elapsed)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		attempt    int
+		retryAfter string
+		expected   time.Duration
+	}{
+		{0, "", retryBaseDelay},
+		{2, "", 4 * retryBaseDelay},
+		{0, "7", 7 * time.Second},
+		{0, now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second},
+		{0, "3600", maxRetryDelay},
+		{10, "", maxRetryDelay},
+		{70, "", maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempt, tt.retryAfter, now); got != tt.expected {
+			t.Errorf("retryDelay(%d, %q) = %s, want %s", tt.attempt, tt.retryAfter, got, tt.expected)
+		}
+	}
+}
+
+func TestNewProvider_RequiresModel(t *testing.T) {
+	_, err := NewProvider(Config{Provider: "azure", AzureEndpoint: "https://example.openai.azure.com"})
+	if !errors.Is(err, ErrNoModel) || !strings.Contains(err.Error(), "CLIPPY_MODEL") {
+		t.Errorf("Expected a missing model error naming CLIPPY_MODEL, got %v", err)
+	}
+	if _, err := NewProvider(Config{Provider: "azure", AzureDeployment: "my-gpt"}); err != nil {
+		t.Errorf("Expected an Azure deployment to stand in for the model, got %v", err)
+	}
+	if err := (Config{Provider: "openai", Model: "  "}).Validate(); !errors.Is(err, ErrNoModel) {
+		t.Errorf("Expected a blank model to be rejected, got %v", err)
+	}
+	if _, err := NewProvider(Config{Provider: "mystery"}); err == nil || !strings.Contains(err.Error(), "unknown provider") {
+		t.Errorf("Expected an unknown provider error, got %v", err)
+	}
+}
+
+func TestLimitsFor(t *testing.T) {
+	tests := []struct {
+		model string
+		want  ModelLimits
+		ok    bool
+	}{
+		{"gpt-4o", ModelLimits{128000, 16384}, true},
+		{"gpt-4o-2024-08-06", ModelLimits{128000, 16384}, true},
+		{"gpt-4o-mini-2024-07-18", ModelLimits{128000, 16384}, true},
+		{"gpt-4-0613", ModelLimits{8192, 8192}, true},
+		{"claude-3-5-sonnet-latest", ModelLimits{200000, 8192}, true},
+		{"llama3.2:1b", ModelLimits{131072, 0}, true},
+		{"gpt-4oops", ModelLimits{}, false},
+		{"mystery-model", ModelLimits{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := LimitsFor(tt.model)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("LimitsFor(%q) = %+v, %v; want %+v, %v", tt.model, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDefaultModels(t *testing.T) {
+	for _, provider := range []string{"openai", "anthropic", "ollama"} {
+		p, err := NewProvider(Config{Provider: provider})
+		if err != nil {
+			t.Fatalf("NewProvider(%s) failed: %v", provider, err)
+		}
+		if got := p.GetConfig().Model; got == "" || got != DefaultModels[provider] {
+			t.Errorf("Expected %s to default to %q, got %q", provider, DefaultModels[provider], got)
+		}
+
+		t.Setenv("CLIPPY_PROVIDER", provider)
+		t.Setenv("CLIPPY_MODEL", "")
+		if got := LoadConfigFromEnv().Model; got != DefaultModels[provider] {
+			t.Errorf("Expected env config for %s to default to %q, got %q", provider, DefaultModels[provider], got)
+		}
+	}
+
+	p, _ := NewProvider(Config{Provider: "openai", Model: "gpt-4o"})
+	if got := p.GetConfig().Model; got != "gpt-4o" {
+		t.Errorf("A configured model should be kept, got %q", got)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSend_ClassifiesOfflineErrors(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+	dnsErr := &net.DNSError{Err: "no such host", Name: "api.openai.com", IsNotFound: true}
+
+	for _, netErr := range []error{dialErr, dnsErr} {
+		calls := 0
+		provider := &OpenAIProvider{Config: Config{APIKey: "k", Model: "m", BaseURL: "https://api.openai.com/v1", MaxRetries: 3,
+			Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+				calls++
+				return nil, netErr
+			})}}
+
+		_, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+		if !IsOffline(err) {
+			t.Fatalf("Expected %v to be classified as offline, got %T: %v", netErr, err, err)
+		}
+		var offline *OfflineError
+		errors.As(err, &offline)
+		if offline.Host != "api.openai.com" || !errors.Is(err, netErr) {
+			t.Errorf("Expected the host and underlying error to be kept, got %+v", offline)
+		}
+		if calls != 1 {
+			t.Errorf("Expected no retries while offline, got %d calls", calls)
+		}
+	}
+
+	// Anything else, like a timeout, is not an offline condition
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	provider := &OpenAIProvider{Config: Config{APIKey: "k", Model: "m", Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, timeout
+	})}}
+	if _, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil); err == nil || IsOffline(err) {
+		t.Errorf("Expected a timeout not to count as offline, got %v", err)
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+
+	// A custom root CA makes a server with an otherwise unknown certificate trusted
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	// The untrusted attempt fails its handshake; that's expected, so don't log it
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+
+	plain, err := newHTTPClient(env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Get(server.URL); err == nil {
+		t.Error("Expected the server's certificate to be untrusted without CLIPPY_CA_CERT")
+	}
+	withCA, err := newHTTPClient(env(map[string]string{"CLIPPY_CA_CERT": caPath, "CLIPPY_HTTP_TIMEOUT": "7"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := withCA.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected CLIPPY_CA_CERT to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+	if withCA.Timeout != 7*time.Second || plain.Timeout != DefaultHTTPTimeout {
+		t.Errorf("Expected timeouts of 7s and the default, got %s and %s", withCA.Timeout, plain.Timeout)
+	}
+
+	// Requests go through CLIPPY_PROXY
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+	viaProxy, err := newHTTPClient(env(map[string]string{"CLIPPY_PROXY": proxy.URL}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = viaProxy.Get("http://api.example.invalid/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied != "http://api.example.invalid/v1/models" {
+		t.Errorf("Expected the request to reach the proxy, got %q", proxied)
+	}
+
+	for _, bad := range []map[string]string{
+		{"CLIPPY_PROXY": "not a url"},
+		{"CLIPPY_CA_CERT": filepath.Join(t.TempDir(), "missing.pem")},
+		{"CLIPPY_CA_CERT": filepath.Join(t.TempDir())},
+	} {
+		if _, err := newHTTPClient(env(bad)); err == nil {
+			t.Errorf("Expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestProviders_ReuseConnections(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Trailing whitespace after the JSON mustn't cost the connection
+		padding := strings.Repeat(" ", 8<<10)
+		if strings.Contains(r.URL.Path, "messages") {
+			w.Write([]byte(`{"content": [{"type": "text", "text": "Hi"}]}` + padding))
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"content": "Hi"}}]}` + padding))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	providers := []Provider{
+		&OpenAIProvider{Config: Config{BaseURL: server.URL, APIKey: "k", Model: "m"}},
+		&AnthropicProvider{Config: Config{BaseURL: server.URL, APIKey: "k", Model: "m"}},
+	}
+	for _, p := range providers {
+		for i := 0; i < 3; i++ {
+			if _, err := p.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 {
+		t.Errorf("Expected every request to share one kept-alive connection, got %d connections", conns)
+	}
+}
+
+func TestDebugLog_RecordsRequestAndResponseWithoutKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-42")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"bad tool schema"}}`))
+	}))
+	defer server.Close()
+
+	logPath := filepath.Join(t.TempDir(), "debug.log")
+	provider := &OpenAIProvider{Config: Config{
+		BaseURL:  server.URL,
+		APIKey:   "sk-secret-key",
+		Model:    "test-model",
+		DebugLog: logPath,
+	}}
+	history := []Message{{Role: "user", Content: "hi"}}
+	if _, err := provider.Generate(context.Background(), history, nil); err == nil {
+		t.Fatal("Expected the 400 reply to fail the request")
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Expected a debug log to be written: %v", err)
+	}
+	log := string(data)
+	for _, want := range []string{"POST " + server.URL, `"model":"test-model"`, "400 Bad Request", "X-Request-Id: req-42", "bad tool schema", "Authorization: [REDACTED]", "done in"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("Expected debug log to contain %q, got:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "sk-secret-key") {
+		t.Errorf("Expected the API key to be redacted, got:\n%s", log)
+	}
+}
+
+func TestAPIError_ParsesProviderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  http.Header
+		body    string
+		want    string
+		errType string
+		code    string
+	}{
+		{
+			name:    "openai rate limit",
+			status:  http.StatusTooManyRequests,
+			header:  http.Header{"Retry-After": {"20"}},
+			body:    `{"error":{"message":"Rate limit reached for gpt-4o","type":"requests","code":"rate_limit_exceeded"}}`,
+			want:    "Rate limit exceeded — try again in 20s: Rate limit reached for gpt-4o",
+			errType: "requests",
+			code:    "rate_limit_exceeded",
+		},
+		{
+			name:    "anthropic invalid request",
+			status:  http.StatusBadRequest,
+			body:    `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: must be positive"}}`,
+			want:    "API error (400): max_tokens: must be positive",
+			errType: "invalid_request_error",
+		},
+		{
+			name:   "ollama error string",
+			status: http.StatusNotFound,
+			body:   `{"error":"model \"llama9\" not found"}`,
+			want:   `Not found (check the model name and base URL): model "llama9" not found`,
+		},
+		{
+			name:   "plain text body",
+			status: http.StatusBadGateway,
+			body:   "upstream connect error\n",
+			want:   "Provider server error (502): upstream connect error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: tt.header}
+			if resp.Header == nil {
+				resp.Header = http.Header{}
+			}
+			e := newAPIError(resp, []byte(tt.body))
+			if e.Error() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, e.Error())
+			}
+			if e.Type != tt.errType || e.Code != tt.code {
+				t.Errorf("Expected type %q and code %q, got %q and %q", tt.errType, tt.code, e.Type, e.Code)
+			}
+			if e.Body != tt.body {
+				t.Errorf("Expected the raw body to be kept, got %q", e.Body)
+			}
+		})
+	}
+}
+
+func TestResponseFormat_JSON(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&capturedRequest)
+		if strings.HasSuffix(r.URL.Path, "/v1/messages") {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"content": []interface{}{map[string]interface{}{"type": "text", "text": "{}"}},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{
+				map[string]interface{}{"message": map[string]interface{}{"content": "{}"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	history := []Message{{Role: "system", Content: "You are Clippy."}, {Role: "user", Content: "hi"}}
+	openai := &OpenAIProvider{Config: Config{BaseURL: server.URL, Model: "test-model", ResponseFormat: ResponseFormatJSON}}
+	if _, err := openai.Generate(context.Background(), history, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if format, ok := capturedRequest["response_format"].(map[string]interface{}); !ok || format["type"] != "json_object" {
+		t.Errorf("Expected response_format json_object, got %v", capturedRequest["response_format"])
+	}
+	system := capturedRequest["messages"].([]interface{})[0].(map[string]interface{})["content"].(string)
+	if !strings.HasPrefix(system, "You are Clippy.") || !strings.Contains(system, "JSON") {
+		t.Errorf("Expected the JSON instruction added to the system prompt, got %q", system)
+	}
+	if history[0].Content != "You are Clippy." {
+		t.Errorf("The caller's history must not change, got %q", history[0].Content)
+	}
+
+	capturedRequest = nil
+	anthropic := &AnthropicProvider{Config: Config{BaseURL: server.URL, Model: "test-model", ResponseFormat: ResponseFormatJSON}}
+	if _, err := anthropic.Generate(context.Background(), history[1:], nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if _, ok := capturedRequest["response_format"]; ok {
+		t.Error("Anthropic has no response_format field")
+	}
+	if system, _ := capturedRequest["system"].(string); !strings.Contains(system, "JSON") {
+		t.Errorf("Expected a JSON instruction as the Anthropic system prompt, got %q", system)
+	}
+}
+
+func TestStopSequences(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&capturedRequest)
+		if strings.HasSuffix(r.URL.Path, "/v1/messages") {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"content": []interface{}{map[string]interface{}{"type": "text", "text": "Hello"}},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{
+				map[string]interface{}{"message": map[string]interface{}{"content": "Hello"}},
+			},
+		})
+	}))
+	defer server.Close()
+	history := []Message{{Role: "user", Content: "hi"}}
+	stop := []interface{}{"END", "###"}
+
+	for _, provider := range []Provider{
+		&OpenAIProvider{Config: Config{BaseURL: server.URL, Model: "m", Stop: []string{"END", "###"}}},
+		&AnthropicProvider{Config: Config{BaseURL: server.URL, Model: "m", Stop: []string{"END", "###"}}},
+	} {
+		capturedRequest = nil
+		if _, err := provider.Generate(context.Background(), history, nil); err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		key := "stop"
+		if _, ok := provider.(*AnthropicProvider); ok {
+			key = "stop_sequences"
+		}
+		if !reflect.DeepEqual(capturedRequest[key], stop) {
+			t.Errorf("Expected %s %v, got %v", key, stop, capturedRequest[key])
+		}
+	}
+
+	capturedRequest = nil
+	openai := &OpenAIProvider{Config: Config{BaseURL: server.URL, Model: "m"}}
+	if _, err := openai.Generate(context.Background(), history, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if _, ok := capturedRequest["stop"]; ok {
+		t.Errorf("Expected no stop field without stop sequences, got %v", capturedRequest["stop"])
+	}
+
+	t.Setenv("CLIPPY_STOP", "END, ###,")
+	if got := LoadConfigFromEnv().Stop; !reflect.DeepEqual(got, []string{"END", "###"}) {
+		t.Errorf("Expected CLIPPY_STOP to be split on commas, got %v", got)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	var capturedRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedRequest = nil
+		json.NewDecoder(r.Body).Decode(&capturedRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{
+				map[string]interface{}{"message": map[string]interface{}{"content": "Hello"}},
+			},
+		})
+	}))
+	defer server.Close()
+	history := []Message{{Role: "user", Content: "hi"}}
+
+	seed := 0
+	provider := &OpenAIProvider{Config: Config{BaseURL: server.URL, Model: "m", Seed: &seed}}
+	if _, err := provider.Generate(context.Background(), history, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if got, ok := capturedRequest["seed"]; !ok || got != float64(0) {
+		t.Errorf("Expected a zero seed to still be sent, got %v", got)
+	}
+	provider.Config.Seed = nil
+	if _, err := provider.Generate(context.Background(), history, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if _, ok := capturedRequest["seed"]; ok {
+		t.Errorf("Expected no seed when unset, got %v", capturedRequest["seed"])
+	}
+
+	t.Setenv("CLIPPY_SEED", "42")
+	if got := LoadConfigFromEnv().Seed; got == nil || *got != 42 {
+		t.Errorf("Expected CLIPPY_SEED=42 to load, got %v", got)
+	}
+	t.Setenv("CLIPPY_SEED", "abc")
+	if got := LoadConfigFromEnv().Seed; got != nil {
+		t.Errorf("Expected an invalid seed to be ignored, got %d", *got)
+	}
+}
+
+func TestUsage_CachedTokens(t *testing.T) {
+	history := []Message{{Role: "user", Content: "hi"}}
+
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"content":"Hello"}}],"usage":{"prompt_tokens":2000,"completion_tokens":10,"total_tokens":2010,"prompt_tokens_details":{"cached_tokens":1536}}}`))
+	}))
+	defer openai.Close()
+	msg, err := (&OpenAIProvider{Config: Config{BaseURL: openai.URL, Model: "m"}}).Generate(context.Background(), history, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if want := (Usage{PromptTokens: 2000, CompletionTokens: 10, TotalTokens: 2010, CachedTokens: 1536}); *msg.Usage != want {
+		t.Errorf("Expected OpenAI usage %+v, got %+v", want, *msg.Usage)
+	}
+
+	anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content":[{"type":"text","text":"Hello"}],"usage":{"input_tokens":50,"output_tokens":10,"cache_read_input_tokens":1800,"cache_creation_input_tokens":150}}`))
+	}))
+	defer anthropic.Close()
+	msg, err = (&AnthropicProvider{Config: Config{BaseURL: anthropic.URL, Model: "m"}}).Generate(context.Background(), history, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	// Cache reads and writes count toward the prompt, as they do for OpenAI
+	if want := (Usage{PromptTokens: 2000, CompletionTokens: 10, TotalTokens: 2010, CachedTokens: 1800}); *msg.Usage != want {
+		t.Errorf("Expected Anthropic usage %+v, got %+v", want, *msg.Usage)
+	}
+
+	var capturedRequest map[string]interface{}
+	stream := sseServer(t, &capturedRequest, []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":50,"output_tokens":1,"cache_read_input_tokens":1800}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	})
+	defer stream.Close()
+	msg, err = (&AnthropicProvider{Config: Config{BaseURL: stream.URL, Model: "m", Stream: true}}).Generate(context.Background(), history, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if want := (Usage{PromptTokens: 1850, CompletionTokens: 7, TotalTokens: 1857, CachedTokens: 1800}); *msg.Usage != want {
+		t.Errorf("Expected streamed Anthropic usage %+v, got %+v", want, *msg.Usage)
+	}
+}
+
+func TestLoadConfigFromFile_Profiles(t *testing.T) {
+	for _, key := range []string{"CLIPPY_PROVIDER", "CLIPPY_MODEL", "CLIPPY_API_KEY", "CLIPPY_PROFILE", "CLIPPY_MAX_TOKENS", "CLIPPY_STREAM", "CLIPPY_MAX_RETRIES"} {
+		t.Setenv(key, "")
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+profile: work
+max_tokens: 2048
+stream: true
+profiles:
+  work:
+    provider: openai
+    model: gpt-4o
+    api_key: sk-work
+    max_retries: 0
+  local:
+    provider: ollama
+    stream: false
+`), 0644)
+
+	cfg, err := LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile failed: %v", err)
+	}
+	if cfg.Profile != "work" || cfg.Provider != "openai" || cfg.Model != "gpt-4o" || cfg.APIKey != "sk-work" {
+		t.Errorf("Expected the work profile, got %+v", cfg)
+	}
+	if cfg.MaxTokens != 2048 || !cfg.Stream || cfg.MaxRetries != 0 {
+		t.Errorf("Expected shared settings under the profile's, got max_tokens %d, stream %v, retries %d", cfg.MaxTokens, cfg.Stream, cfg.MaxRetries)
+	}
+
+	// The environment picks the profile and wins over the file
+	t.Setenv("CLIPPY_PROFILE", "local")
+	t.Setenv("CLIPPY_MAX_TOKENS", "512")
+	cfg, err = LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile failed: %v", err)
+	}
+	if cfg.Profile != "local" || cfg.Provider != "ollama" || cfg.Model != DefaultModels["ollama"] || cfg.Stream {
+		t.Errorf("Expected the local profile with ollama's default model, got %+v", cfg)
+	}
+	if cfg.MaxTokens != 512 || cfg.MaxRetries != DefaultMaxRetries {
+		t.Errorf("Expected CLIPPY_MAX_TOKENS to override the file, got %d (retries %d)", cfg.MaxTokens, cfg.MaxRetries)
+	}
+
+	// Including over the profile's own settings
+	t.Setenv("CLIPPY_MODEL", "llama3.1")
+	if cfg, _ := LoadConfigFromFile(path); cfg.Provider != "ollama" || cfg.Model != "llama3.1" {
+		t.Errorf("Expected CLIPPY_MODEL to override the profile, got %+v", cfg)
+	}
+	t.Setenv("CLIPPY_MODEL", "")
+
+	t.Setenv("CLIPPY_PROFILE", "missing")
+	if _, err := LoadConfigFromFile(path); err == nil || !strings.Contains(err.Error(), "local, work") {
+		t.Errorf("Expected an unknown profile error listing the profiles, got %v", err)
+	}
+
+	t.Setenv("CLIPPY_PROFILE", "")
+	t.Setenv("CLIPPY_PROVIDER", "anthropic")
+	cfg, err = LoadConfigFromFile(filepath.Join(t.TempDir(), "none.yaml"))
+	if err != nil || cfg.Provider != "anthropic" || cfg.Profile != "" {
+		t.Errorf("Expected a missing file to fall back to the environment, got %+v, %v", cfg, err)
+	}
+
+	// Misspelled keys are reported rather than silently ignored
+	os.WriteFile(path, []byte("profiles:\n  work:\n    modle: gpt-4o\n"), 0644)
+	if _, err := LoadConfigFromFile(path); err == nil || !strings.Contains(err.Error(), "modle") {
+		t.Errorf("Expected an unknown key to be rejected, got %v", err)
+	}
+}
+
+func TestDebugLog_RedactsConfiguredHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices": [{"message": {"content": "Hi"}}]}`))
+	}))
+	defer server.Close()
+
+	logPath := filepath.Join(t.TempDir(), "debug.log")
+	provider := &OpenAIProvider{Config: Config{
+		BaseURL:  server.URL,
+		APIKey:   "sk-secret-key",
+		Model:    "test-model",
+		Headers:  map[string]string{"x-gateway-auth": "gw-token-123"},
+		DebugLog: logPath,
+	}}
+	if _, err := provider.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(logPath)
+	log := string(data)
+	if !strings.Contains(log, "X-Gateway-Auth: [REDACTED]") {
+		t.Errorf("Expected the gateway header to be redacted, got:\n%s", log)
+	}
+	if strings.Contains(log, "gw-token-123") {
+		t.Errorf("Expected the gateway token to be kept out of the log, got:\n%s", log)
 	}
 }
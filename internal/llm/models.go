@@ -0,0 +1,156 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// ModelLister is implemented by providers whose API can list the models the configured key
+// has access to
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// errModelsUnsupported means the endpoint has no model list, so the models.dev catalog is used instead
+var errModelsUnsupported = errors.New("model listing not supported")
+
+// FetchModels lists the models provider can use, from its own API when it implements
+// ModelLister, or from the models.dev catalog when it doesn't or the endpoint has no list
+func FetchModels(ctx context.Context, provider Provider) ([]string, error) {
+	if lister, ok := provider.(ModelLister); ok {
+		ctx, cancel := context.WithTimeout(ctx, modelsFetchTimeout)
+		defer cancel()
+		models, err := lister.ListModels(ctx)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out fetching models after %s", modelsFetchTimeout)
+		}
+		if !errors.Is(err, errModelsUnsupported) {
+			sort.Strings(models)
+			return models, err
+		}
+	}
+	return fetchModels(modelsDevModelsURL, modelsFetchTimeout)
+}
+
+// ListModels asks GET /models which models the key can use. Azure lists deployments rather
+// than models, so it isn't supported there.
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	if p.Config.Provider == "azure" {
+		return nil, errModelsUnsupported
+	}
+	baseURL := p.Config.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + p.Config.APIKey}
+	if err := getModels(ctx, p.Config, baseURL+"/models", headers, &result); err != nil {
+		return nil, err
+	}
+	models := make([]string, 0, len(result.Data))
+	for _, m := range result.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// ListModels asks GET /v1/models which models the key can use
+func (p *AnthropicProvider) ListModels(ctx context.Context) ([]string, error) {
+	baseURL := p.Config.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com"
+	}
+	version := p.Config.AnthropicVersion
+	if version == "" {
+		version = DefaultAnthropicVersion
+	}
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	headers := map[string]string{"x-api-key": p.Config.APIKey, "anthropic-version": version}
+	if err := getModels(ctx, p.Config, baseURL+"/v1/models?limit=1000", headers, &result); err != nil {
+		return nil, err
+	}
+	models := make([]string, 0, len(result.Data))
+	for _, m := range result.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// ListModels asks the Ollama server which models it has pulled
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	baseURL := p.Config.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultOllamaURL
+	}
+	var result struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	var headers map[string]string
+	if p.Config.APIKey != "" {
+		headers = map[string]string{"Authorization": "Bearer " + p.Config.APIKey}
+	}
+	if err := getModels(ctx, p.Config, baseURL+"/api/tags", headers, &result); err != nil {
+		return nil, err
+	}
+	models := make([]string, 0, len(result.Models))
+	for _, m := range result.Models {
+		models = append(models, m.Name)
+	}
+	return models, nil
+}
+
+// getModels GETs a model list into out. A 404 or 405 means the endpoint (often a
+// compatible server or gateway) has no list, reported as errModelsUnsupported.
+func getModels(ctx context.Context, cfg Config, url string, headers map[string]string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	setHeaders(req, cfg.Headers)
+
+	client, err := clientFor(cfg)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return classifyNetworkError(err)
+	}
+	defer closeBody(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return errModelsUnsupported
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return fmt.Errorf("failed to list models: %w", newAPIError(resp, body))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxModelsBodyBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxModelsBodyBytes {
+		return fmt.Errorf("models response is larger than %d bytes", maxModelsBodyBytes)
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+)
+
+// OfflineError means the provider couldn't be reached at all (DNS failure, refused or
+// unreachable connection), as opposed to the provider answering with an error
+type OfflineError struct {
+	Host string // Host the request was for
+	Err  error  // Underlying network error
+}
+
+func (e *OfflineError) Error() string {
+	if e.Host == "" {
+		return fmt.Sprintf("network unavailable: %v", e.Err)
+	}
+	return fmt.Sprintf("can't reach %s: %v", e.Host, e.Err)
+}
+
+func (e *OfflineError) Unwrap() error {
+	return e.Err
+}
+
+// IsOffline reports whether err means the network or provider host is unreachable
+func IsOffline(err error) bool {
+	var offline *OfflineError
+	return errors.As(err, &offline)
+}
+
+// networkUnavailable reports whether err from an HTTP round trip came from failing to
+// connect at all. Timeouts and cancellations aren't included; they have their own handling.
+func networkUnavailable(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && !opErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH)
+}
+
+// classifyNetworkError wraps connection failures in OfflineError, leaving other errors as they are
+func classifyNetworkError(err error) error {
+	if !networkUnavailable(err) {
+		return err
+	}
+	host := ""
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if u, perr := url.Parse(urlErr.URL); perr == nil {
+			host = u.Host
+		}
+		// url.Error repeats the method and URL, which OfflineError already summarizes
+		err = urlErr.Err
+	}
+	return &OfflineError{Host: host, Err: err}
+}
@@ -0,0 +1,238 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/cellwebb/clippy-go/internal/tools"
+)
+
+// DefaultOllamaURL is where a local Ollama server listens by default
+const DefaultOllamaURL = "http://localhost:11434"
+
+// OllamaProvider implements Provider for a local Ollama server's /api/chat endpoint
+type OllamaProvider struct {
+	Config Config
+}
+
+func (p *OllamaProvider) UpdateConfig(cfg Config) {
+	p.Config = cfg
+}
+
+func (p *OllamaProvider) GetConfig() Config {
+	return p.Config
+}
+
+// ollamaResponse is a /api/chat reply, or one line of a streamed reply
+type ollamaResponse struct {
+	Message struct {
+		Content   string `json:"content"`
+		ToolCalls []struct {
+			ID       string `json:"id"`
+			Function struct {
+				Name      string                 `json:"name"`
+				Arguments map[string]interface{} `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+func (p *OllamaProvider) Generate(ctx context.Context, messages []Message, availableTools []tools.Tool) (*Message, error) {
+	req, err := p.newRequest(ctx, messages, availableTools, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(req, p.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
+
+	var result ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, &APIError{Message: result.Error}
+	}
+
+	responseMsg := &Message{
+		Role:    "assistant",
+		Content: result.Message.Content,
+		Usage:   ollamaUsage(result),
+	}
+	for i, tc := range result.Message.ToolCalls {
+		// Older Ollama versions don't assign ids, so make them unique within the reply
+		id := tc.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
+		}
+		responseMsg.ToolCalls = append(responseMsg.ToolCalls, ToolCall{
+			ID:        id,
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
+	}
+	return responseMsg, nil
+}
+
+// GenerateStream sends a streaming request and emits content as it arrives. Ollama streams
+// newline-delimited JSON rather than server-sent events; tool calls arrive whole.
+func (p *OllamaProvider) GenerateStream(ctx context.Context, messages []Message, availableTools []tools.Tool) (<-chan StreamChunk, error) {
+	req, err := p.newRequest(ctx, messages, availableTools, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := send(req, p.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make(chan StreamChunk)
+	go func() {
+		defer close(chunks)
+		defer resp.Body.Close()
+
+		msg := &Message{Role: "assistant", Usage: &Usage{}}
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var line ollamaResponse
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				sendChunk(ctx, chunks, StreamChunk{Done: true, Err: fmt.Errorf("invalid stream chunk: %v", err)})
+				return
+			}
+			if line.Error != "" {
+				sendChunk(ctx, chunks, StreamChunk{Done: true, Err: fmt.Errorf("stream error: %s", line.Error)})
+				return
+			}
+			if line.Message.Content != "" {
+				msg.Content += line.Message.Content
+				if !sendChunk(ctx, chunks, StreamChunk{Content: line.Message.Content}) {
+					return
+				}
+			}
+			for _, tc := range line.Message.ToolCalls {
+				id := tc.ID
+				if id == "" {
+					id = fmt.Sprintf("call_%d", len(msg.ToolCalls))
+				}
+				msg.ToolCalls = append(msg.ToolCalls, ToolCall{ID: id, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+			}
+			if line.Done {
+				msg.Usage = ollamaUsage(line)
+				sendChunk(ctx, chunks, StreamChunk{Done: true, Usage: msg.Usage, Message: msg})
+				return
+			}
+		}
+		err := scanner.Err()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		sendChunk(ctx, chunks, StreamChunk{Done: true, Err: err})
+	}()
+	return chunks, nil
+}
+
+// newRequest builds an /api/chat request
+func (p *OllamaProvider) newRequest(ctx context.Context, messages []Message, availableTools []tools.Tool, stream bool) (*http.Request, error) {
+	baseURL := p.Config.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultOllamaURL
+	}
+	url := baseURL + "/api/chat"
+
+	messages = withResponseFormat(messages, p.Config.ResponseFormat)
+
+	// Ollama identifies tool results by tool name rather than call id
+	toolNames := make(map[string]string)
+	apiMessages := make([]map[string]interface{}, len(messages))
+	for i, msg := range messages {
+		m := map[string]interface{}{
+			"role":    msg.Role,
+			"content": msg.Content,
+		}
+		if len(msg.ToolCalls) > 0 {
+			toolCalls := make([]map[string]interface{}, len(msg.ToolCalls))
+			for j, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Name
+				toolCalls[j] = map[string]interface{}{
+					"function": map[string]interface{}{
+						"name":      tc.Name,
+						"arguments": tc.Arguments,
+					},
+				}
+			}
+			m["tool_calls"] = toolCalls
+		}
+		if msg.Role == "tool" {
+			if name, ok := toolNames[msg.ToolCallID]; ok {
+				m["tool_name"] = name
+			}
+		}
+		apiMessages[i] = m
+	}
+
+	reqBody := map[string]interface{}{
+		"model":    p.Config.Model,
+		"messages": apiMessages,
+		"stream":   stream,
+	}
+	if p.Config.ResponseFormat == ResponseFormatJSON {
+		reqBody["format"] = "json"
+	}
+	if len(availableTools) > 0 {
+		apiTools := make([]map[string]interface{}, len(availableTools))
+		for i, t := range availableTools {
+			def := t.Definition()
+			apiTools[i] = map[string]interface{}{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":        def.Name,
+					"description": def.Description,
+					"parameters":  def.Parameters,
+				},
+			}
+		}
+		reqBody["tools"] = apiTools
+	}
+	mergeExtraParams(reqBody, p.Config.ExtraParams)
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.Config.APIKey != "" {
+		// Not needed locally, but proxies in front of Ollama often require one
+		req.Header.Set("Authorization", "Bearer "+p.Config.APIKey)
+	}
+	setHeaders(req, p.Config.Headers)
+	return req, nil
+}
+
+// ollamaUsage maps Ollama's evaluation counts onto Usage
+func ollamaUsage(r ollamaResponse) *Usage {
+	return &Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxRetries is how many times a transient API error is retried when CLIPPY_MAX_RETRIES is unset
+const DefaultMaxRetries = 3
+
+// Backoff between retries: retryBaseDelay doubles each attempt, and no wait (including one
+// asked for by Retry-After) exceeds maxRetryDelay. Variables so tests can shorten them.
+var (
+	retryBaseDelay = time.Second
+	maxRetryDelay  = 60 * time.Second
+)
+
+// retryableStatus reports whether a status is worth retrying: rate limits and server hiccups
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns how long to wait before retry number attempt (0-based), preferring the
+// server's Retry-After header (seconds or an HTTP date) over exponential backoff
+func retryDelay(attempt int, retryAfter string, now time.Time) time.Duration {
+	// Past 20 doublings the delay is far over maxRetryDelay; shifting further would overflow
+	delay := retryBaseDelay << min(attempt, 20)
+	if wait, ok := parseRetryAfter(retryAfter, now); ok {
+		delay = wait
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(retryAfter string, now time.Time) (time.Duration, bool) {
+	retryAfter = strings.TrimSpace(retryAfter)
+	if secs, err := strconv.Atoi(retryAfter); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(retryAfter); err == nil {
+		return max(when.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d, returning early with the context's error if it's cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// maxRetriesFromEnv reads CLIPPY_MAX_RETRIES, keeping fallback when it's unset or invalid
+func maxRetriesFromEnv(fallback int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("CLIPPY_MAX_RETRIES")))
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
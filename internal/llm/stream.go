@@ -0,0 +1,273 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// readSSE calls handle with the data payload of each server-sent event until [DONE] or EOF
+func readSSE(r io.Reader, handle func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			// Skip "event:" lines, comments, and blank separators
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			return nil
+		}
+		if err := handle([]byte(data)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// partialToolCall collects a tool call whose arguments arrive in fragments
+type partialToolCall struct {
+	id   string
+	name string
+	args strings.Builder
+}
+
+// toolCall parses the accumulated argument JSON into a complete ToolCall
+func (p *partialToolCall) toolCall() (ToolCall, error) {
+	args := map[string]interface{}{}
+	if raw := strings.TrimSpace(p.args.String()); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &args); err != nil {
+			return ToolCall{}, fmt.Errorf("invalid arguments for tool call %s: %v", p.name, err)
+		}
+	}
+	dropNullArguments(args)
+	return ToolCall{ID: p.id, Name: p.name, Arguments: args}, nil
+}
+
+// streamAccumulator reassembles streamed chunks into a single assistant Message
+type streamAccumulator struct {
+	content strings.Builder
+	calls   map[int]*partialToolCall // Keyed by the provider's tool call index
+	usage   Usage
+}
+
+func newStreamAccumulator() *streamAccumulator {
+	return &streamAccumulator{calls: make(map[int]*partialToolCall)}
+}
+
+// call returns the partial tool call at index, creating it on first sight
+func (s *streamAccumulator) call(index int) *partialToolCall {
+	pc, ok := s.calls[index]
+	if !ok {
+		pc = &partialToolCall{}
+		s.calls[index] = pc
+	}
+	return pc
+}
+
+// message builds the final Message once the stream is finished
+func (s *streamAccumulator) message() (*Message, error) {
+	msg := &Message{
+		Role:    "assistant",
+		Content: s.content.String(),
+		Usage:   &Usage{},
+	}
+	*msg.Usage = s.usage
+	if msg.Usage.TotalTokens == 0 {
+		msg.Usage.TotalTokens = msg.Usage.PromptTokens + msg.Usage.CompletionTokens
+	}
+
+	indexes := make([]int, 0, len(s.calls))
+	for index := range s.calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		tc, err := s.calls[index].toolCall()
+		if err != nil {
+			return nil, err
+		}
+		msg.ToolCalls = append(msg.ToolCalls, tc)
+	}
+	return msg, nil
+}
+
+// addOpenAIChunk folds one chat.completion.chunk into the accumulator, returning any new text
+func (s *streamAccumulator) addOpenAIChunk(data []byte) (string, error) {
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content   string `json:"content"`
+				ToolCalls []struct {
+					Index    int    `json:"index"`
+					ID       string `json:"id"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"delta"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return "", fmt.Errorf("invalid stream chunk: %v", err)
+	}
+
+	if chunk.Usage != nil {
+		s.usage = *chunk.Usage.usage()
+	}
+	if len(chunk.Choices) == 0 {
+		return "", nil
+	}
+
+	delta := chunk.Choices[0].Delta
+	s.content.WriteString(delta.Content)
+	for _, tc := range delta.ToolCalls {
+		// Only the first fragment carries the id and name; later ones just extend the arguments
+		pc := s.call(tc.Index)
+		if tc.ID != "" {
+			pc.id = tc.ID
+		}
+		if tc.Function.Name != "" {
+			pc.name = tc.Function.Name
+		}
+		pc.args.WriteString(tc.Function.Arguments)
+	}
+	return delta.Content, nil
+}
+
+// addAnthropicEvent folds one Messages API stream event into the accumulator, returning any new text
+func (s *streamAccumulator) addAnthropicEvent(data []byte) (string, error) {
+	var event struct {
+		Type    string `json:"type"`
+		Index   int    `json:"index"`
+		Message struct {
+			Usage anthropicUsage `json:"usage"`
+		} `json:"message"`
+		ContentBlock struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"content_block"`
+		Delta struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			PartialJSON string `json:"partial_json"`
+		} `json:"delta"`
+		Usage struct {
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", fmt.Errorf("invalid stream event: %v", err)
+	}
+
+	switch event.Type {
+	case "message_start":
+		s.usage = *event.Message.Usage.usage()
+	case "content_block_start":
+		if event.ContentBlock.Type == "tool_use" {
+			pc := s.call(event.Index)
+			pc.id = event.ContentBlock.ID
+			pc.name = event.ContentBlock.Name
+		}
+	case "content_block_delta":
+		switch event.Delta.Type {
+		case "text_delta":
+			s.content.WriteString(event.Delta.Text)
+			return event.Delta.Text, nil
+		case "input_json_delta":
+			s.call(event.Index).args.WriteString(event.Delta.PartialJSON)
+		}
+	case "message_delta":
+		// output_tokens here is cumulative for the whole message
+		s.usage.CompletionTokens = event.Usage.OutputTokens
+		s.usage.TotalTokens = s.usage.PromptTokens + s.usage.CompletionTokens
+	case "error":
+		return "", &APIError{Type: event.Error.Type, Message: event.Error.Message, Body: string(data)}
+	}
+	return "", nil
+}
+
+// readOpenAIStream consumes an OpenAI SSE response body into a complete Message
+func readOpenAIStream(body io.Reader) (*Message, error) {
+	acc := newStreamAccumulator()
+	err := readSSE(body, func(data []byte) error {
+		_, err := acc.addOpenAIChunk(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acc.message()
+}
+
+// readAnthropicStream consumes an Anthropic SSE response body into a complete Message
+func readAnthropicStream(body io.Reader) (*Message, error) {
+	acc := newStreamAccumulator()
+	err := readSSE(body, func(data []byte) error {
+		_, err := acc.addAnthropicEvent(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acc.message()
+}
+
+// streamChunks reads an SSE body in the background, emitting each text delta followed by a
+// final Done chunk. The channel is closed and the body released once the stream ends or ctx
+// is cancelled.
+func streamChunks(ctx context.Context, body io.ReadCloser, acc *streamAccumulator, add func(data []byte) (string, error)) <-chan StreamChunk {
+	chunks := make(chan StreamChunk)
+	go func() {
+		defer close(chunks)
+		defer body.Close()
+
+		err := readSSE(body, func(data []byte) error {
+			text, err := add(data)
+			if err != nil {
+				return err
+			}
+			if text != "" && !sendChunk(ctx, chunks, StreamChunk{Content: text}) {
+				return ctx.Err()
+			}
+			return nil
+		})
+		if err != nil {
+			sendChunk(ctx, chunks, StreamChunk{Done: true, Err: err})
+			return
+		}
+		msg, err := acc.message()
+		if err != nil {
+			sendChunk(ctx, chunks, StreamChunk{Done: true, Err: err})
+			return
+		}
+		sendChunk(ctx, chunks, StreamChunk{Done: true, Usage: msg.Usage, Message: msg})
+	}()
+	return chunks
+}
+
+// sendChunk delivers a chunk unless ctx is cancelled first, so an abandoned stream can't block
+func sendChunk(ctx context.Context, chunks chan<- StreamChunk, chunk StreamChunk) bool {
+	select {
+	case chunks <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
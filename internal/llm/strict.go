@@ -0,0 +1,89 @@
+package llm
+
+import "sort"
+
+// strictSchema adapts a JSON Schema for OpenAI structured outputs: every object disallows
+// additional properties and lists all of its properties as required. Properties that were
+// optional become nullable instead, so the model can still leave them out by sending null.
+// The input is not modified.
+func strictSchema(schema interface{}) interface{} {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return schema
+	}
+
+	out := make(map[string]interface{}, len(s))
+	for key, value := range s {
+		out[key] = value
+	}
+
+	if items, ok := s["items"]; ok {
+		out["items"] = strictSchema(items)
+	}
+	if s["type"] != "object" {
+		return out
+	}
+
+	required := make(map[string]bool)
+	switch r := s["required"].(type) {
+	case []string:
+		for _, name := range r {
+			required[name] = true
+		}
+	case []interface{}:
+		for _, name := range r {
+			if name, ok := name.(string); ok {
+				required[name] = true
+			}
+		}
+	}
+
+	props, _ := s["properties"].(map[string]interface{})
+	strictProps := make(map[string]interface{}, len(props))
+	names := make([]string, 0, len(props))
+	for name, prop := range props {
+		prop = strictSchema(prop)
+		if !required[name] {
+			prop = nullable(prop)
+		}
+		strictProps[name] = prop
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out["properties"] = strictProps
+	out["required"] = names
+	out["additionalProperties"] = false
+	return out
+}
+
+// nullable widens a property schema's type to also accept null
+func nullable(schema interface{}) interface{} {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return schema
+	}
+	if t, ok := s["type"].(string); ok {
+		s["type"] = []interface{}{t, "null"}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		s["enum"] = append(append([]interface{}{}, enum...), nil)
+	} else if enum, ok := s["enum"].([]string); ok {
+		values := make([]interface{}, 0, len(enum)+1)
+		for _, v := range enum {
+			values = append(values, v)
+		}
+		s["enum"] = append(values, nil)
+	}
+	return s
+}
+
+// dropNullArguments removes arguments the model set to null, which is how strict schemas
+// express an omitted optional argument
+func dropNullArguments(args map[string]interface{}) {
+	for key, value := range args {
+		if value == nil {
+			delete(args, key)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupSuffix is appended to a file's path for the copy write_file keeps of what it overwrote
+const backupSuffix = ".bak"
+
+// DefaultTrashDir is where edit_file, apply_patch and delete_file keep the versions they
+// replace or remove, so a bad edit or an accidental deletion can be recovered
+func DefaultTrashDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".clippy", "trash")
+}
+
+// trashStampLayout names each trash entry's directory, so successive versions of a file stay
+// apart and an entry's age can be read from its name
+const trashStampLayout = "20060102-150405.000000000"
+
+// TrashMaxAge is how long trashed files are kept; older entries are removed the next time
+// something is trashed
+const TrashMaxAge = 30 * 24 * time.Hour
+
+// backupFile copies path to path.bak, replacing any earlier backup, and returns the backup path
+func backupFile(path string) (string, error) {
+	backup := path + backupSuffix
+	if err := copyFile(path, backup); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %v", path, err)
+	}
+	return backup, nil
+}
+
+// trashPath names path's copy in trash: its absolute path under a directory named for the
+// time, e.g. trash/20240102-030405.000000000/home/me/project/main.go
+func trashPath(trash, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	abs = strings.TrimPrefix(abs[len(filepath.VolumeName(abs)):], string(filepath.Separator))
+	return filepath.Join(trash, time.Now().Format(trashStampLayout), abs)
+}
+
+// makeTrashEntry prunes the trash and returns where path's copy should go, with its
+// directory created
+func makeTrashEntry(trash, path string) (string, error) {
+	pruneTrash(trash, time.Now())
+	dest := trashPath(trash, path)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("failed to create trash directory: %v", err)
+	}
+	return dest, nil
+}
+
+// pruneTrash removes trash entries older than TrashMaxAge. Anything it can't date is kept.
+func pruneTrash(trash string, now time.Time) {
+	entries, err := os.ReadDir(trash)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if len(name) < len(trashStampLayout) {
+			continue
+		}
+		stamp, err := time.ParseInLocation(trashStampLayout, name[:len(trashStampLayout)], time.Local)
+		if err == nil && now.Sub(stamp) > TrashMaxAge {
+			os.RemoveAll(filepath.Join(trash, name))
+		}
+	}
+}
+
+// copyToTrash copies path into trash and returns where the copy went
+func copyToTrash(trash, path string) (string, error) {
+	dest, err := makeTrashEntry(trash, path)
+	if err != nil {
+		return "", err
+	}
+	if err := copyFile(path, dest); err != nil {
+		return "", fmt.Errorf("failed to copy %s to trash: %v", path, err)
+	}
+	return dest, nil
+}
+
+// moveToTrash moves path into trash and returns where it went, copying when the trash is on
+// another filesystem
+func moveToTrash(trash, path string) (string, error) {
+	dest, err := makeTrashEntry(trash, path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(path, dest); err == nil {
+		return dest, nil
+	}
+	if err := copyFile(path, dest); err != nil {
+		return "", fmt.Errorf("failed to move %s to trash: %v", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+	return dest, nil
+}
+
+// copyFile copies src to dst, keeping src's permissions
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
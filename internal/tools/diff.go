@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffLines caps the diff preview edit_file and write_file return
+const maxDiffLines = 200
+
+// diffContext is how many unchanged lines surround each change in a diff preview
+const diffContext = 3
+
+// maxDiffCells bounds the LCS table; past it the changed region is shown as a full replacement
+const maxDiffCells = 1 << 22
+
+// diffOp is one line of a line diff: ' ' unchanged, '-' removed, '+' added
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff renders the change from before to after as a unified diff of path, capped at
+// maxDiffLines. It returns "" when the contents have the same lines.
+func unifiedDiff(path, before, after string) string {
+	ops := diffLines(splitLines(before), splitLines(after))
+
+	var changes []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	out := []string{"--- " + path, "+++ " + path}
+	for start := 0; start < len(changes); {
+		// Changes closer than twice the context share a hunk
+		end := start
+		for end+1 < len(changes) && changes[end+1]-changes[end] <= 2*diffContext {
+			end++
+		}
+		from := max(changes[start]-diffContext, 0)
+		to := min(changes[end]+diffContext+1, len(ops))
+		out = append(out, hunkLines(ops, from, to)...)
+		start = end + 1
+	}
+
+	if len(out) > maxDiffLines {
+		more := len(out) - maxDiffLines
+		out = append(out[:maxDiffLines], fmt.Sprintf("... diff truncated (%d more lines)", more))
+	}
+	return strings.Join(out, "\n")
+}
+
+// hunkLines renders ops[from:to] with its @@ header
+func hunkLines(ops []diffOp, from, to int) []string {
+	oldStart, newStart := 1, 1
+	for _, op := range ops[:from] {
+		if op.kind != '+' {
+			oldStart++
+		}
+		if op.kind != '-' {
+			newStart++
+		}
+	}
+	oldCount, newCount := 0, 0
+	body := make([]string, 0, to-from)
+	for _, op := range ops[from:to] {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+		body = append(body, string(op.kind)+op.text)
+	}
+	// An empty range is numbered by the line before it
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+	header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart, oldCount, newStart, newCount)
+	return append([]string{header}, body...)
+}
+
+// splitLines splits text into lines, ignoring a final newline
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines computes a line diff. Common leading and trailing lines are matched first, so
+// the usual small edit to a big file only runs the LCS over the changed region.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// diffMiddle diffs the changed region with a longest-common-subsequence table
+func diffMiddle(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	var ops []diffOp
+	if n*m > maxDiffCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case j < m && (i == n || lcs[i][j+1] > lcs[i+1][j]):
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		default:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		}
+	}
+	return ops
+}
@@ -0,0 +1,224 @@
+package tools
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile names the gitignore-syntax file, read from the working directory, that lists
+// paths recursive tools skip
+const IgnoreFile = ".clippyignore"
+
+// gitIgnoreFile is git's own ignore file; recursive tools honor the nearest one too
+const gitIgnoreFile = ".gitignore"
+
+// defaultIgnores are skipped even without an IgnoreFile: VCS metadata, dependencies, and build output
+var defaultIgnores = []string{
+	".git/", ".hg/", ".svn/",
+	"node_modules/", "vendor/", ".venv/", "venv/", "__pycache__/",
+	"dist/", "build/", "target/", "out/",
+	".idea/", ".vscode/", ".DS_Store",
+}
+
+// ignoreRule is one compiled gitignore pattern
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool   // "!pattern" re-includes what earlier rules ignored
+	dirOnly bool   // "pattern/" only matches directories
+	base    string // Directory the pattern is relative to: where its ignore file lives
+}
+
+// ignoreMatcher decides which paths recursive tools skip; later rules override earlier ones
+type ignoreMatcher struct {
+	rules []ignoreRule
+	base  string // Directory rules added without a file are relative to
+}
+
+// loadIgnores builds the matcher for walking root: the built-in ignores, then the nearest
+// .gitignore at or above root, then the working directory's IgnoreFile, which can override both
+func loadIgnores(root string, ws *Workspace) *ignoreMatcher {
+	base, _ := os.Getwd()
+	m := &ignoreMatcher{base: base}
+	for _, pattern := range defaultIgnores {
+		m.add(pattern)
+	}
+	if dir := nearestGitIgnore(root, ws); dir != "" {
+		m.addFile(filepath.Join(dir, gitIgnoreFile), dir)
+	}
+	m.addFile(filepath.Join(base, IgnoreFile), base)
+	return m
+}
+
+// nearestGitIgnore returns the closest directory at or above root holding a .gitignore, or
+// "" if there is none. It looks no higher than the top of the repository or the workspace,
+// and outside a repository a stray .gitignore isn't git's, so it doesn't count.
+func nearestGitIgnore(root string, ws *Workspace) string {
+	dir, err := filepath.Abs(root)
+	if err != nil {
+		return ""
+	}
+	found := ""
+	for {
+		if found == "" && ws.Check(dir) == nil {
+			if _, err := os.Stat(filepath.Join(dir, gitIgnoreFile)); err == nil {
+				found = dir
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return found
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// addFile adds each line of a gitignore-syntax file, relative to base. A missing file adds nothing.
+func (m *ignoreMatcher) addFile(path, base string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	saved := m.base
+	m.base = base
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m.add(scanner.Text())
+	}
+	m.base = saved
+}
+
+// add compiles a gitignore-syntax line, skipping blanks and comments
+func (m *ignoreMatcher) add(line string) {
+	pattern := strings.TrimRight(line, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return
+	}
+	var rule ignoreRule
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	// A slash anywhere but the end anchors the pattern to the base directory
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return
+	}
+
+	var re strings.Builder
+	if anchored {
+		re.WriteString("^")
+	} else {
+		re.WriteString("(^|/)")
+	}
+	re.WriteString(globRegexp(pattern))
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return
+	}
+	rule.re = compiled
+	rule.base = m.base
+	m.rules = append(m.rules, rule)
+}
+
+// globRegexp translates a slash-separated glob into an unanchored regular expression: "*" and
+// "?" stay within one path segment, and "**" spans any number of directories
+func globRegexp(pattern string) string {
+	var re strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			re.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			re.WriteString("[^/]*")
+		case pattern[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	return re.String()
+}
+
+// ignored reports whether path should be skipped
+func (m *ignoreMatcher) ignored(path string, isDir bool) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	// Most rules share a base, so each relative path is worked out once
+	rels := make(map[string]string)
+	relTo := func(base string) string {
+		if rel, ok := rels[base]; ok {
+			return rel
+		}
+		rel := path
+		if r, err := filepath.Rel(base, abs); err == nil && !strings.HasPrefix(r, "..") {
+			rel = r
+		}
+		rel = filepath.ToSlash(rel)
+		rels[base] = rel
+		return rel
+	}
+
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(relTo(rule.base)) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// walkFiles calls fn for every regular file under root, skipping ignored paths unless
+// includeIgnored. ws bounds the search for a .gitignore (nil for none).
+func walkFiles(root string, ws *Workspace, includeIgnored bool, fn func(path string) error) error {
+	var ignores *ignoreMatcher
+	if !includeIgnored {
+		ignores = loadIgnores(root, ws)
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// An unreadable subdirectory shouldn't sink the whole walk
+			return nil
+		}
+		// The root was asked for explicitly, so it's never skipped
+		if ignores != nil && path != root && ignores.ignored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return fn(path)
+	})
+}
@@ -0,0 +1,400 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ApplyPatchTool applies a unified diff to one or more files
+type ApplyPatchTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+	Trash     string     // Directory patched and deleted files are saved to first ("" keeps no copy)
+}
+
+func (t ApplyPatchTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "apply_patch",
+		Description: "Apply a unified diff (as produced by diff -u or git diff) to one or more files. More robust than edit_file for multi-line changes: hunks are located by their context even if line numbers are off, and whitespace differences in context lines are tolerated. Reports which hunks applied and which failed.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"patch": map[string]interface{}{
+					"type":        "string",
+					"description": "The unified diff, with ---/+++ file headers and @@ hunk headers. Use /dev/null as the old file to create a file, or as the new file to delete one",
+				},
+			},
+			"required": []string{"patch"},
+		},
+	}
+}
+
+func (t ApplyPatchTool) Execute(args map[string]interface{}) (string, error) {
+	return t.run(args, false)
+}
+
+// DryRun reports which hunks would apply, with the resulting diffs, without writing anything
+func (t ApplyPatchTool) DryRun(args map[string]interface{}) (string, error) {
+	return t.run(args, true)
+}
+
+func (t ApplyPatchTool) run(args map[string]interface{}, dryRun bool) (string, error) {
+	patch, ok := args["patch"].(string)
+	if !ok || strings.TrimSpace(patch) == "" {
+		return "", fmt.Errorf("missing or invalid 'patch' argument")
+	}
+
+	files, err := parsePatch(patch)
+	if err != nil {
+		return "", err
+	}
+	for _, fp := range files {
+		for _, path := range []string{fp.oldPath, fp.newPath} {
+			if path == "" {
+				continue
+			}
+			if err := t.Workspace.Check(path); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	var report strings.Builder
+	applied := 0
+	for _, fp := range files {
+		applied += applyFilePatch(fp, &report, dryRun, t.Trash)
+	}
+	if applied == 0 {
+		return "", fmt.Errorf("no hunks applied:\n%s", strings.TrimRight(report.String(), "\n"))
+	}
+	if dryRun {
+		return "Dry run: no files were changed\n" + strings.TrimRight(report.String(), "\n"), nil
+	}
+	return strings.TrimRight(report.String(), "\n"), nil
+}
+
+// PatchFiles lists the files a unified diff touches, for display
+func PatchFiles(patch string) []string {
+	files, err := parsePatch(patch)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, fp := range files {
+		paths = append(paths, fp.target())
+	}
+	return paths
+}
+
+// filePatch is the part of a diff that applies to one file. An empty oldPath creates the
+// file and an empty newPath deletes it.
+type filePatch struct {
+	oldPath, newPath string
+	hunks            []hunk
+}
+
+// target is the path the patched content ends up at (or the deleted file)
+func (fp filePatch) target() string {
+	if fp.newPath != "" {
+		return fp.newPath
+	}
+	return fp.oldPath
+}
+
+// hunk is one @@ section; each line keeps its ' ', '-' or '+' prefix
+type hunk struct {
+	header   string
+	oldStart int
+	lines    []string
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// parsePatch splits a unified diff into per-file hunks. Line counts in hunk headers are
+// ignored, since hand- and model-written diffs often get them wrong; a hunk runs until the
+// next hunk or file header.
+func parsePatch(patch string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	var files []filePatch
+	var cur *filePatch
+	var h *hunk
+
+	endHunk := func() {
+		if h == nil {
+			return
+		}
+		// Trailing blank lines are usually just the end of the message, not context
+		for len(h.lines) > 0 && h.lines[len(h.lines)-1] == " " {
+			h.lines = h.lines[:len(h.lines)-1]
+		}
+		cur.hunks = append(cur.hunks, *h)
+		h = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			endHunk()
+			files = append(files, filePatch{
+				oldPath: patchPath(line[4:], "a/"),
+				newPath: patchPath(lines[i+1][4:], "b/"),
+			})
+			cur = &files[len(files)-1]
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("hunk %q comes before any ---/+++ file header", line)
+			}
+			endHunk()
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("invalid hunk header %q", line)
+			}
+			start, _ := strconv.Atoi(m[1])
+			h = &hunk{header: m[0], oldStart: start}
+		case h != nil && line == "":
+			// Editors and models often strip the space from blank context lines
+			h.lines = append(h.lines, " ")
+		case h != nil && (line[0] == ' ' || line[0] == '-' || line[0] == '+'):
+			h.lines = append(h.lines, line)
+		case h != nil && line[0] == '\\':
+			// "\ No newline at end of file"
+		default:
+			// diff --git, index and other extended headers end the current hunk
+			endHunk()
+		}
+	}
+	endHunk()
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no ---/+++ file headers found; the patch must be a unified diff")
+	}
+	for _, fp := range files {
+		if fp.oldPath == "" && fp.newPath == "" {
+			return nil, fmt.Errorf("a file in the patch has /dev/null as both old and new path")
+		}
+		if len(fp.hunks) == 0 {
+			return nil, fmt.Errorf("no hunks for %s", fp.target())
+		}
+	}
+	return files, nil
+}
+
+// patchPath cleans a ---/+++ header path: drops a trailing timestamp, maps /dev/null to "",
+// and strips git's a/ or b/ prefix unless a file by the unstripped name exists
+func patchPath(header, prefix string) string {
+	path, _, _ := strings.Cut(header, "\t")
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, prefix) {
+		if _, err := os.Stat(path); err != nil {
+			path = path[len(prefix):]
+		}
+	}
+	return path
+}
+
+// applyFilePatch applies fp's hunks, writes the result, and reports each hunk's outcome to
+// report. Hunks that fail are skipped and the rest still apply. Returns how many applied.
+// In a dry run nothing is written and the report includes a diff of the result instead.
+func applyFilePatch(fp filePatch, report *strings.Builder, dryRun bool, trash string) int {
+	// Creating or renaming a file must not silently replace one that's already there
+	if fp.newPath != "" && fp.newPath != fp.oldPath {
+		if _, err := os.Stat(fp.newPath); err == nil {
+			fmt.Fprintf(report, "%s: already exists, not overwritten (delete it or patch it in place)\n", fp.newPath)
+			return 0
+		}
+	}
+
+	var original string
+	var lines []string
+	trailingNewline := true
+	if fp.oldPath != "" {
+		content, err := os.ReadFile(fp.oldPath)
+		if err != nil {
+			fmt.Fprintf(report, "%s: failed to read file: %v\n", fp.oldPath, err)
+			return 0
+		}
+		text := string(content)
+		original = text
+		trailingNewline = text == "" || strings.HasSuffix(text, "\n")
+		if text = strings.TrimSuffix(text, "\n"); text != "" {
+			lines = strings.Split(text, "\n")
+		}
+	}
+
+	var results []string
+	applied, offset := 0, 0
+	for i, h := range fp.hunks {
+		var ok bool
+		var at int
+		lines, at, ok = applyHunk(lines, h, offset)
+		if !ok {
+			results = append(results, fmt.Sprintf("  hunk %d (%s): failed, context not found", i+1, h.header))
+			continue
+		}
+		applied++
+		result := fmt.Sprintf("  hunk %d (%s): applied", i+1, h.header)
+		if drift := at - (h.oldStart - 1 + offset); drift != 0 && h.oldStart > 0 {
+			result += fmt.Sprintf(" at line %d (offset %+d)", at+1, drift)
+		}
+		results = append(results, result)
+		offset += hunkDelta(h)
+	}
+
+	target := fp.target()
+	switch {
+	case applied == 0:
+		fmt.Fprintf(report, "%s: 0/%d hunks applied, file unchanged\n", target, len(fp.hunks))
+	case fp.newPath == "" && applied < len(fp.hunks):
+		fmt.Fprintf(report, "%s: %d/%d hunks applied, file not deleted\n", target, applied, len(fp.hunks))
+		applied = 0
+	case fp.newPath == "" && dryRun:
+		fmt.Fprintf(report, "%s: would be deleted\n", target)
+	case fp.newPath == "":
+		if trash != "" {
+			saved, err := moveToTrash(trash, fp.oldPath)
+			if err != nil {
+				fmt.Fprintf(report, "%s: failed to delete file: %v\n", target, err)
+				return 0
+			}
+			fmt.Fprintf(report, "%s: deleted (moved to %s)\n", target, saved)
+			break
+		}
+		if err := os.Remove(fp.oldPath); err != nil {
+			fmt.Fprintf(report, "%s: failed to delete file: %v\n", target, err)
+			return 0
+		}
+		fmt.Fprintf(report, "%s: deleted\n", target)
+	default:
+		content := strings.Join(lines, "\n")
+		if trailingNewline && len(lines) > 0 {
+			content += "\n"
+		}
+		if dryRun {
+			fmt.Fprintf(report, "%s: %d/%d hunks would apply\n", target, applied, len(fp.hunks))
+			for _, r := range results {
+				report.WriteString(r + "\n")
+			}
+			report.WriteString(unifiedDiff(target, original, content) + "\n")
+			return applied
+		}
+		saved := ""
+		if trash != "" && fp.oldPath != "" {
+			var err error
+			if saved, err = copyToTrash(trash, fp.oldPath); err != nil {
+				fmt.Fprintf(report, "%s: %v\n", target, err)
+				return 0
+			}
+		}
+		if dir := filepath.Dir(fp.newPath); dir != "." {
+			os.MkdirAll(dir, 0755)
+		}
+		if err := os.WriteFile(fp.newPath, []byte(content), 0644); err != nil {
+			fmt.Fprintf(report, "%s: failed to write file: %v\n", target, err)
+			return 0
+		}
+		if fp.oldPath != "" && fp.oldPath != fp.newPath {
+			os.Remove(fp.oldPath)
+		}
+		fmt.Fprintf(report, "%s: %d/%d hunks applied", target, applied, len(fp.hunks))
+		if saved != "" {
+			fmt.Fprintf(report, "; original saved to %s", saved)
+		}
+		report.WriteString("\n")
+	}
+	for _, r := range results {
+		report.WriteString(r + "\n")
+	}
+	return applied
+}
+
+// hunkDelta is how many lines a hunk adds (negative if it removes more than it adds)
+func hunkDelta(h hunk) int {
+	delta := 0
+	for _, l := range h.lines {
+		switch l[0] {
+		case '+':
+			delta++
+		case '-':
+			delta--
+		}
+	}
+	return delta
+}
+
+// applyHunk finds where h's context and removed lines sit in lines, starting at the line the
+// header names (shifted by earlier hunks) and searching outward, first for an exact match and
+// then ignoring whitespace. Context lines keep the file's version; removed lines are dropped
+// and added lines inserted. Returns the new lines and the index the hunk applied at.
+func applyHunk(lines []string, h hunk, offset int) ([]string, int, bool) {
+	var old []string
+	for _, l := range h.lines {
+		if l[0] != '+' {
+			old = append(old, l[1:])
+		}
+	}
+
+	expected := max(h.oldStart-1, 0) + offset
+	if len(old) == 0 {
+		// Pure insertion: there's nothing to match, so trust the line number. A zero-length
+		// old range names the line to insert after.
+		if h.oldStart > 0 && len(lines) > 0 {
+			expected++
+		}
+		expected = min(max(expected, 0), len(lines))
+		return splice(lines, h, expected), expected, true
+	}
+
+	for _, equal := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool {
+			return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+		},
+	} {
+		for d := 0; d <= len(lines); d++ {
+			for _, at := range []int{expected - d, expected + d} {
+				if at >= 0 && at+len(old) <= len(lines) && matchesAt(lines, at, old, equal) {
+					return splice(lines, h, at), at, true
+				}
+				if d == 0 {
+					break
+				}
+			}
+		}
+	}
+	return lines, 0, false
+}
+
+func matchesAt(lines []string, at int, old []string, equal func(a, b string) bool) bool {
+	for i, l := range old {
+		if !equal(lines[at+i], l) {
+			return false
+		}
+	}
+	return true
+}
+
+// splice replaces the lines h covers starting at at with h's new version
+func splice(lines []string, h hunk, at int) []string {
+	out := append([]string(nil), lines[:at]...)
+	i := at
+	for _, l := range h.lines {
+		switch l[0] {
+		case ' ':
+			out = append(out, lines[i])
+			i++
+		case '-':
+			i++
+		case '+':
+			out = append(out, l[1:])
+		}
+	}
+	return append(out, lines[i:]...)
+}
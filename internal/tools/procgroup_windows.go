@@ -0,0 +1,13 @@
+//go:build windows
+
+package tools
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows, which has no process groups to signal
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command; its children may outlive it on Windows
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
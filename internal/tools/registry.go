@@ -0,0 +1,31 @@
+package tools
+
+import "fmt"
+
+// Registry collects the tools an agent offers, so callers can add their own without
+// editing the agent. Names are unique, since a call is dispatched to a tool by name.
+type Registry struct {
+	tools []Tool
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a tool, rejecting names that are already taken
+func (r *Registry) Register(tool Tool) error {
+	name := tool.Definition().Name
+	for _, t := range r.tools {
+		if t.Definition().Name == name {
+			return fmt.Errorf("duplicate tool name: %s", name)
+		}
+	}
+	r.tools = append(r.tools, tool)
+	return nil
+}
+
+// All returns the registered tools in the order they were added
+func (r *Registry) All() []Tool {
+	return append([]Tool(nil), r.tools...)
+}
@@ -1,10 +1,24 @@
 package tools
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // ToolDefinition describes a tool to the LLM
@@ -20,8 +34,82 @@ type Tool interface {
 	Execute(args map[string]interface{}) (string, error)
 }
 
+// Streamer is implemented by tools that can report output line by line while they run, for
+// long commands. The result is the same as Execute's.
+type Streamer interface {
+	ExecuteStream(args map[string]interface{}, onLine func(line string)) (string, error)
+}
+
+// DryRunner is implemented by mutating tools that can describe a call's effect without
+// carrying it out, for dry-run mode
+type DryRunner interface {
+	DryRun(args map[string]interface{}) (string, error)
+}
+
+// destructiveTools lists the tools that can destroy data or run arbitrary code, so the user
+// should approve each call
+var destructiveTools = map[string]bool{
+	"write_file":     true,
+	"edit_file":      true,
+	"append_to_file": true,
+	"apply_patch":    true,
+	"delete_file":    true,
+	"move_file":      true,
+	"run_command":    true,
+}
+
+// IsDestructive reports whether calls to the named tool need the user's approval
+func IsDestructive(name string) bool {
+	return destructiveTools[name]
+}
+
+// readOnlyTools lists the built-in tools known to leave the filesystem alone. It's an
+// allow-list, so a tool added with RegisterTool or a custom Registry counts as mutating
+// until it's listed here.
+var readOnlyTools = map[string]bool{
+	"read_file":             true,
+	"read_file_lines":       true,
+	"list_directory":        true,
+	"search_files":          true,
+	"count_matches":         true,
+	"find_files":            true,
+	"file_stat":             true,
+	"get_current_directory": true,
+	"git_status":            true,
+	"git_diff":              true,
+	"git_log":               true,
+	"git_show":              true,
+	"fetch_url":             true,
+}
+
+// IsMutating reports whether the named tool may change anything, so read-only mode withholds
+// it and it never runs alongside other calls. Unknown tools are assumed to.
+func IsMutating(name string) bool {
+	return !readOnlyTools[name]
+}
+
+// ReadOnlyTool is implemented by tools that never change anything. A registered tool
+// implements it to be offered in read-only mode and to run alongside other reads.
+type ReadOnlyTool interface {
+	ReadOnly() bool
+}
+
+// Mutates is IsMutating for a tool value, honoring ReadOnlyTool
+func Mutates(t Tool) bool {
+	if ro, ok := t.(ReadOnlyTool); ok {
+		return !ro.ReadOnly()
+	}
+	return IsMutating(t.Definition().Name)
+}
+
+// DefaultMaxReadBytes caps how much of a file read_file returns when no limit is set
+const DefaultMaxReadBytes = 256 << 10 // 256KB
+
 // ReadFileTool reads a file from disk
-type ReadFileTool struct{}
+type ReadFileTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+	MaxBytes  int        // Largest content returned before truncating (0 means DefaultMaxReadBytes)
+}
 
 func (t ReadFileTool) Definition() ToolDefinition {
 	return ToolDefinition{
@@ -34,6 +122,10 @@ func (t ReadFileTool) Definition() ToolDefinition {
 					"type":        "string",
 					"description": "The path to the file to read",
 				},
+				"allow_binary": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Return the raw content even if the file looks binary",
+				},
 			},
 			"required": []string{"path"},
 		},
@@ -46,21 +138,97 @@ func (t ReadFileTool) Execute(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("missing or invalid 'path' argument")
 	}
 
-	content, err := os.ReadFile(path)
+	if err := t.Workspace.Check(path); err != nil {
+		return "", err
+	}
+
+	maxBytes := t.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxReadBytes
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	// Only read what can be returned, so a huge file never has to fit in memory
+	content, err := io.ReadAll(io.LimitReader(f, int64(maxBytes)))
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %v", err)
 	}
 
+	allowBinary, _ := args["allow_binary"].(bool)
+	if !allowBinary && looksBinary(content) {
+		return fmt.Sprintf("File appears to be binary (%d bytes), not reading. Set allow_binary to read the raw bytes anyway.", info.Size()), nil
+	}
+
+	if info.Size() > int64(len(content)) {
+		if !allowBinary {
+			content = trimPartialRune(content)
+		}
+		return fmt.Sprintf("%s\n\n[File truncated: showing the first %d of %d bytes. Use read_file_lines to read the rest in ranges.]", content, len(content), info.Size()), nil
+	}
 	return string(content), nil
 }
 
+// binarySniffLen is how much of a file looksBinary inspects
+const binarySniffLen = 512
+
+// looksBinary reports whether the start of data contains a null byte or isn't valid UTF-8
+func looksBinary(data []byte) bool {
+	head := data[:min(len(data), binarySniffLen)]
+	if isBinary(head) {
+		return true
+	}
+	// Don't count a multi-byte character cut off by the sniff length as invalid
+	if len(head) < len(data) {
+		head = trimPartialRune(head)
+	}
+	return !utf8.Valid(head)
+}
+
+// trimPartialRune drops an incomplete UTF-8 character from the end of b
+func trimPartialRune(b []byte) []byte {
+	for i := len(b) - 1; i >= max(len(b)-utf8.UTFMax, 0); i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return b[:i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// DefaultMaxWriteBytes caps content written by write_file and append_to_file when no limit is set
+const DefaultMaxWriteBytes = 10 << 20 // 10MB
+
+// checkWriteSize refuses content larger than limit (0 means DefaultMaxWriteBytes)
+func checkWriteSize(content string, limit int) error {
+	if limit <= 0 {
+		limit = DefaultMaxWriteBytes
+	}
+	if len(content) > limit {
+		return fmt.Errorf("content is %d bytes, which exceeds the %d byte write limit; split it into smaller files", len(content), limit)
+	}
+	return nil
+}
+
 // WriteFileTool writes content to a file
-type WriteFileTool struct{}
+type WriteFileTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+	MaxBytes  int        // Largest content accepted (0 means DefaultMaxWriteBytes)
+}
 
 func (t WriteFileTool) Definition() ToolDefinition {
 	return ToolDefinition{
 		Name:        "write_file",
-		Description: "Write content to a file (overwrites existing content)",
+		Description: "Write content to a file (overwrites existing content, keeping a copy of the old file at <path>.bak unless backup is false)",
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
@@ -72,6 +240,10 @@ func (t WriteFileTool) Definition() ToolDefinition {
 					"type":        "string",
 					"description": "The content to write to the file",
 				},
+				"backup": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Copy an existing file to <path>.bak before overwriting it (default true)",
+				},
 			},
 			"required": []string{"path", "content"},
 		},
@@ -79,25 +251,83 @@ func (t WriteFileTool) Definition() ToolDefinition {
 }
 
 func (t WriteFileTool) Execute(args map[string]interface{}) (string, error) {
+	return t.run(args, false)
+}
+
+// DryRun describes the write, with a diff, without touching the file
+func (t WriteFileTool) DryRun(args map[string]interface{}) (string, error) {
+	return t.run(args, true)
+}
+
+func (t WriteFileTool) run(args map[string]interface{}, dryRun bool) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'path' argument")
 	}
+
+	if err := t.Workspace.Check(path); err != nil {
+		return "", err
+	}
+
 	content, ok := args["content"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'content' argument")
 	}
+	if err := checkWriteSize(content, t.MaxBytes); err != nil {
+		return "", err
+	}
+
+	before, readErr := os.ReadFile(path)
+	if dryRun {
+		if readErr != nil {
+			return withDiff(fmt.Sprintf("Dry run: would create %s", path), path, "", content), nil
+		}
+		return withDiff(fmt.Sprintf("Dry run: would write to %s", path), path, string(before), content), nil
+	}
+
+	msg := fmt.Sprintf("Successfully wrote to %s", path)
+	if backup, ok := args["backup"].(bool); readErr == nil && (backup || !ok) {
+		backupPath, err := backupFile(path)
+		if err != nil {
+			return "", err
+		}
+		msg += fmt.Sprintf(" (previous version backed up to %s)", backupPath)
+	}
 
 	err := os.WriteFile(path, []byte(content), 0644)
 	if err != nil {
 		return "", fmt.Errorf("failed to write file: %v", err)
 	}
 
-	return fmt.Sprintf("Successfully wrote to %s", path), nil
+	if readErr != nil {
+		return withDiff(msg+" (new file)", path, "", content), nil
+	}
+	return withDiff(msg, path, string(before), content), nil
 }
 
+// DefaultCommandTimeout is how long run_command waits when no timeout is configured
+const DefaultCommandTimeout = 30 * time.Second
+
+// DefaultMaxCommandOutput caps the output run_command captures when no limit is set
+const DefaultMaxCommandOutput = 50 << 10 // 50KB
+
+// outputTruncatedMarker ends output that hit the capture limit
+const outputTruncatedMarker = "\n[output truncated]"
+
+// timeoutRetryFactor scales the timeout for the automatic retry after a timeout
+const timeoutRetryFactor = 4
+
+// DefaultBlockedCommands are refused by run_command in addition to any configured deny list
+var DefaultBlockedCommands = []string{"rm -rf /", "shutdown", "reboot", "halt", "poweroff", "mkfs", "dd if=", ":(){"}
+
 // RunCommandTool executes a shell command
-type RunCommandTool struct{}
+type RunCommandTool struct {
+	Timeout        time.Duration // Default per-command timeout (0 means DefaultCommandTimeout)
+	RetryOnTimeout bool          // Retry once with a longer timeout when a command times out
+	MaxOutputBytes int           // Output captured before truncating (0 means DefaultMaxCommandOutput)
+	Blocked        []string      // Command prefixes refused on top of DefaultBlockedCommands
+	Allowed        []string      // If non-empty, only commands starting with one of these prefixes run
+}
 
 func (t RunCommandTool) Definition() ToolDefinition {
 	return ToolDefinition{
@@ -110,6 +340,10 @@ func (t RunCommandTool) Definition() ToolDefinition {
 					"type":        "string",
 					"description": "The command to execute",
 				},
+				"timeout": map[string]interface{}{
+					"type":        "number",
+					"description": "Optional timeout in seconds for long-running commands",
+				},
 			},
 			"required": []string{"command"},
 		},
@@ -117,13 +351,60 @@ func (t RunCommandTool) Definition() ToolDefinition {
 }
 
 func (t RunCommandTool) Execute(args map[string]interface{}) (string, error) {
+	return t.run(args, false, nil)
+}
+
+// ExecuteStream runs the command like Execute, passing each line of output to onLine as it's printed
+func (t RunCommandTool) ExecuteStream(args map[string]interface{}, onLine func(line string)) (string, error) {
+	return t.run(args, false, onLine)
+}
+
+// DryRun reports the command without running it
+func (t RunCommandTool) DryRun(args map[string]interface{}) (string, error) {
+	return t.run(args, true, nil)
+}
+
+func (t RunCommandTool) run(args map[string]interface{}, dryRun bool, onLine func(string)) (string, error) {
 	command, ok := args["command"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'command' argument")
 	}
 
-	cmd := exec.Command("sh", "-c", command)
-	output, err := cmd.CombinedOutput()
+	if reason := t.checkPolicy(command); reason != "" {
+		return fmt.Sprintf("Command blocked: %s. Try a different approach or ask the user to run it.", reason), nil
+	}
+	if dryRun {
+		return fmt.Sprintf("Dry run: would run command: %s", command), nil
+	}
+
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	if seconds, ok := args["timeout"].(float64); ok && seconds > 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	maxOutput := t.MaxOutputBytes
+	if maxOutput <= 0 {
+		maxOutput = DefaultMaxCommandOutput
+	}
+
+	output, timedOut, err := runShell(command, timeout, maxOutput, onLine)
+	retried := false
+	if timedOut && t.RetryOnTimeout {
+		timeout *= timeoutRetryFactor
+		retried = true
+		output, timedOut, err = runShell(command, timeout, maxOutput, onLine)
+	}
+
+	if timedOut {
+		msg := fmt.Sprintf("Command timed out after %s and was killed; consider a longer timeout or a non-blocking command", timeout)
+		if retried {
+			msg += " (already retried once with a longer timeout)"
+		}
+		return fmt.Sprintf("%s\nOutput before timeout:\n%s", msg, string(output)), nil
+	}
 	if err != nil {
 		return fmt.Sprintf("Command failed: %v\nOutput:\n%s", err, string(output)), nil
 	}
@@ -131,8 +412,150 @@ func (t RunCommandTool) Execute(args map[string]interface{}) (string, error) {
 	return string(output), nil
 }
 
+// checkPolicy returns why command may not run, or "" if it may. Each part of a compound
+// command (split on ;, &, | and newlines) is checked separately so a blocked command
+// can't hide behind an allowed one. This is a guard against accidents, not a sandbox.
+func (t RunCommandTool) checkPolicy(command string) string {
+	segments := strings.FieldsFunc(command, func(r rune) bool {
+		return r == ';' || r == '&' || r == '|' || r == '\n'
+	})
+	for _, segment := range segments {
+		segment = strings.Join(strings.Fields(segment), " ")
+		if segment == "" {
+			continue
+		}
+		unprivileged := strings.TrimPrefix(segment, "sudo ")
+		for _, blocked := range append(DefaultBlockedCommands, t.Blocked...) {
+			if hasCommandPrefix(segment, blocked) || hasCommandPrefix(unprivileged, blocked) {
+				return fmt.Sprintf("%q matches the deny list entry %q", segment, blocked)
+			}
+		}
+		if len(t.Allowed) > 0 && !slices.ContainsFunc(t.Allowed, func(allowed string) bool {
+			return hasCommandPrefix(segment, allowed)
+		}) {
+			return fmt.Sprintf("%q is not in the allow list (%s)", segment, strings.Join(t.Allowed, ", "))
+		}
+	}
+
+	return ""
+}
+
+// hasCommandPrefix reports whether command starts with prefix on a word boundary, so
+// "mkfs" matches "mkfs.ext4 /dev/sda" and "rm -rf /" matches "rm -rf /*" but not "rm -rf /tmp/build"
+func hasCommandPrefix(command, prefix string) bool {
+	prefix = strings.Join(strings.Fields(prefix), " ")
+	if prefix == "" || !strings.HasPrefix(command, prefix) {
+		return false
+	}
+	rest := command[len(prefix):]
+	return rest == "" || !isWordByte(rest[0]) || !isWordByte(prefix[len(prefix)-1])
+}
+
+// isWordByte reports whether b can continue a command name or path
+func isWordByte(b byte) bool {
+	return b == '_' || b == '/' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
+
+// runShell runs command through sh, capturing at most maxOutput bytes of combined output and
+// reporting whether it was killed by the timeout. A timeout kills the whole process group, so
+// children the shell started can't keep running. If onLine is set it sees every line of
+// output as it arrives, including any past the capture limit.
+func runShell(command string, timeout time.Duration, maxOutput int, onLine func(string)) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	// Don't wait forever on pipes held open by children that outlive the shell
+	cmd.WaitDelay = time.Second
+
+	output := &cappedBuffer{limit: maxOutput}
+	var w io.Writer = output
+	if onLine != nil {
+		lines := &lineWriter{w: output, onLine: onLine}
+		defer lines.flush()
+		w = lines
+	}
+	// One writer for both means exec copies them through one pipe, so writes never interleave
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+
+	result := output.buf.Bytes()
+	if output.truncated {
+		result = append(result, outputTruncatedMarker...)
+	}
+	return result, ctx.Err() == context.DeadlineExceeded, err
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the rest, so a command
+// with endless output can't exhaust memory
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit - b.buf.Len(); n > room {
+		b.truncated = true
+		p = p[:max(room, 0)]
+	}
+	b.buf.Write(p)
+	// Report everything as written so the command keeps running until it finishes or times out
+	return n, nil
+}
+
+// maxStreamLineBytes caps how much of a line without a newline lineWriter holds before
+// reporting it anyway
+const maxStreamLineBytes = 4 << 10
+
+// lineWriter passes writes through to w and hands each complete line to onLine. A carriage
+// return ends a line too, so progress bars that redraw in place are reported as they go.
+type lineWriter struct {
+	w       io.Writer
+	onLine  func(string)
+	partial []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	n, err := l.w.Write(p)
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexAny(l.partial, "\r\n")
+		// A trailing \r may be half of a \r\n, so wait for the next write to tell
+		if i < 0 || (l.partial[i] == '\r' && i+1 == len(l.partial)) {
+			break
+		}
+		end := i + 1
+		if l.partial[i] == '\r' && l.partial[end] == '\n' {
+			end++
+		}
+		l.onLine(string(l.partial[:i]))
+		l.partial = l.partial[end:]
+	}
+	for len(l.partial) > maxStreamLineBytes {
+		l.onLine(string(l.partial[:maxStreamLineBytes]))
+		l.partial = l.partial[maxStreamLineBytes:]
+	}
+	return n, err
+}
+
+// flush reports output left after the last newline
+func (l *lineWriter) flush() {
+	if line := strings.TrimSuffix(string(l.partial), "\r"); line != "" {
+		l.onLine(line)
+	}
+	l.partial = nil
+}
+
 // EditFileTool edits a file by replacing a target string with replacement string
-type EditFileTool struct{}
+type EditFileTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+	Trash     string     // Directory the original is copied to before each edit ("" keeps no copy)
+}
 
 func (t EditFileTool) Definition() ToolDefinition {
 	return ToolDefinition{
@@ -153,6 +576,10 @@ func (t EditFileTool) Definition() ToolDefinition {
 					"type":        "string",
 					"description": "The new string to replace the target with",
 				},
+				"replace_all": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Replace every occurrence of target instead of only the first",
+				},
 			},
 			"required": []string{"path", "target", "replacement"},
 		},
@@ -160,12 +587,26 @@ func (t EditFileTool) Definition() ToolDefinition {
 }
 
 func (t EditFileTool) Execute(args map[string]interface{}) (string, error) {
+	return t.run(args, false)
+}
+
+// DryRun describes the edit, with a diff, without touching the file
+func (t EditFileTool) DryRun(args map[string]interface{}) (string, error) {
+	return t.run(args, true)
+}
+
+func (t EditFileTool) run(args map[string]interface{}, dryRun bool) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'path' argument")
 	}
+
+	if err := t.Workspace.Check(path); err != nil {
+		return "", err
+	}
+
 	target, ok := args["target"].(string)
-	if !ok {
+	if !ok || target == "" {
 		return "", fmt.Errorf("missing or invalid 'target' argument")
 	}
 	replacement, ok := args["replacement"].(string)
@@ -183,23 +624,63 @@ func (t EditFileTool) Execute(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("target string not found in file")
 	}
 
+	replacements := 1
 	newText := strings.Replace(text, target, replacement, 1)
+	if replaceAll, _ := args["replace_all"].(bool); replaceAll {
+		replacements = strings.Count(text, target)
+		newText = strings.ReplaceAll(text, target, replacement)
+	}
+
+	noun := "replacements"
+	if replacements == 1 {
+		noun = "replacement"
+	}
+	if dryRun {
+		return withDiff(fmt.Sprintf("Dry run: would edit %s (%d %s)", path, replacements, noun), path, text, newText), nil
+	}
+
+	msg := fmt.Sprintf("Successfully edited %s (%d %s)", path, replacements, noun)
+	if t.Trash != "" {
+		saved, err := copyToTrash(t.Trash, path)
+		if err != nil {
+			return "", err
+		}
+		msg += fmt.Sprintf("; original saved to %s", saved)
+	}
 
 	err = os.WriteFile(path, []byte(newText), 0644)
 	if err != nil {
 		return "", fmt.Errorf("failed to write file: %v", err)
 	}
 
-	return fmt.Sprintf("Successfully edited %s", path), nil
+	return withDiff(msg, path, text, newText), nil
+}
+
+// withDiff appends a preview of the change to a tool's success message
+func withDiff(msg, path, before, after string) string {
+	diff := unifiedDiff(path, before, after)
+	if diff == "" {
+		return msg + " (no changes)"
+	}
+	return msg + "\n\n" + diff
 }
 
+// DefaultMaxListEntries is the entry cap used when ListDirectoryTool.MaxEntries is unset
+const DefaultMaxListEntries = 500
+
+// DefaultListDepth is how many levels a recursive listing descends when max_depth is unset
+const DefaultListDepth = 3
+
 // ListDirectoryTool lists files and directories in a path
-type ListDirectoryTool struct{}
+type ListDirectoryTool struct {
+	Workspace  *Workspace // Paths must stay inside this tree (nil allows any path)
+	MaxEntries int        // Maximum number of entries to return (0 means DefaultMaxListEntries)
+}
 
 func (t ListDirectoryTool) Definition() ToolDefinition {
 	return ToolDefinition{
 		Name:        "list_directory",
-		Description: "List all files and subdirectories in a directory",
+		Description: "List files and subdirectories in a directory, optionally sorted and filtered by a glob. Set recursive to see the whole tree in one call",
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
@@ -207,6 +688,24 @@ func (t ListDirectoryTool) Definition() ToolDefinition {
 					"type":        "string",
 					"description": "The directory path to list (use '.' for current directory)",
 				},
+				"sort": map[string]interface{}{
+					"type":        "string",
+					"enum":        []string{"name", "size", "mtime"},
+					"description": "Sort order: name (alphabetical, default), size (largest first), or mtime (newest first)",
+				},
+				"filter": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional glob matched against entry names (e.g. '*.go'); in a recursive listing it applies to files only",
+				},
+				"recursive": map[string]interface{}{
+					"type":        "boolean",
+					"description": "List subdirectories too, as an indented tree in name order (sort is ignored)",
+				},
+				"max_depth": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("How many levels a recursive listing descends (default %d; 1 lists only the directory itself)", DefaultListDepth),
+				},
+				"include_ignored": includeIgnoredParam,
 			},
 			"required": []string{"path"},
 		},
@@ -219,26 +718,159 @@ func (t ListDirectoryTool) Execute(args map[string]interface{}) (string, error)
 		return "", fmt.Errorf("missing or invalid 'path' argument")
 	}
 
+	if err := t.Workspace.Check(path); err != nil {
+		return "", err
+	}
+
+	sortBy, _ := args["sort"].(string)
+	filter, _ := args["filter"].(string)
+	if filter != "" {
+		if _, err := filepath.Match(filter, ""); err != nil {
+			return "", fmt.Errorf("invalid filter pattern: %v", err)
+		}
+	}
+	if recursive, _ := args["recursive"].(bool); recursive {
+		depth := DefaultListDepth
+		if d, ok := args["max_depth"].(float64); ok && d >= 1 {
+			depth = int(d)
+		}
+		includeIgnored, _ := args["include_ignored"].(bool)
+		return t.listTree(path, filter, depth, includeIgnored)
+	}
+
 	entries, err := os.ReadDir(path)
 	if err != nil {
 		return "", fmt.Errorf("failed to read directory: %v", err)
 	}
 
+	var infos []fs.FileInfo
+	for _, entry := range entries {
+		if filter != "" {
+			matched, err := filepath.Match(filter, entry.Name())
+			if err != nil {
+				return "", fmt.Errorf("invalid filter pattern: %v", err)
+			}
+			if !matched {
+				continue
+			}
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	switch sortBy {
+	case "", "name":
+		// os.ReadDir already returns entries sorted by name
+	case "size":
+		sort.SliceStable(infos, func(i, j int) bool { return infos[i].Size() > infos[j].Size() })
+	case "mtime":
+		sort.SliceStable(infos, func(i, j int) bool { return infos[i].ModTime().After(infos[j].ModTime()) })
+	default:
+		return "", fmt.Errorf("invalid sort %q (use name, size, or mtime)", sortBy)
+	}
+
+	maxEntries := t.maxEntries()
+
 	var result strings.Builder
 	result.WriteString(fmt.Sprintf("Contents of %s:\n", path))
-	for _, entry := range entries {
-		if entry.IsDir() {
-			result.WriteString(fmt.Sprintf("  [DIR]  %s\n", entry.Name()))
+	for i, info := range infos {
+		if i >= maxEntries {
+			result.WriteString(fmt.Sprintf("  …and %d more (use filter to narrow results)\n", len(infos)-maxEntries))
+			break
+		}
+		if info.IsDir() {
+			result.WriteString(fmt.Sprintf("  [DIR]  %s\n", info.Name()))
 		} else {
-			info, _ := entry.Info()
-			result.WriteString(fmt.Sprintf("  [FILE] %s (%d bytes)\n", entry.Name(), info.Size()))
+			result.WriteString(fmt.Sprintf("  [FILE] %s (%d bytes)\n", info.Name(), info.Size()))
 		}
 	}
+
 	return result.String(), nil
 }
 
+func (t ListDirectoryTool) maxEntries() int {
+	if t.MaxEntries > 0 {
+		return t.MaxEntries
+	}
+	return DefaultMaxListEntries
+}
+
+// listTree renders root's tree down to depth levels, indenting each level, skipping ignored
+// paths unless includeIgnored. Past maxEntries the rest are only counted.
+func (t ListDirectoryTool) listTree(root, filter string, depth int, includeIgnored bool) (string, error) {
+	var ignores *ignoreMatcher
+	if !includeIgnored {
+		ignores = loadIgnores(root, t.Workspace)
+	}
+	maxEntries := t.maxEntries()
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Contents of %s (depth %d):\n", root, depth))
+	listed, more := 0, 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// An unreadable subdirectory shouldn't sink the whole listing
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		level := strings.Count(filepath.ToSlash(rel), "/")
+		if ignores != nil && ignores.ignored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && filter != "" {
+			if matched, _ := filepath.Match(filter, d.Name()); !matched {
+				return nil
+			}
+		}
+
+		if listed >= maxEntries {
+			more++
+		} else {
+			indent := strings.Repeat("  ", level+1)
+			if d.IsDir() {
+				result.WriteString(fmt.Sprintf("%s[DIR]  %s/\n", indent, d.Name()))
+			} else if info, err := d.Info(); err == nil {
+				result.WriteString(fmt.Sprintf("%s[FILE] %s (%d bytes)\n", indent, d.Name(), info.Size()))
+			}
+			listed++
+		}
+
+		if d.IsDir() && level+1 >= depth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %v", err)
+	}
+	if more > 0 {
+		result.WriteString(fmt.Sprintf("  …and %d more (use max_depth or filter to narrow results)\n", more))
+	}
+	return result.String(), nil
+}
+
+// includeIgnoredParam is the schema for the override that searches paths in IgnoreFile and the built-in ignores
+var includeIgnoredParam = map[string]interface{}{
+	"type":        "boolean",
+	"description": "Also search paths that are normally skipped (.git, node_modules, vendor, build output, and .gitignore and .clippyignore entries)",
+}
+
 // SearchFilesTool searches for text patterns in files
-type SearchFilesTool struct{}
+type SearchFilesTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+}
 
 func (t SearchFilesTool) Definition() ToolDefinition {
 	return ToolDefinition{
@@ -253,8 +885,13 @@ func (t SearchFilesTool) Definition() ToolDefinition {
 				},
 				"pattern": map[string]interface{}{
 					"type":        "string",
-					"description": "The text pattern to search for",
+					"description": "The text to search for (matched literally unless regex is set)",
+				},
+				"regex": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Treat pattern as a Go regular expression",
 				},
+				"include_ignored": includeIgnoredParam,
 			},
 			"required": []string{"path", "pattern"},
 		},
@@ -266,25 +903,273 @@ func (t SearchFilesTool) Execute(args map[string]interface{}) (string, error) {
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'path' argument")
 	}
+
+	if err := t.Workspace.Check(path); err != nil {
+		return "", err
+	}
+
 	pattern, ok := args["pattern"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'pattern' argument")
 	}
 
-	cmd := exec.Command("grep", "-r", "-n", pattern, path)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// grep returns exit code 1 if no matches found
-		if len(output) == 0 {
-			return "No matches found", nil
+	match := func(line string) bool { return strings.Contains(line, pattern) }
+	if useRegex, _ := args["regex"].(bool); useRegex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid regex %q: %v", pattern, err)
+		}
+		match = re.MatchString
+	}
+
+	includeIgnored, _ := args["include_ignored"].(bool)
+
+	var output strings.Builder
+	var incomplete []string
+	err := walkFiles(path, t.Workspace, includeIgnored, func(file string) error {
+		// Unreadable files and overlong lines don't fail the whole search, but are reported
+		if err := searchFile(file, match, &output); err != nil {
+			incomplete = append(incomplete, fmt.Sprintf("%s (%v)", file, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to walk directory: %v", err)
+	}
+
+	if output.Len() == 0 {
+		output.WriteString("No matches found")
+	}
+	if len(incomplete) > 0 {
+		fmt.Fprintf(&output, "\n[Not fully searched: %s]", strings.Join(incomplete, ", "))
+	}
+
+	return output.String(), nil
+}
+
+// maxSearchLine is the longest line search_files reads; minified files can go past it
+const maxSearchLine = 1024 * 1024
+
+// searchFile writes each line of path that satisfies match to out as path:lineno:line,
+// skipping binary files. A line longer than maxSearchLine stops the search of that file
+// with an error.
+func searchFile(path string, match func(string) bool, out *strings.Builder) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	head, _ := reader.Peek(512)
+	if isBinary(head) {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSearchLine)
+	lineNo := 1
+	for ; scanner.Scan(); lineNo++ {
+		if line := scanner.Text(); match(line) {
+			fmt.Fprintf(out, "%s:%d:%s\n", path, lineNo, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("stopped at line %d: %v", lineNo, err)
+	}
+	return nil
+}
+
+// CountMatchesTool counts occurrences of a text pattern in files without returning the lines
+type CountMatchesTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+}
+
+func (t CountMatchesTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "count_matches",
+		Description: "Count occurrences of a text pattern in files within a directory (recursive), returning per-file and total counts instead of the matching lines",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The directory to search in",
+				},
+				"pattern": map[string]interface{}{
+					"type":        "string",
+					"description": "The text pattern to count",
+				},
+				"include_ignored": includeIgnoredParam,
+			},
+			"required": []string{"path", "pattern"},
+		},
+	}
+}
+
+func (t CountMatchesTool) Execute(args map[string]interface{}) (string, error) {
+	root, ok := args["path"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing or invalid 'path' argument")
+	}
+
+	if err := t.Workspace.Check(root); err != nil {
+		return "", err
+	}
+
+	pattern, ok := args["pattern"].(string)
+	if !ok || pattern == "" {
+		return "", fmt.Errorf("missing or invalid 'pattern' argument")
+	}
+
+	includeIgnored, _ := args["include_ignored"].(bool)
+
+	var result strings.Builder
+	total := 0
+	files := 0
+	err := walkFiles(root, t.Workspace, includeIgnored, func(path string) error {
+		count, err := countInFile(path, pattern)
+		if err != nil || count == 0 {
+			// Unreadable and binary files are skipped rather than failing the whole count
+			return nil
+		}
+		result.WriteString(fmt.Sprintf("%s: %d\n", path, count))
+		total += count
+		files++
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to walk directory: %v", err)
+	}
+
+	if total == 0 {
+		return "No matches found", nil
+	}
+	result.WriteString(fmt.Sprintf("Total: %d matches in %d files", total, files))
+	return result.String(), nil
+}
+
+// countInFile counts pattern occurrences in a single file, returning 0 for binary files
+func countInFile(path, pattern string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	head, _ := reader.Peek(512)
+	if isBinary(head) {
+		return 0, nil
+	}
+
+	count := 0
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		count += strings.Count(scanner.Text(), pattern)
+	}
+	return count, scanner.Err()
+}
+
+// isBinary reports whether data looks like binary content (contains a null byte)
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// DefaultMaxFindResults caps the paths find_files returns when FindFilesTool.MaxResults is unset
+const DefaultMaxFindResults = 200
+
+// FindFilesTool finds files whose paths match a glob pattern
+type FindFilesTool struct {
+	Workspace  *Workspace // Paths must stay inside this tree (nil allows any path)
+	MaxResults int        // Maximum number of paths to return (0 means DefaultMaxFindResults)
+}
+
+func (t FindFilesTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "find_files",
+		Description: "Find files by name or path pattern (recursive), e.g. **/*.go or internal/**/*_test.go",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"root": map[string]interface{}{
+					"type":        "string",
+					"description": "The directory to search from",
+				},
+				"pattern": map[string]interface{}{
+					"type":        "string",
+					"description": "Glob relative to root; * and ? match within a path segment and ** matches any number of directories. A pattern without a slash matches file names at any depth",
+				},
+				"include_ignored": includeIgnoredParam,
+			},
+			"required": []string{"root", "pattern"},
+		},
+	}
+}
+
+func (t FindFilesTool) Execute(args map[string]interface{}) (string, error) {
+	root, ok := args["root"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing or invalid 'root' argument")
+	}
+
+	if err := t.Workspace.Check(root); err != nil {
+		return "", err
+	}
+
+	pattern, ok := args["pattern"].(string)
+	if !ok || pattern == "" {
+		return "", fmt.Errorf("missing or invalid 'pattern' argument")
+	}
+	includeIgnored, _ := args["include_ignored"].(bool)
+
+	// Same rule as IgnoreFile: only a pattern containing a slash is anchored to root
+	prefix := "(^|/)"
+	if strings.Contains(pattern, "/") {
+		prefix = "^"
+	}
+	re, err := regexp.Compile(prefix + globRegexp(strings.TrimPrefix(pattern, "/")) + "$")
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+
+	maxResults := t.MaxResults
+	if maxResults <= 0 {
+		maxResults = DefaultMaxFindResults
+	}
+
+	var matches []string
+	total := 0
+	err = walkFiles(root, t.Workspace, includeIgnored, func(path string) error {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || !re.MatchString(filepath.ToSlash(rel)) {
+			return nil
 		}
+		total++
+		if len(matches) < maxResults {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to walk directory: %v", err)
 	}
 
-	return string(output), nil
+	if total == 0 {
+		return "No files found", nil
+	}
+	result := strings.Join(matches, "\n")
+	if total > len(matches) {
+		result += fmt.Sprintf("\n... and %d more (showing first %d; narrow the pattern or root)", total-len(matches), len(matches))
+	}
+	return result, nil
 }
 
 // CreateDirectoryTool creates a new directory
-type CreateDirectoryTool struct{}
+type CreateDirectoryTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+}
 
 func (t CreateDirectoryTool) Definition() ToolDefinition {
 	return ToolDefinition{
@@ -304,11 +1189,28 @@ func (t CreateDirectoryTool) Definition() ToolDefinition {
 }
 
 func (t CreateDirectoryTool) Execute(args map[string]interface{}) (string, error) {
+	return t.run(args, false)
+}
+
+// DryRun describes the directory that would be created
+func (t CreateDirectoryTool) DryRun(args map[string]interface{}) (string, error) {
+	return t.run(args, true)
+}
+
+func (t CreateDirectoryTool) run(args map[string]interface{}, dryRun bool) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'path' argument")
 	}
 
+	if err := t.Workspace.Check(path); err != nil {
+		return "", err
+	}
+
+	if dryRun {
+		return fmt.Sprintf("Dry run: would create directory %s", path), nil
+	}
+
 	err := os.MkdirAll(path, 0755)
 	if err != nil {
 		return "", fmt.Errorf("failed to create directory: %v", err)
@@ -318,7 +1220,10 @@ func (t CreateDirectoryTool) Execute(args map[string]interface{}) (string, error
 }
 
 // DeleteFileTool deletes a file
-type DeleteFileTool struct{}
+type DeleteFileTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+	Trash     string     // Directory deleted files are moved to ("" removes them outright)
+}
 
 func (t DeleteFileTool) Definition() ToolDefinition {
 	return ToolDefinition{
@@ -338,11 +1243,44 @@ func (t DeleteFileTool) Definition() ToolDefinition {
 }
 
 func (t DeleteFileTool) Execute(args map[string]interface{}) (string, error) {
+	return t.run(args, false)
+}
+
+// DryRun checks the file exists and describes the deletion without removing it
+func (t DeleteFileTool) DryRun(args map[string]interface{}) (string, error) {
+	return t.run(args, true)
+}
+
+func (t DeleteFileTool) run(args map[string]interface{}, dryRun bool) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'path' argument")
 	}
 
+	if err := t.Workspace.Check(path); err != nil {
+		return "", err
+	}
+
+	if dryRun {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("failed to delete file: %v", err)
+		}
+		return fmt.Sprintf("Dry run: would delete %s", path), nil
+	}
+
+	if t.Trash != "" {
+		if info, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("failed to delete file: %v", err)
+		} else if info.IsDir() {
+			return "", fmt.Errorf("failed to delete file: %s is a directory", path)
+		}
+		saved, err := moveToTrash(t.Trash, path)
+		if err != nil {
+			return "", fmt.Errorf("failed to delete file: %v", err)
+		}
+		return fmt.Sprintf("Successfully deleted %s (moved to %s)", path, saved), nil
+	}
+
 	err := os.Remove(path)
 	if err != nil {
 		return "", fmt.Errorf("failed to delete file: %v", err)
@@ -352,7 +1290,9 @@ func (t DeleteFileTool) Execute(args map[string]interface{}) (string, error) {
 }
 
 // MoveFileTool moves or renames a file
-type MoveFileTool struct{}
+type MoveFileTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+}
 
 func (t MoveFileTool) Definition() ToolDefinition {
 	return ToolDefinition{
@@ -376,6 +1316,15 @@ func (t MoveFileTool) Definition() ToolDefinition {
 }
 
 func (t MoveFileTool) Execute(args map[string]interface{}) (string, error) {
+	return t.run(args, false)
+}
+
+// DryRun checks the source exists and describes the move without performing it
+func (t MoveFileTool) DryRun(args map[string]interface{}) (string, error) {
+	return t.run(args, true)
+}
+
+func (t MoveFileTool) run(args map[string]interface{}, dryRun bool) (string, error) {
 	source, ok := args["source"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'source' argument")
@@ -385,6 +1334,19 @@ func (t MoveFileTool) Execute(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("missing or invalid 'destination' argument")
 	}
 
+	for _, p := range []string{source, destination} {
+		if err := t.Workspace.Check(p); err != nil {
+			return "", err
+		}
+	}
+
+	if dryRun {
+		if _, err := os.Stat(source); err != nil {
+			return "", fmt.Errorf("failed to move file: %v", err)
+		}
+		return fmt.Sprintf("Dry run: would move %s to %s", source, destination), nil
+	}
+
 	err := os.Rename(source, destination)
 	if err != nil {
 		return "", fmt.Errorf("failed to move file: %v", err)
@@ -394,7 +1356,10 @@ func (t MoveFileTool) Execute(args map[string]interface{}) (string, error) {
 }
 
 // AppendToFileTool appends content to a file
-type AppendToFileTool struct{}
+type AppendToFileTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+	MaxBytes  int        // Largest content accepted per append (0 means DefaultMaxWriteBytes)
+}
 
 func (t AppendToFileTool) Definition() ToolDefinition {
 	return ToolDefinition{
@@ -418,14 +1383,36 @@ func (t AppendToFileTool) Definition() ToolDefinition {
 }
 
 func (t AppendToFileTool) Execute(args map[string]interface{}) (string, error) {
+	return t.run(args, false)
+}
+
+// DryRun describes the append, with a diff, without touching the file
+func (t AppendToFileTool) DryRun(args map[string]interface{}) (string, error) {
+	return t.run(args, true)
+}
+
+func (t AppendToFileTool) run(args map[string]interface{}, dryRun bool) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'path' argument")
 	}
+
+	if err := t.Workspace.Check(path); err != nil {
+		return "", err
+	}
+
 	content, ok := args["content"].(string)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'content' argument")
 	}
+	if err := checkWriteSize(content, t.MaxBytes); err != nil {
+		return "", err
+	}
+
+	if dryRun {
+		existing, _ := os.ReadFile(path)
+		return withDiff(fmt.Sprintf("Dry run: would append %d bytes to %s", len(content), path), path, string(existing), string(existing)+content), nil
+	}
 
 	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -441,12 +1428,14 @@ func (t AppendToFileTool) Execute(args map[string]interface{}) (string, error) {
 }
 
 // ReadFileLinesTools reads specific line ranges from a file
-type ReadFileLinesTool struct{}
+type ReadFileLinesTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+}
 
 func (t ReadFileLinesTool) Definition() ToolDefinition {
 	return ToolDefinition{
 		Name:        "read_file_lines",
-		Description: "Read specific line ranges from a file",
+		Description: "Read specific line ranges from a file. Each line is prefixed with its line number (like \"42: foo()\") under a header giving the file's total line count",
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
@@ -462,6 +1451,10 @@ func (t ReadFileLinesTool) Definition() ToolDefinition {
 					"type":        "number",
 					"description": "Ending line number (1-indexed)",
 				},
+				"line_numbers": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Prefix lines with their numbers and add the header (default true). Set false for the raw content verbatim",
+				},
 			},
 			"required": []string{"path", "start_line", "end_line"},
 		},
@@ -473,6 +1466,11 @@ func (t ReadFileLinesTool) Execute(args map[string]interface{}) (string, error)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'path' argument")
 	}
+
+	if err := t.Workspace.Check(path); err != nil {
+		return "", err
+	}
+
 	startLineFloat, ok := args["start_line"].(float64)
 	if !ok {
 		return "", fmt.Errorf("missing or invalid 'start_line' argument")
@@ -499,7 +1497,70 @@ func (t ReadFileLinesTool) Execute(args map[string]interface{}) (string, error)
 	}
 
 	selectedLines := lines[startLine-1 : endLine]
-	return strings.Join(selectedLines, "\n"), nil
+	if numbered, ok := args["line_numbers"].(bool); ok && !numbered {
+		return strings.Join(selectedLines, "\n"), nil
+	}
+
+	// A trailing newline ends the last line rather than starting another
+	total := len(lines)
+	if total > 1 && lines[total-1] == "" {
+		total--
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s: lines %d-%d of %d]\n", path, startLine, endLine, total)
+	for i, line := range selectedLines {
+		fmt.Fprintf(&b, "\n%d: %s", startLine+i, line)
+	}
+	return b.String(), nil
+}
+
+// FileStatTool reports a file's metadata without reading its contents
+type FileStatTool struct {
+	Workspace *Workspace // Paths must stay inside this tree (nil allows any path)
+}
+
+func (t FileStatTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "file_stat",
+		Description: "Get a file's or directory's size, permissions and modification time without reading it. Useful before deciding whether a file is worth reading",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The path to the file or directory",
+				},
+			},
+			"required": []string{"path"},
+		},
+	}
+}
+
+func (t FileStatTool) Execute(args map[string]interface{}) (string, error) {
+	path, ok := args["path"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing or invalid 'path' argument")
+	}
+
+	if err := t.Workspace.Check(path); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		// Not an error: finding out whether a file exists is a common reason to stat it
+		return fmt.Sprintf("%s does not exist", path), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	kind := "file"
+	if info.IsDir() {
+		kind = "directory"
+	}
+	return fmt.Sprintf("Path: %s\nType: %s\nSize: %d bytes\nMode: %s\nModified: %s\nIsDir: %t",
+		path, kind, info.Size(), info.Mode(), info.ModTime().Format(time.RFC3339), info.IsDir()), nil
 }
 
 // GetCurrentDirectoryTool gets the current working directory
@@ -524,6 +1585,349 @@ func (t GetCurrentDirectoryTool) Execute(args map[string]interface{}) (string, e
 	return dir, nil
 }
 
+// maxGitOutputBytes caps how much git output a tool returns, so a huge diff can't flood the context
+const maxGitOutputBytes = 64 << 10
+
+// runGit runs git with args (never through a shell, so paths need no escaping) and returns its
+// trimmed output, capped at maxGitOutputBytes
+func runGit(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s failed: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s failed: %v", args[0], err)
+	}
+
+	output := strings.TrimRight(stdout.String(), "\n")
+	if len(output) > maxGitOutputBytes {
+		output = output[:maxGitOutputBytes] + fmt.Sprintf("\n... (output truncated at %d bytes)", maxGitOutputBytes)
+	}
+	return output, nil
+}
+
+// GitStatusTool reports the current branch and changed files
+type GitStatusTool struct{}
+
+func (t GitStatusTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "git_status",
+		Description: "Show the current git branch and which files are staged, modified, or untracked",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}
+}
+
+func (t GitStatusTool) Execute(args map[string]interface{}) (string, error) {
+	output, err := runGit("status", "--porcelain=v1", "--branch")
+	if err != nil {
+		return "", err
+	}
+	return formatGitStatus(output), nil
+}
+
+// formatGitStatus groups porcelain v1 status lines into branch, staged, unstaged, and untracked sections
+func formatGitStatus(porcelain string) string {
+	var branch string
+	var staged, unstaged, untracked []string
+	for _, line := range strings.Split(porcelain, "\n") {
+		if strings.HasPrefix(line, "## ") {
+			branch = strings.TrimPrefix(line, "## ")
+			continue
+		}
+		if len(line) < 4 {
+			continue
+		}
+		x, y, path := line[0], line[1], line[3:]
+		if x == '?' {
+			untracked = append(untracked, path)
+			continue
+		}
+		if x != ' ' {
+			staged = append(staged, fmt.Sprintf("%c %s", x, path))
+		}
+		if y != ' ' {
+			unstaged = append(unstaged, fmt.Sprintf("%c %s", y, path))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Branch: %s\n", branch)
+	if len(staged)+len(unstaged)+len(untracked) == 0 {
+		b.WriteString("Working tree clean")
+		return b.String()
+	}
+	for _, section := range []struct {
+		title string
+		files []string
+	}{{"Staged", staged}, {"Not staged", unstaged}, {"Untracked", untracked}} {
+		if len(section.files) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:\n", section.title)
+		for _, f := range section.files {
+			fmt.Fprintf(&b, "  %s\n", f)
+		}
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// GitDiffTool shows unstaged or staged changes, optionally for a single file
+type GitDiffTool struct{}
+
+func (t GitDiffTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "git_diff",
+		Description: "Show git changes as a unified diff",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional file path to diff (defaults to all files)",
+				},
+				"staged": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Show staged changes instead of unstaged ones",
+				},
+			},
+		},
+	}
+}
+
+func (t GitDiffTool) Execute(args map[string]interface{}) (string, error) {
+	gitArgs := []string{"diff"}
+	staged, _ := args["staged"].(bool)
+	if staged {
+		gitArgs = append(gitArgs, "--staged")
+	}
+	if path, ok := args["path"].(string); ok && path != "" {
+		gitArgs = append(gitArgs, "--", path)
+	}
+
+	output, err := runGit(gitArgs...)
+	if err != nil {
+		return "", err
+	}
+	if output == "" {
+		if staged {
+			return "No staged changes", nil
+		}
+		return "No unstaged changes", nil
+	}
+	return output, nil
+}
+
+// Limits on how many commits git_log lists
+const (
+	defaultGitLogCount = 10
+	maxGitLogCount     = 100
+)
+
+// requireGitRepo returns an error unless the current directory is inside a git work tree
+func requireGitRepo() error {
+	if _, err := runGit("rev-parse", "--is-inside-work-tree"); err != nil {
+		return fmt.Errorf("not inside a git repository")
+	}
+	return nil
+}
+
+// GitLogTool lists recent commits, optionally for one path or since a date
+type GitLogTool struct{}
+
+func (t GitLogTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "git_log",
+		Description: "List recent git commits with their hash, date, author, and subject",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional file or directory to show history for",
+				},
+				"count": map[string]interface{}{
+					"type":        "number",
+					"description": fmt.Sprintf("Number of commits to show (default %d, max %d)", defaultGitLogCount, maxGitLogCount),
+				},
+				"since": map[string]interface{}{
+					"type":        "string",
+					"description": "Only show commits after this date, e.g. \"2024-01-31\" or \"2 weeks ago\"",
+				},
+			},
+		},
+	}
+}
+
+func (t GitLogTool) Execute(args map[string]interface{}) (string, error) {
+	if err := requireGitRepo(); err != nil {
+		return "", err
+	}
+
+	count := defaultGitLogCount
+	if n, ok := args["count"].(float64); ok && n > 0 {
+		count = min(int(n), maxGitLogCount)
+	}
+	gitArgs := []string{"log", fmt.Sprintf("--max-count=%d", count), "--date=short", "--pretty=format:%h %ad %an: %s"}
+	if since, ok := args["since"].(string); ok && since != "" {
+		gitArgs = append(gitArgs, "--since="+since)
+	}
+	if path, ok := args["path"].(string); ok && path != "" {
+		gitArgs = append(gitArgs, "--", path)
+	}
+
+	output, err := runGit(gitArgs...)
+	if err != nil {
+		return "", err
+	}
+	if output == "" {
+		return "No commits found", nil
+	}
+	return output, nil
+}
+
+// GitShowTool shows one commit's message and diff
+type GitShowTool struct{}
+
+func (t GitShowTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "git_show",
+		Description: "Show a git commit's author, date, message, and diff",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"commit": map[string]interface{}{
+					"type":        "string",
+					"description": "Commit hash, branch, tag, or other revision such as HEAD~1",
+				},
+			},
+			"required": []string{"commit"},
+		},
+	}
+}
+
+func (t GitShowTool) Execute(args map[string]interface{}) (string, error) {
+	commit, ok := args["commit"].(string)
+	if !ok || commit == "" {
+		return "", fmt.Errorf("missing or invalid 'commit' argument")
+	}
+	// A leading dash would be read as an option rather than a revision
+	if strings.HasPrefix(commit, "-") {
+		return "", fmt.Errorf("invalid commit %q", commit)
+	}
+	if err := requireGitRepo(); err != nil {
+		return "", err
+	}
+	return runGit("show", "--stat", "--patch", "--date=iso", commit, "--")
+}
+
+// DefaultMaxFetchBytes caps how much of a response body fetch_url reads when no limit is set
+const DefaultMaxFetchBytes = 100 << 10 // 100KB
+
+// fetchTimeout limits each fetch_url request
+const fetchTimeout = 15 * time.Second
+
+// Patterns for turning HTML into readable text
+var (
+	htmlHiddenPattern = regexp.MustCompile(`(?is)<(script|style|noscript|head)\b.*?</(script|style|noscript|head)>|<!--.*?-->`)
+	htmlBlockPattern  = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6]|/pre|/blockquote|/section|/article)\b[^>]*>`)
+	htmlTagPattern    = regexp.MustCompile(`<[^>]*>`)
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// FetchURLTool reads a web page or other http(s) resource
+type FetchURLTool struct {
+	MaxBytes int // Largest body read before truncating (0 means DefaultMaxFetchBytes)
+}
+
+func (t FetchURLTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "fetch_url",
+		Description: "Fetch a URL with HTTP GET and return its content as text (HTML is converted to plain text)",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"url": map[string]interface{}{
+					"type":        "string",
+					"description": "The http or https URL to fetch",
+				},
+			},
+			"required": []string{"url"},
+		},
+	}
+}
+
+func (t FetchURLTool) Execute(args map[string]interface{}) (string, error) {
+	rawURL, ok := args["url"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing or invalid 'url' argument")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid URL: %s", rawURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported URL scheme %q (only http and https are allowed)", u.Scheme)
+	}
+
+	limit := t.MaxBytes
+	if limit <= 0 {
+		limit = DefaultMaxFetchBytes
+	}
+
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %v", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s: %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", rawURL, err)
+	}
+	truncated := len(body) > limit
+	if truncated {
+		body = body[:limit]
+	}
+
+	text := string(body)
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		text = htmlToText(text)
+	}
+	if truncated {
+		text += fmt.Sprintf("\n... (truncated at %d bytes)", limit)
+	}
+	return text, nil
+}
+
+// htmlToText strips tags, scripts, and styles from HTML, keeping line breaks between blocks
+func htmlToText(page string) string {
+	page = htmlHiddenPattern.ReplaceAllString(page, "")
+	page = htmlBlockPattern.ReplaceAllString(page, "\n")
+	page = htmlTagPattern.ReplaceAllString(page, "")
+	page = html.UnescapeString(page)
+
+	lines := strings.Split(page, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	page = blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(page)
+}
+
 // FormatToolExecution creates a human-readable description of a tool execution
 func FormatToolExecution(toolName string, args map[string]interface{}) string {
 	switch toolName {
@@ -539,8 +1943,18 @@ func FormatToolExecution(toolName string, args map[string]interface{}) string {
 		if path, ok := args["path"].(string); ok {
 			return fmt.Sprintf("✏️  Editing file: %s", path)
 		}
+	case "apply_patch":
+		if patch, ok := args["patch"].(string); ok {
+			if files := PatchFiles(patch); len(files) > 0 {
+				return fmt.Sprintf("🩹 Patching: %s", strings.Join(files, ", "))
+			}
+		}
+		return "🩹 Applying patch"
 	case "list_directory":
 		if path, ok := args["path"].(string); ok {
+			if recursive, _ := args["recursive"].(bool); recursive {
+				return fmt.Sprintf("📁 Listing tree: %s", path)
+			}
 			return fmt.Sprintf("📁 Listing directory: %s", path)
 		}
 	case "search_files":
@@ -550,6 +1964,20 @@ func FormatToolExecution(toolName string, args map[string]interface{}) string {
 			}
 			return fmt.Sprintf("🔍 Searching in: %s", path)
 		}
+	case "find_files":
+		if root, ok := args["root"].(string); ok {
+			if pattern, ok := args["pattern"].(string); ok {
+				return fmt.Sprintf("🔎 Finding files in %s matching: %s", root, pattern)
+			}
+			return fmt.Sprintf("🔎 Finding files in: %s", root)
+		}
+	case "count_matches":
+		if path, ok := args["path"].(string); ok {
+			if pattern, ok := args["pattern"].(string); ok {
+				return fmt.Sprintf("🔢 Counting matches in %s for: %s", path, pattern)
+			}
+			return fmt.Sprintf("🔢 Counting matches in: %s", path)
+		}
 	case "create_directory":
 		if path, ok := args["path"].(string); ok {
 			return fmt.Sprintf("📂 Creating directory: %s", path)
@@ -577,10 +2005,38 @@ func FormatToolExecution(toolName string, args map[string]interface{}) string {
 		if command, ok := args["command"].(string); ok {
 			return fmt.Sprintf("⚡ Running: %s", command)
 		}
+	case "file_stat":
+		if path, ok := args["path"].(string); ok {
+			return fmt.Sprintf("ℹ️  Checking file info: %s", path)
+		}
 	case "get_current_directory":
 		return "📍 Getting current directory"
+	case "git_status":
+		return "🌿 Checking git status"
+	case "git_diff":
+		what := "changes"
+		if staged, _ := args["staged"].(bool); staged {
+			what = "staged changes"
+		}
+		if path, ok := args["path"].(string); ok && path != "" {
+			return fmt.Sprintf("🌿 Diffing %s in: %s", what, path)
+		}
+		return fmt.Sprintf("🌿 Diffing %s", what)
+	case "fetch_url":
+		if u, ok := args["url"].(string); ok {
+			return fmt.Sprintf("🌐 Fetching: %s", u)
+		}
+	case "git_log":
+		if path, ok := args["path"].(string); ok && path != "" {
+			return fmt.Sprintf("📜 Reading git history for: %s", path)
+		}
+		return "📜 Reading git history"
+	case "git_show":
+		if commit, ok := args["commit"].(string); ok {
+			return fmt.Sprintf("📜 Showing commit: %s", commit)
+		}
 	}
-	
+
 	// Fallback format
 	return fmt.Sprintf("🔧 Executing: %s", toolName)
 }
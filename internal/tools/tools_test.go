@@ -1,10 +1,18 @@
 package tools
 
 import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestWriteAndReadFile(t *testing.T) {
@@ -145,3 +153,1253 @@ func TestAppendToFile(t *testing.T) {
 		t.Errorf("Expected content %q, got %q", expected, string(content))
 	}
 }
+
+func TestReadFileLines_NumbersLines(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "lines.txt")
+	os.WriteFile(filePath, []byte("one\ntwo\nthree\nfour\n"), 0644)
+
+	tool := ReadFileLinesTool{}
+	out, err := tool.Execute(map[string]interface{}{"path": filePath, "start_line": 2.0, "end_line": 3.0})
+	if err != nil {
+		t.Fatalf("ReadFileLinesTool failed: %v", err)
+	}
+	expected := fmt.Sprintf("[%s: lines 2-3 of 4]\n\n2: two\n3: three", filePath)
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+
+	out, err = tool.Execute(map[string]interface{}{"path": filePath, "start_line": 2.0, "end_line": 3.0, "line_numbers": false})
+	if err != nil {
+		t.Fatalf("ReadFileLinesTool failed: %v", err)
+	}
+	if out != "two\nthree" {
+		t.Errorf("Expected the raw lines with line_numbers off, got %q", out)
+	}
+}
+
+func TestCountMatches(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("clippy\nclippy clippy\nnope\n"), 0644)
+	os.Mkdir(filepath.Join(tmpDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "sub", "b.txt"), []byte("hello clippy\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "c.txt"), []byte("nothing here\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "d.bin"), []byte("clippy\x00clippy"), 0644)
+
+	countTool := CountMatchesTool{}
+	output, err := countTool.Execute(map[string]interface{}{
+		"path":    tmpDir,
+		"pattern": "clippy",
+	})
+	if err != nil {
+		t.Fatalf("CountMatchesTool failed: %v", err)
+	}
+
+	if !strings.Contains(output, filepath.Join(tmpDir, "a.txt")+": 3") {
+		t.Errorf("Expected 3 matches in a.txt, got:\n%s", output)
+	}
+	if !strings.Contains(output, filepath.Join(tmpDir, "sub", "b.txt")+": 1") {
+		t.Errorf("Expected 1 match in sub/b.txt, got:\n%s", output)
+	}
+	if strings.Contains(output, "c.txt") {
+		t.Errorf("Files without matches should not be listed, got:\n%s", output)
+	}
+	if strings.Contains(output, "d.bin") {
+		t.Errorf("Binary files should be skipped, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Total: 4 matches in 2 files") {
+		t.Errorf("Expected total of 4 matches in 2 files, got:\n%s", output)
+	}
+}
+
+func TestListDirectory_MaxEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	for i := 0; i < 10; i++ {
+		os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("file%02d.txt", i)), []byte("x"), 0644)
+	}
+
+	listTool := ListDirectoryTool{MaxEntries: 3}
+	output, err := listTool.Execute(map[string]interface{}{
+		"path": tmpDir,
+	})
+	if err != nil {
+		t.Fatalf("ListDirectoryTool failed: %v", err)
+	}
+
+	if strings.Count(output, "[FILE]") != 3 {
+		t.Errorf("Expected 3 entries, got:\n%s", output)
+	}
+	if !strings.Contains(output, "…and 7 more") {
+		t.Errorf("Expected truncation note, got:\n%s", output)
+	}
+}
+
+func TestListDirectory_SortAndFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now()
+
+	os.WriteFile(filepath.Join(tmpDir, "small.go"), []byte("1"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "big.go"), []byte("1234567890"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "medium.go"), []byte("12345"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "notes.md"), []byte("12345678901234567890"), 0644)
+	os.Chtimes(filepath.Join(tmpDir, "small.go"), now, now)
+	os.Chtimes(filepath.Join(tmpDir, "big.go"), now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	os.Chtimes(filepath.Join(tmpDir, "medium.go"), now.Add(-time.Hour), now.Add(-time.Hour))
+
+	listTool := ListDirectoryTool{}
+
+	output, err := listTool.Execute(map[string]interface{}{
+		"path":   tmpDir,
+		"sort":   "size",
+		"filter": "*.go",
+	})
+	if err != nil {
+		t.Fatalf("ListDirectoryTool failed: %v", err)
+	}
+	if strings.Contains(output, "notes.md") {
+		t.Errorf("Filter should exclude notes.md, got:\n%s", output)
+	}
+	if !inOrder(output, "big.go", "medium.go", "small.go") {
+		t.Errorf("Expected size order big, medium, small, got:\n%s", output)
+	}
+
+	output, err = listTool.Execute(map[string]interface{}{
+		"path":   tmpDir,
+		"sort":   "mtime",
+		"filter": "*.go",
+	})
+	if err != nil {
+		t.Fatalf("ListDirectoryTool failed: %v", err)
+	}
+	if !inOrder(output, "small.go", "medium.go", "big.go") {
+		t.Errorf("Expected mtime order small, medium, big, got:\n%s", output)
+	}
+}
+
+// inOrder reports whether each of the substrings appears in s after the previous one
+func inOrder(s string, substrs ...string) bool {
+	pos := 0
+	for _, sub := range substrs {
+		idx := strings.Index(s[pos:], sub)
+		if idx == -1 {
+			return false
+		}
+		pos += idx + len(sub)
+	}
+	return true
+}
+
+func TestRunCommand_TimeoutIsDistinct(t *testing.T) {
+	runTool := RunCommandTool{}
+
+	output, err := runTool.Execute(map[string]interface{}{
+		"command": "sleep 5",
+		"timeout": 0.2,
+	})
+	if err != nil {
+		t.Fatalf("RunCommandTool returned error: %v", err)
+	}
+	if !strings.HasPrefix(output, "Command timed out after 200ms") {
+		t.Errorf("Expected a timeout result, got %q", output)
+	}
+
+	output, err = runTool.Execute(map[string]interface{}{
+		"command": "exit 3",
+	})
+	if err != nil {
+		t.Fatalf("RunCommandTool returned error: %v", err)
+	}
+	if !strings.HasPrefix(output, "Command failed") || strings.Contains(output, "timed out") {
+		t.Errorf("Expected a plain failure result, got %q", output)
+	}
+}
+
+func TestRunCommand_RetryOnTimeout(t *testing.T) {
+	runTool := RunCommandTool{Timeout: 200 * time.Millisecond, RetryOnTimeout: true}
+
+	output, err := runTool.Execute(map[string]interface{}{
+		"command": "sleep 0.3 && echo finished",
+	})
+	if err != nil {
+		t.Fatalf("RunCommandTool returned error: %v", err)
+	}
+	if strings.TrimSpace(output) != "finished" {
+		t.Errorf("Expected retry with a longer timeout to succeed, got %q", output)
+	}
+}
+
+func TestWriteFile_MaxBytes(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "limited.txt")
+	writeTool := WriteFileTool{MaxBytes: 10}
+
+	_, err := writeTool.Execute(map[string]interface{}{
+		"path":    filePath,
+		"content": strings.Repeat("x", 11),
+	})
+	if err == nil || !strings.Contains(err.Error(), "write limit") {
+		t.Errorf("Expected write limit error, got %v", err)
+	}
+	if _, statErr := os.Stat(filePath); !os.IsNotExist(statErr) {
+		t.Error("Refused write should not create the file")
+	}
+
+	_, err = writeTool.Execute(map[string]interface{}{
+		"path":    filePath,
+		"content": strings.Repeat("x", 10),
+	})
+	if err != nil {
+		t.Errorf("Expected content at the limit to be written, got %v", err)
+	}
+}
+
+func TestAppendToFile_MaxBytes(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "limited.txt")
+	os.WriteFile(filePath, []byte("start\n"), 0644)
+	appendTool := AppendToFileTool{MaxBytes: 10}
+
+	_, err := appendTool.Execute(map[string]interface{}{
+		"path":    filePath,
+		"content": strings.Repeat("x", 11),
+	})
+	if err == nil || !strings.Contains(err.Error(), "write limit") {
+		t.Errorf("Expected write limit error, got %v", err)
+	}
+
+	_, err = appendTool.Execute(map[string]interface{}{
+		"path":    filePath,
+		"content": strings.Repeat("x", 9),
+	})
+	if err != nil {
+		t.Errorf("Expected content under the limit to be appended, got %v", err)
+	}
+
+	content, _ := os.ReadFile(filePath)
+	if string(content) != "start\n"+strings.Repeat("x", 9) {
+		t.Errorf("Unexpected file content %q", string(content))
+	}
+}
+
+// gitRepo makes an empty repository in a temp dir and changes into it
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	git(t, "init", "-q", "-b", "main")
+	git(t, "config", "user.email", "clippy@example.com")
+	git(t, "config", "user.name", "Clippy")
+	return dir
+}
+
+// git runs a git command in the current directory, failing the test if it errors
+func git(t *testing.T, args ...string) {
+	t.Helper()
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
+
+func TestGitStatusAndDiff(t *testing.T) {
+	gitRepo(t)
+	os.WriteFile("tracked.txt", []byte("one\n"), 0644)
+	git(t, "add", "tracked.txt")
+	git(t, "commit", "-q", "-m", "initial")
+
+	status, err := GitStatusTool{}.Execute(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("GitStatusTool failed: %v", err)
+	}
+	if !strings.Contains(status, "Branch: main") || !strings.Contains(status, "Working tree clean") {
+		t.Errorf("Expected a clean main branch, got %q", status)
+	}
+
+	os.WriteFile("tracked.txt", []byte("one\ntwo\n"), 0644)
+	os.WriteFile("other file.txt", []byte("staged\n"), 0644)
+	os.WriteFile("new.txt", []byte("new\n"), 0644)
+	git(t, "add", "other file.txt")
+
+	status, _ = GitStatusTool{}.Execute(map[string]interface{}{})
+	for _, want := range []string{"Staged:\n  A \"other file.txt\"", "Not staged:\n  M tracked.txt", "Untracked:\n  new.txt"} {
+		if !strings.Contains(status, want) {
+			t.Errorf("Expected status to contain %q, got %q", want, status)
+		}
+	}
+
+	diff, err := GitDiffTool{}.Execute(map[string]interface{}{"path": "tracked.txt"})
+	if err != nil {
+		t.Fatalf("GitDiffTool failed: %v", err)
+	}
+	if !strings.Contains(diff, "+two") || strings.Contains(diff, "other file.txt") {
+		t.Errorf("Expected only the unstaged tracked.txt change, got %q", diff)
+	}
+
+	staged, _ := GitDiffTool{}.Execute(map[string]interface{}{"staged": true, "path": "other file.txt"})
+	if !strings.Contains(staged, "+staged") || strings.Contains(staged, "+two") {
+		t.Errorf("Expected only the staged change, got %q", staged)
+	}
+
+	git(t, "add", "-A")
+	if diff, _ := (GitDiffTool{}).Execute(map[string]interface{}{}); diff != "No unstaged changes" {
+		t.Errorf("Expected no unstaged changes, got %q", diff)
+	}
+}
+
+func TestGitLogAndShow(t *testing.T) {
+	gitRepo(t)
+	os.WriteFile("a.txt", []byte("alpha\n"), 0644)
+	git(t, "add", "a.txt")
+	git(t, "commit", "-q", "-m", "Add alpha")
+	os.WriteFile("b.txt", []byte("beta\n"), 0644)
+	git(t, "add", "b.txt")
+	git(t, "commit", "-q", "-m", "Add beta")
+
+	log, err := GitLogTool{}.Execute(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("GitLogTool failed: %v", err)
+	}
+	lines := strings.Split(log, "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "Clippy: Add beta") || !strings.HasSuffix(lines[1], "Clippy: Add alpha") {
+		t.Errorf("Expected both commits newest first, got %q", log)
+	}
+
+	log, _ = GitLogTool{}.Execute(map[string]interface{}{"path": "a.txt"})
+	if strings.Contains(log, "Add beta") || !strings.Contains(log, "Add alpha") {
+		t.Errorf("Expected only the commit touching a.txt, got %q", log)
+	}
+	log, _ = GitLogTool{}.Execute(map[string]interface{}{"count": float64(1)})
+	if strings.Count(log, "\n") != 0 || !strings.Contains(log, "Add beta") {
+		t.Errorf("Expected just the latest commit, got %q", log)
+	}
+	log, _ = GitLogTool{}.Execute(map[string]interface{}{"since": "2099-01-01"})
+	if log != "No commits found" {
+		t.Errorf("Expected no commits in the future, got %q", log)
+	}
+
+	show, err := GitShowTool{}.Execute(map[string]interface{}{"commit": "HEAD~1"})
+	if err != nil {
+		t.Fatalf("GitShowTool failed: %v", err)
+	}
+	if !strings.Contains(show, "Add alpha") || !strings.Contains(show, "+alpha") || strings.Contains(show, "+beta") {
+		t.Errorf("Expected the first commit's message and diff, got %q", show)
+	}
+	if _, err := (GitShowTool{}).Execute(map[string]interface{}{"commit": "--output=/tmp/x"}); err == nil {
+		t.Error("Expected options to be rejected as commits")
+	}
+}
+
+func TestGitLog_OutsideRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+	if _, err := (GitLogTool{}).Execute(map[string]interface{}{}); err == nil || !strings.Contains(err.Error(), "not inside a git repository") {
+		t.Errorf("Expected a not-a-repository error, got %v", err)
+	}
+}
+
+func TestFetchURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, `<html><head><title>Docs</title><style>p{color:red}</style></head>
+<body><h1>Getting   started</h1><script>alert("hi")</script><p>Use &lt;b&gt; &amp; friends.</p></body></html>`)
+		case "/big":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, strings.Repeat("x", 100))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	text, err := FetchURLTool{}.Execute(map[string]interface{}{"url": server.URL + "/page"})
+	if err != nil {
+		t.Fatalf("FetchURLTool failed: %v", err)
+	}
+	if text != "Getting started\nUse <b> & friends." {
+		t.Errorf("Expected HTML stripped to text, got %q", text)
+	}
+
+	text, _ = FetchURLTool{MaxBytes: 10}.Execute(map[string]interface{}{"url": server.URL + "/big"})
+	if !strings.HasPrefix(text, "xxxxxxxxxx\n") || !strings.Contains(text, "truncated at 10 bytes") {
+		t.Errorf("Expected the body truncated at 10 bytes, got %q", text)
+	}
+
+	if _, err := (FetchURLTool{}).Execute(map[string]interface{}{"url": server.URL + "/missing"}); err == nil {
+		t.Error("Expected an error for a 404")
+	}
+	for _, u := range []string{"file:///etc/passwd", "ftp://example.com/x", "not a url"} {
+		if _, err := (FetchURLTool{}).Execute(map[string]interface{}{"url": u}); err == nil {
+			t.Errorf("Expected %q to be refused", u)
+		}
+	}
+}
+
+func TestSearch_SkipsIgnoredPaths(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	files := map[string]string{
+		"main.go":                      "needle\n",
+		"node_modules/pkg/index.js":    "needle\n",
+		".git/config":                  "needle\n",
+		"generated/api.go":             "needle\n",
+		"docs/notes.log":               "needle\n",
+		"docs/keep.log":                "needle\n",
+		"src/generated/handwritten.go": "needle\n",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(name), 0755)
+		os.WriteFile(name, []byte(content), 0644)
+	}
+	os.WriteFile(IgnoreFile, []byte("# project ignores\n/generated/\n*.log\n!keep.log\n"), 0644)
+
+	out, err := SearchFilesTool{}.Execute(map[string]interface{}{"path": ".", "pattern": "needle"})
+	if err != nil {
+		t.Fatalf("SearchFilesTool failed: %v", err)
+	}
+	for _, want := range []string{"main.go:1:needle", "docs/keep.log:1:needle", "src/generated/handwritten.go:1:needle"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in results, got:\n%s", want, out)
+		}
+	}
+	for _, skipped := range []string{"node_modules", ".git/", "generated/api.go", "notes.log"} {
+		if strings.Contains(out, skipped) {
+			t.Errorf("Expected %q to be skipped, got:\n%s", skipped, out)
+		}
+	}
+
+	out, _ = SearchFilesTool{}.Execute(map[string]interface{}{"path": ".", "pattern": "needle", "include_ignored": true})
+	for _, want := range []string{"node_modules/pkg/index.js", ".git/config", "generated/api.go", "docs/notes.log"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected include_ignored to re-include %q, got:\n%s", want, out)
+		}
+	}
+
+	count, _ := CountMatchesTool{}.Execute(map[string]interface{}{"path": ".", "pattern": "needle"})
+	if !strings.Contains(count, "Total: 3 matches in 3 files") {
+		t.Errorf("Expected count_matches to skip ignored paths too, got:\n%s", count)
+	}
+	count, _ = CountMatchesTool{}.Execute(map[string]interface{}{"path": ".", "pattern": "needle", "include_ignored": true})
+	if !strings.Contains(count, "Total: 7 matches in 7 files") {
+		t.Errorf("Expected include_ignored to count everything, got:\n%s", count)
+	}
+
+	// Searching inside an ignored directory directly still works
+	out, _ = SearchFilesTool{}.Execute(map[string]interface{}{"path": "node_modules", "pattern": "needle"})
+	if !strings.Contains(out, "index.js") {
+		t.Errorf("Expected an explicitly requested directory to be searched, got:\n%s", out)
+	}
+}
+
+func TestGitIgnore_SkipsIgnoredPaths(t *testing.T) {
+	repo := t.TempDir()
+	t.Chdir(t.TempDir())
+	for name, content := range map[string]string{
+		".gitignore":           "# build output\ncoverage/\n*.tmp\n",
+		"src/main.go":          "needle\n",
+		"src/scratch.tmp":      "needle\n",
+		"src/coverage/out.txt": "needle\n",
+		"coverage/index.html":  "needle\n",
+	} {
+		path := filepath.Join(repo, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	os.Mkdir(filepath.Join(repo, ".git"), 0755)
+
+	// Searching a subdirectory still finds the .gitignore at the top of the repository
+	for _, root := range []string{repo, filepath.Join(repo, "src")} {
+		out, err := SearchFilesTool{}.Execute(map[string]interface{}{"path": root, "pattern": "needle"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, "main.go") || strings.Contains(out, "coverage") || strings.Contains(out, "scratch.tmp") {
+			t.Errorf("Expected only main.go under %s, got:\n%s", root, out)
+		}
+	}
+
+	out, err := ListDirectoryTool{}.Execute(map[string]interface{}{"path": repo, "recursive": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "main.go") || strings.Contains(out, "coverage") || strings.Contains(out, "scratch.tmp") {
+		t.Errorf("Expected the tree listing to skip .gitignore entries, got:\n%s", out)
+	}
+
+	// A .gitignore above the workspace isn't read
+	ws, _ := NewWorkspace(filepath.Join(repo, "src"))
+	out, _ = SearchFilesTool{Workspace: ws}.Execute(map[string]interface{}{"path": filepath.Join(repo, "src"), "pattern": "needle"})
+	if !strings.Contains(out, "scratch.tmp") {
+		t.Errorf("Expected the search to stop looking for a .gitignore at the workspace root, got:\n%s", out)
+	}
+}
+
+func TestGitIgnore_OnlyInsideRepository(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(t.TempDir())
+	os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.txt\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("needle\n"), 0644)
+
+	out, _ := SearchFilesTool{}.Execute(map[string]interface{}{"path": dir, "pattern": "needle"})
+	if !strings.Contains(out, "notes.txt") {
+		t.Errorf("Expected a .gitignore outside any repository to be ignored, got:\n%s", out)
+	}
+}
+
+func TestRunCommand_CapsOutput(t *testing.T) {
+	runTool := RunCommandTool{MaxOutputBytes: 100}
+
+	output, err := runTool.Execute(map[string]interface{}{
+		"command": "head -c 100000 /dev/zero | tr '\\0' x",
+	})
+	if err != nil {
+		t.Fatalf("RunCommandTool returned error: %v", err)
+	}
+	if !strings.HasPrefix(output, strings.Repeat("x", 100)+"\n[output truncated]") {
+		t.Errorf("Expected 100 bytes then a truncation marker, got %q", output)
+	}
+
+	// Endless output is capped and killed by the timeout instead of hanging
+	start := time.Now()
+	output, _ = runTool.Execute(map[string]interface{}{
+		"command": "cat /dev/zero",
+		"timeout": 0.3,
+	})
+	if !strings.HasPrefix(output, "Command timed out after 300ms and was killed") || !strings.HasSuffix(output, "[output truncated]") {
+		t.Errorf("Expected a timeout with truncated output, got %q", output[:min(len(output), 200)])
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the command to be killed promptly, took %s", elapsed)
+	}
+}
+
+func TestRunCommand_TimeoutKillsChildren(t *testing.T) {
+	start := time.Now()
+	// The background child holds the output pipe open; killing only the shell would leave it running
+	output, _ := RunCommandTool{}.Execute(map[string]interface{}{
+		"command": "sleep 30 & sleep 30",
+		"timeout": 0.2,
+	})
+	if !strings.HasPrefix(output, "Command timed out") {
+		t.Errorf("Expected a timeout result, got %q", output)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("Expected the whole process group to be killed, took %s", elapsed)
+	}
+}
+
+func TestRunCommand_DenyList(t *testing.T) {
+	runTool := RunCommandTool{Blocked: []string{"git push"}}
+
+	for _, command := range []string{"shutdown -h now", "echo hi && sudo rm -rf /", "mkfs.ext4 /dev/sda", "git   push origin main"} {
+		output, err := runTool.Execute(map[string]interface{}{"command": command})
+		if err != nil {
+			t.Fatalf("Expected a result string, got error: %v", err)
+		}
+		if !strings.HasPrefix(output, "Command blocked:") || !strings.Contains(output, "deny list") {
+			t.Errorf("Expected %q to be blocked, got %q", command, output)
+		}
+	}
+
+	output, _ := runTool.Execute(map[string]interface{}{"command": "echo rm -rf /tmp/build && git pushd-help"})
+	if strings.Contains(output, "Command blocked") {
+		t.Errorf("Expected a command that only resembles a blocked one to run, got %q", output)
+	}
+}
+
+func TestRunCommand_AllowList(t *testing.T) {
+	runTool := RunCommandTool{Allowed: []string{"echo", "go test"}}
+
+	output, _ := runTool.Execute(map[string]interface{}{"command": "echo allowed"})
+	if strings.TrimSpace(output) != "allowed" {
+		t.Errorf("Expected an allowed command to run, got %q", output)
+	}
+
+	for _, command := range []string{"ls", "echo ok; cat /etc/passwd", "echoes"} {
+		output, _ := runTool.Execute(map[string]interface{}{"command": command})
+		if !strings.HasPrefix(output, "Command blocked:") || !strings.Contains(output, "allow list") {
+			t.Errorf("Expected %q to be outside the allow list, got %q", command, output)
+		}
+	}
+}
+
+func TestValidateArguments(t *testing.T) {
+	def := ReadFileLinesTool{}.Definition()
+
+	if err := ValidateArguments(def, map[string]interface{}{"path": "a.txt", "start_line": 1.0, "end_line": 5}); err != nil {
+		t.Errorf("Expected valid arguments to pass, got %v", err)
+	}
+
+	err := ValidateArguments(def, map[string]interface{}{"file": "a.txt", "start_line": "1", "end_line": 5.0})
+	if err == nil {
+		t.Fatal("Expected invalid arguments to be rejected")
+	}
+	for _, want := range []string{"missing required 'path'", "'start_line' must be a"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %q", want, err.Error())
+		}
+	}
+}
+
+func TestValidateArguments_MissingRequired(t *testing.T) {
+	def := WriteFileTool{}.Definition()
+	err := ValidateArguments(def, map[string]interface{}{})
+	if err == nil {
+		t.Fatal("Expected missing required arguments to be rejected")
+	}
+	for _, want := range []string{"missing required 'path'", "missing required 'content'"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %q", want, err.Error())
+		}
+	}
+}
+
+func TestValidateArguments_WrongTypes(t *testing.T) {
+	cases := []struct {
+		def  ToolDefinition
+		args map[string]interface{}
+		want string
+	}{
+		{ReadFileLinesTool{}.Definition(), map[string]interface{}{"path": "a.txt", "start_line": "3", "end_line": 5.0}, "'start_line' must be a number, got string (pass 3 without quotes)"},
+		{ReadFileLinesTool{}.Definition(), map[string]interface{}{"path": "a.txt", "start_line": 1.0, "end_line": true}, "'end_line' must be a number, got boolean"},
+		{ReadFileTool{}.Definition(), map[string]interface{}{"path": []interface{}{"a.txt"}}, "'path' must be a string, got array"},
+		{ListDirectoryTool{}.Definition(), map[string]interface{}{"path": ".", "sort": "date"}, `'sort' must be one of name, size, mtime, got "date"`},
+	}
+	for _, c := range cases {
+		err := ValidateArguments(c.def, c.args)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s %v: expected %q, got %v", c.def.Name, c.args, c.want, err)
+		}
+	}
+
+	if err := ValidateArguments(ListDirectoryTool{}.Definition(), map[string]interface{}{"path": ".", "sort": ""}); err != nil {
+		t.Errorf("Expected an empty optional enum to pass, got %v", err)
+	}
+}
+
+func TestWorkspace_ConfinesFileTools(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "id_rsa")
+	os.WriteFile(secret, []byte("key"), 0600)
+	inside := filepath.Join(root, "notes.txt")
+	os.WriteFile(inside, []byte("hello"), 0644)
+	// A symlink inside the workspace that points out of it
+	os.Symlink(outside, filepath.Join(root, "escape"))
+
+	ws, err := NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := (ReadFileTool{Workspace: ws}).Execute(map[string]interface{}{"path": inside}); err != nil || out != "hello" {
+		t.Errorf("Expected a read inside the workspace to work, got %q, %v", out, err)
+	}
+
+	escapes := []struct {
+		tool Tool
+		args map[string]interface{}
+	}{
+		{ReadFileTool{Workspace: ws}, map[string]interface{}{"path": secret}},
+		{ReadFileTool{Workspace: ws}, map[string]interface{}{"path": filepath.Join(root, "..", filepath.Base(outside), "id_rsa")}},
+		{ReadFileTool{Workspace: ws}, map[string]interface{}{"path": filepath.Join(root, "escape", "id_rsa")}},
+		{WriteFileTool{Workspace: ws}, map[string]interface{}{"path": filepath.Join(root, "escape", "new.txt"), "content": "x"}},
+		{ReadFileLinesTool{Workspace: ws}, map[string]interface{}{"path": secret, "start_line": 1.0, "end_line": 1.0}},
+		{ListDirectoryTool{Workspace: ws}, map[string]interface{}{"path": outside}},
+		{DeleteFileTool{Workspace: ws}, map[string]interface{}{"path": secret}},
+		{MoveFileTool{Workspace: ws}, map[string]interface{}{"source": inside, "destination": filepath.Join(outside, "stolen.txt")}},
+		{MoveFileTool{Workspace: ws}, map[string]interface{}{"source": secret, "destination": filepath.Join(root, "stolen.txt")}},
+	}
+	for _, tc := range escapes {
+		_, err := tc.tool.Execute(tc.args)
+		if err == nil || !strings.Contains(err.Error(), "path escapes workspace") {
+			t.Errorf("Expected %s %v to escape the workspace, got %v", tc.tool.Definition().Name, tc.args, err)
+		}
+	}
+
+	if _, err := os.Stat(secret); err != nil {
+		t.Error("A rejected call should not touch files outside the workspace")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); err == nil {
+		t.Error("A write through a symlink should not create files outside the workspace")
+	}
+}
+
+func TestFindFilesTool(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"main.go", "README.md", "internal/ui/ui.go", "internal/ui/ui_test.go", "node_modules/pkg/index.go"} {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x"), 0644)
+	}
+
+	find := func(tool FindFilesTool, args map[string]interface{}) []string {
+		t.Helper()
+		args["root"] = root
+		output, err := tool.Execute(args)
+		if err != nil {
+			t.Fatalf("find_files returned error: %v", err)
+		}
+		var rels []string
+		for _, line := range strings.Split(output, "\n") {
+			if rel, err := filepath.Rel(root, line); err == nil && !strings.HasPrefix(rel, "..") {
+				rels = append(rels, filepath.ToSlash(rel))
+			} else {
+				rels = append(rels, line)
+			}
+		}
+		return rels
+	}
+
+	tests := []struct {
+		args map[string]interface{}
+		want []string
+	}{
+		{map[string]interface{}{"pattern": "**/*.go"}, []string{"internal/ui/ui.go", "internal/ui/ui_test.go", "main.go"}},
+		{map[string]interface{}{"pattern": "*_test.go"}, []string{"internal/ui/ui_test.go"}},
+		{map[string]interface{}{"pattern": "/*.go"}, []string{"main.go"}},
+		{map[string]interface{}{"pattern": "internal/**/ui.go"}, []string{"internal/ui/ui.go"}},
+		{map[string]interface{}{"pattern": "**/index.go", "include_ignored": true}, []string{"node_modules/pkg/index.go"}},
+		{map[string]interface{}{"pattern": "*.rs"}, []string{"No files found"}},
+	}
+	for _, tc := range tests {
+		got := find(FindFilesTool{}, tc.args)
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("find_files %v = %v, want %v", tc.args, got, tc.want)
+		}
+	}
+
+	got := find(FindFilesTool{MaxResults: 2}, map[string]interface{}{"pattern": "**/*.go"})
+	if len(got) != 3 || !strings.Contains(got[2], "and 1 more") {
+		t.Errorf("Expected results capped at 2 with a note, got %v", got)
+	}
+}
+
+func TestSearchFiles_PureGo(t *testing.T) {
+	// No external binaries: an empty PATH would break any shelling out
+	t.Setenv("PATH", "")
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {\n\tprintln(\"a.b\")\n}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("axb\nfunc-y things\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "blob.bin"), []byte("func\x00main"), 0644)
+
+	search := func(args map[string]interface{}) string {
+		t.Helper()
+		out, err := SearchFilesTool{}.Execute(args)
+		if err != nil {
+			t.Fatalf("search_files %v returned error: %v", args, err)
+		}
+		return out
+	}
+
+	out := search(map[string]interface{}{"path": dir, "pattern": "func"})
+	want := filepath.Join(dir, "main.go") + ":3:func main() {\n" + filepath.Join(dir, "notes.txt") + ":2:func-y things\n"
+	if out != want {
+		t.Errorf("Expected path:lineno:line matches without the binary file, got:\n%s", out)
+	}
+
+	// Patterns are literal unless regex is set
+	if out := search(map[string]interface{}{"path": dir, "pattern": "a.b"}); strings.Contains(out, "axb") || !strings.Contains(out, "main.go:4:") {
+		t.Errorf("Expected a literal match only, got:\n%s", out)
+	}
+	if out := search(map[string]interface{}{"path": dir, "pattern": `^a.b$`, "regex": true}); !strings.Contains(out, "notes.txt:1:axb") {
+		t.Errorf("Expected a regex match, got:\n%s", out)
+	}
+	if _, err := (SearchFilesTool{}).Execute(map[string]interface{}{"path": dir, "pattern": "(", "regex": true}); err == nil {
+		t.Error("Expected an invalid regex to be rejected")
+	}
+
+	// A single file can be searched directly
+	if out := search(map[string]interface{}{"path": filepath.Join(dir, "notes.txt"), "pattern": "things"}); !strings.HasSuffix(out, "notes.txt:2:func-y things\n") {
+		t.Errorf("Expected to search a single file, got:\n%s", out)
+	}
+	if out := search(map[string]interface{}{"path": dir, "pattern": "nowhere"}); out != "No matches found" {
+		t.Errorf("Expected 'No matches found', got %q", out)
+	}
+
+	// A line too long to read is reported rather than silently ending the file's search
+	os.WriteFile(filepath.Join(dir, "min.js"), []byte("func\n"+strings.Repeat("x", maxSearchLine+1)+"\nfunc\n"), 0644)
+	if out := search(map[string]interface{}{"path": dir, "pattern": "func"}); !strings.Contains(out, "min.js:1:func") || !strings.Contains(out, "Not fully searched: "+filepath.Join(dir, "min.js")+" (stopped at line 2") {
+		t.Errorf("Expected the overlong line to be reported, got:\n%s", out)
+	}
+}
+
+func TestSearchFiles_SkipsUnreadableDirectories(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any directory")
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("needle\n"), 0644)
+	locked := filepath.Join(dir, "locked")
+	os.Mkdir(locked, 0755)
+	os.WriteFile(filepath.Join(locked, "b.txt"), []byte("needle\n"), 0644)
+	os.Chmod(locked, 0)
+	defer os.Chmod(locked, 0755)
+
+	out, err := SearchFilesTool{}.Execute(map[string]interface{}{"path": dir, "pattern": "needle"})
+	if err != nil || !strings.Contains(out, "a.txt:1:needle") {
+		t.Errorf("Expected the readable files to be searched past an unreadable directory, got %q (err: %v)", out, err)
+	}
+}
+
+func TestReadFile_RefusesBinary(t *testing.T) {
+	dir := t.TempDir()
+	png := filepath.Join(dir, "logo.png")
+	os.WriteFile(png, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644)
+	latin1 := filepath.Join(dir, "latin1.txt")
+	os.WriteFile(latin1, []byte("caf\xe9"), 0644)
+	// A multi-byte character straddling the sniff length is still text
+	utf8Text := filepath.Join(dir, "utf8.txt")
+	os.WriteFile(utf8Text, []byte(strings.Repeat("a", binarySniffLen-1)+"é and more"), 0644)
+
+	for _, path := range []string{png, latin1} {
+		out, err := ReadFileTool{}.Execute(map[string]interface{}{"path": path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(out, "File appears to be binary") || !strings.Contains(out, "bytes") {
+			t.Errorf("Expected %s to be refused as binary, got %q", filepath.Base(path), out)
+		}
+	}
+
+	out, _ := ReadFileTool{}.Execute(map[string]interface{}{"path": png, "allow_binary": true})
+	if !strings.HasPrefix(out, "\x89PNG") {
+		t.Errorf("Expected allow_binary to return raw bytes, got %q", out)
+	}
+	out, _ = ReadFileTool{}.Execute(map[string]interface{}{"path": utf8Text})
+	if !strings.HasSuffix(out, "é and more") {
+		t.Errorf("Expected UTF-8 text to be read, got %q", out[len(out)-20:])
+	}
+}
+
+func TestReadFile_SizeLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.log")
+	os.WriteFile(path, []byte(strings.Repeat("0123456789", 100)), 0644)
+
+	out, err := ReadFileTool{MaxBytes: 100}.Execute(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, strings.Repeat("0123456789", 10)+"\n\n[File truncated") {
+		t.Errorf("Expected the first 100 bytes and a truncation note, got %q", out)
+	}
+	if !strings.Contains(out, "100 of 1000 bytes") || !strings.Contains(out, "read_file_lines") {
+		t.Errorf("Expected the note to give sizes and suggest read_file_lines, got %q", out)
+	}
+
+	// Files within the default limit come back whole
+	out, _ = ReadFileTool{}.Execute(map[string]interface{}{"path": path})
+	if len(out) != 1000 {
+		t.Errorf("Expected the whole file under the default limit, got %d bytes", len(out))
+	}
+}
+
+func TestApplyPatchTool(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	os.WriteFile("main.go", []byte("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n\nfunc helper() int {\n    return 1\n}\n"), 0644)
+	os.WriteFile("old.txt", []byte("bye\n"), 0644)
+
+	// The first hunk's line number is off by two, the second's removed line has different
+	// indentation, and the third doesn't match anything
+	patch := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@
+ import "fmt"
+ 
+ func main() {
+-	fmt.Println("hi")
++	fmt.Println("hello")
+@@ -9,3 +9,3 @@
+ func helper() int {
+-	return 1
++	return 2
+ }
+@@ -40,2 +40,2 @@
+-func missing() {}
++func found() {}
+--- /dev/null
++++ b/docs/new.md
+@@ -0,0 +1,2 @@
++# New
++file
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+	out, err := ApplyPatchTool{}.Execute(map[string]interface{}{"patch": patch})
+	if err != nil {
+		t.Fatalf("apply_patch returned error: %v", err)
+	}
+	for _, want := range []string{"main.go: 2/3 hunks applied", "hunk 1 (@@ -1,4 +1,4 @@): applied at line 3 (offset +2)", "hunk 3 (@@ -40,2 +40,2 @@): failed", "docs/new.md: 1/1 hunks applied", "old.txt: deleted"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in report, got:\n%s", want, out)
+		}
+	}
+
+	content, _ := os.ReadFile("main.go")
+	want := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n\nfunc helper() int {\n\treturn 2\n}\n"
+	if string(content) != want {
+		t.Errorf("Unexpected patched content:\n%s", content)
+	}
+	if content, _ := os.ReadFile("docs/new.md"); string(content) != "# New\nfile\n" {
+		t.Errorf("Expected the new file to be created, got %q", content)
+	}
+	if _, err := os.Stat("old.txt"); err == nil {
+		t.Error("Expected old.txt to be deleted")
+	}
+
+	// Nothing applying is an error, and leaves the file alone
+	_, err = ApplyPatchTool{}.Execute(map[string]interface{}{"patch": "--- main.go\n+++ main.go\n@@ -1,1 +1,1 @@\n-package nope\n+package yes\n"})
+	if err == nil || !strings.Contains(err.Error(), "no hunks applied") {
+		t.Errorf("Expected an error when no hunks apply, got %v", err)
+	}
+	if _, err := (ApplyPatchTool{}).Execute(map[string]interface{}{"patch": "just some text"}); err == nil {
+		t.Error("Expected a patch without file headers to be rejected")
+	}
+
+	if got := FormatToolExecution("apply_patch", map[string]interface{}{"patch": patch}); got != "🩹 Patching: main.go, docs/new.md, old.txt" {
+		t.Errorf("Unexpected display: %q", got)
+	}
+}
+
+func TestApplyPatch_KeepsExistingFilesAndTrashes(t *testing.T) {
+	dir := t.TempDir()
+	trash := filepath.Join(dir, "trash")
+	existing := filepath.Join(dir, "keep.txt")
+	os.WriteFile(existing, []byte("precious\n"), 0644)
+	tool := ApplyPatchTool{Trash: trash}
+
+	// A creation or rename onto an existing file is refused
+	create := "--- /dev/null\n+++ " + existing + "\n@@ -0,0 +1 @@\n+replaced\n"
+	if _, err := tool.Execute(map[string]interface{}{"patch": create}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected creating over an existing file to be refused, got %v", err)
+	}
+	other := filepath.Join(dir, "other.txt")
+	os.WriteFile(other, []byte("a\n"), 0644)
+	rename := "--- " + other + "\n+++ " + existing + "\n@@ -1 +1 @@\n-a\n+b\n"
+	if _, err := tool.Execute(map[string]interface{}{"patch": rename}); err == nil {
+		t.Error("Expected renaming onto an existing file to be refused")
+	}
+	if content, _ := os.ReadFile(existing); string(content) != "precious\n" {
+		t.Errorf("Expected the existing file to be untouched, got %q", content)
+	}
+
+	// Patched and deleted files go to the trash first
+	out, err := tool.Execute(map[string]interface{}{"patch": "--- " + existing + "\n+++ " + existing + "\n@@ -1 +1 @@\n-precious\n+edited\n"})
+	if err != nil || !strings.Contains(out, "original saved to "+trash) {
+		t.Errorf("Expected the original to be saved to the trash, got %q, %v", out, err)
+	}
+	out, err = tool.Execute(map[string]interface{}{"patch": "--- " + other + "\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n"})
+	if err != nil || !strings.Contains(out, "moved to "+trash) {
+		t.Errorf("Expected the deleted file to be moved to the trash, got %q, %v", out, err)
+	}
+	if entries, _ := os.ReadDir(trash); len(entries) != 2 {
+		t.Errorf("Expected 2 files in the trash, got %d", len(entries))
+	}
+	if !IsDestructive("apply_patch") {
+		t.Error("Expected apply_patch to need approval")
+	}
+}
+
+func TestEditFile_ReplaceAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.go")
+	os.WriteFile(path, []byte("oldName := 1\nuse(oldName)\nreturn oldName\n"), 0644)
+
+	out, err := EditFileTool{}.Execute(map[string]interface{}{"path": path, "target": "oldName", "replacement": "newName"})
+	if err != nil || !strings.HasPrefix(out, "Successfully edited "+path+" (1 replacement)") {
+		t.Fatalf("Expected a single replacement by default, got %q, %v", out, err)
+	}
+
+	out, err = EditFileTool{}.Execute(map[string]interface{}{"path": path, "target": "oldName", "replacement": "newName", "replace_all": true})
+	if err != nil || !strings.Contains(out, "(2 replacements)") {
+		t.Fatalf("Expected the remaining 2 occurrences to be replaced, got %q, %v", out, err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "newName := 1\nuse(newName)\nreturn newName\n" {
+		t.Errorf("Unexpected content after replace_all: %q", content)
+	}
+
+	if _, err := (EditFileTool{}).Execute(map[string]interface{}{"path": path, "target": "", "replacement": "x", "replace_all": true}); err == nil {
+		t.Error("Expected an empty target to be rejected")
+	}
+}
+
+func TestEditAndWrite_ReturnDiff(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "list.txt")
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+
+	out, err := EditFileTool{}.Execute(map[string]interface{}{"path": path, "target": "line 10\n", "replacement": "line ten\nline ten and a half\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- " + path + "\n+++ " + path + "\n@@ -7,7 +7,8 @@\n line 7\n line 8\n line 9\n-line 10\n+line ten\n+line ten and a half\n line 11\n line 12\n line 13"
+	if !strings.HasSuffix(out, "\n\n"+want) {
+		t.Errorf("Expected a unified diff of the edit, got:\n%s", out)
+	}
+
+	// Separate changes get separate hunks
+	os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	out, _ = WriteFileTool{}.Execute(map[string]interface{}{"path": path, "content": strings.Replace(strings.Join(lines, "\n"), "line 1\n", "", 1) + "\nline 21\n"})
+	if strings.Count(out, "\n@@ ") != 2 || !strings.Contains(out, "@@ -1,4 +1,3 @@\n-line 1\n") || !strings.Contains(out, "+line 21") {
+		t.Errorf("Expected two hunks, got:\n%s", out)
+	}
+
+	out, _ = WriteFileTool{}.Execute(map[string]interface{}{"path": filepath.Join(dir, "new.txt"), "content": "a\nb\n"})
+	if !strings.Contains(out, "(new file)") || !strings.HasSuffix(out, "@@ -0,0 +1,2 @@\n+a\n+b") {
+		t.Errorf("Expected a new file to diff as all additions, got:\n%s", out)
+	}
+	out, _ = WriteFileTool{}.Execute(map[string]interface{}{"path": filepath.Join(dir, "new.txt"), "content": "a\nb\n"})
+	if !strings.HasSuffix(out, "(no changes)") {
+		t.Errorf("Expected an identical write to report no changes, got:\n%s", out)
+	}
+
+	// Huge rewrites are capped
+	out, _ = WriteFileTool{}.Execute(map[string]interface{}{"path": filepath.Join(dir, "big.txt"), "content": strings.Repeat("x\n", 1000)})
+	if n := strings.Count(out, "\n+x"); n >= 1000 || !strings.Contains(out, "diff truncated") {
+		t.Errorf("Expected the diff to be capped, got %d added lines", n)
+	}
+}
+
+func TestDryRun_ChangesNothing(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "keep.txt")
+	os.WriteFile(file, []byte("one\ntwo\n"), 0644)
+	snapshot := func() string {
+		var entries []string
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			content, _ := os.ReadFile(path)
+			entries = append(entries, path+"="+string(content))
+			return nil
+		})
+		return strings.Join(entries, "\n")
+	}
+	before := snapshot()
+
+	calls := []struct {
+		tool DryRunner
+		args map[string]interface{}
+		want string
+	}{
+		{WriteFileTool{}, map[string]interface{}{"path": file, "content": "one\n2\n"}, "Dry run: would write to " + file + "\n\n--- " + file},
+		{WriteFileTool{}, map[string]interface{}{"path": filepath.Join(dir, "new.txt"), "content": "x\n"}, "would create"},
+		{EditFileTool{}, map[string]interface{}{"path": file, "target": "two", "replacement": "2"}, "-two\n+2"},
+		{AppendToFileTool{}, map[string]interface{}{"path": file, "content": "three\n"}, "+three"},
+		{CreateDirectoryTool{}, map[string]interface{}{"path": filepath.Join(dir, "sub")}, "would create directory"},
+		{DeleteFileTool{}, map[string]interface{}{"path": file}, "would delete"},
+		{MoveFileTool{}, map[string]interface{}{"source": file, "destination": filepath.Join(dir, "moved.txt")}, "would move"},
+		{RunCommandTool{}, map[string]interface{}{"command": "touch " + filepath.Join(dir, "ran")}, "would run command"},
+		{ApplyPatchTool{}, map[string]interface{}{"patch": "--- " + file + "\n+++ " + file + "\n@@ -1,2 +1,2 @@\n one\n-two\n+deux\n"}, "+deux"},
+	}
+	for _, c := range calls {
+		out, err := c.tool.DryRun(c.args)
+		if err != nil {
+			t.Errorf("%T dry run returned error: %v", c.tool, err)
+		}
+		if !strings.Contains(out, c.want) {
+			t.Errorf("Expected %T dry run to mention %q, got:\n%s", c.tool, c.want, out)
+		}
+	}
+
+	if after := snapshot(); after != before {
+		t.Errorf("Dry runs changed the filesystem:\nbefore:\n%s\nafter:\n%s", before, after)
+	}
+
+	// Dry runs still report failures the real call would hit
+	if _, err := (DeleteFileTool{}).DryRun(map[string]interface{}{"path": filepath.Join(dir, "missing")}); err == nil {
+		t.Error("Expected a dry-run delete of a missing file to fail")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	for _, tool := range []Tool{GitStatusTool{}, GetCurrentDirectoryTool{}} {
+		if err := r.Register(tool); err != nil {
+			t.Fatalf("Expected registration to succeed, got %v", err)
+		}
+	}
+	if err := r.Register(GitStatusTool{}); err == nil {
+		t.Error("Expected a duplicate name to be rejected")
+	}
+
+	all := r.All()
+	if len(all) != 2 || all[0].Definition().Name != "git_status" {
+		t.Fatalf("Expected both tools in registration order, got %d", len(all))
+	}
+	// The returned slice is a copy
+	all[0] = nil
+	if r.All()[0] == nil {
+		t.Error("Expected All to return a copy")
+	}
+}
+
+func TestBackupAndTrash(t *testing.T) {
+	dir := t.TempDir()
+	trash := filepath.Join(dir, "trash")
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, []byte("v1\n"), 0644)
+
+	out, err := WriteFileTool{}.Execute(map[string]interface{}{"path": path, "content": "v2\n"})
+	if err != nil || !strings.Contains(out, path+".bak") {
+		t.Fatalf("Expected the backup path in the result, got %q, %v", out, err)
+	}
+	if data, _ := os.ReadFile(path + ".bak"); string(data) != "v1\n" {
+		t.Errorf("Expected the backup to hold the old content, got %q", data)
+	}
+	os.Remove(path + ".bak")
+	if _, err := (WriteFileTool{}).Execute(map[string]interface{}{"path": path, "content": "v3\n", "backup": false}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".bak"); err == nil {
+		t.Error("Expected no backup with backup=false")
+	}
+
+	out, err = EditFileTool{Trash: trash}.Execute(map[string]interface{}{"path": path, "target": "v3", "replacement": "v4"})
+	if err != nil || !strings.Contains(out, "original saved to "+trash) {
+		t.Fatalf("Expected the trash copy in the result, got %q, %v", out, err)
+	}
+	out, err = DeleteFileTool{Trash: trash}.Execute(map[string]interface{}{"path": path})
+	if err != nil || !strings.Contains(out, "moved to "+trash) {
+		t.Fatalf("Expected the trash path in the result, got %q, %v", out, err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Error("Expected the file to be gone")
+	}
+
+	// Each version is kept under its full original path
+	entries, _ := os.ReadDir(trash)
+	var contents []string
+	for _, e := range entries {
+		data, _ := os.ReadFile(trashPathIn(filepath.Join(trash, e.Name()), path))
+		contents = append(contents, string(data))
+	}
+	if !reflect.DeepEqual(contents, []string{"v3\n", "v4\n"}) {
+		t.Errorf("Expected the pre-edit and deleted versions in the trash, got %q", contents)
+	}
+
+	// Entries past TrashMaxAge are pruned; anything else in the trash is left alone
+	old := filepath.Join(trash, time.Now().Add(-TrashMaxAge-time.Hour).Format(trashStampLayout))
+	os.MkdirAll(old, 0755)
+	os.WriteFile(filepath.Join(trash, "README"), nil, 0644)
+	pruneTrash(trash, time.Now())
+	if _, err := os.Stat(old); err == nil {
+		t.Error("Expected the old entry to be pruned")
+	}
+	if entries, _ := os.ReadDir(trash); len(entries) != 3 {
+		t.Errorf("Expected the recent entries and the undated file to be kept, got %d entries", len(entries))
+	}
+}
+
+// trashPathIn is where path's copy sits inside one trash entry
+func trashPathIn(entry, path string) string {
+	return filepath.Join(entry, strings.TrimPrefix(path[len(filepath.VolumeName(path)):], string(filepath.Separator)))
+}
+
+func TestFileStatTool(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.bin")
+	os.WriteFile(path, []byte("12345"), 0640)
+
+	out, err := FileStatTool{}.Execute(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Type: file", "Size: 5 bytes", "Mode: -rw-r-----", "Modified: ", "IsDir: false"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in %q", want, out)
+		}
+	}
+
+	out, err = FileStatTool{}.Execute(map[string]interface{}{"path": dir})
+	if err != nil || !strings.Contains(out, "Type: directory") || !strings.Contains(out, "IsDir: true") {
+		t.Errorf("Expected a directory to be reported as one, got %q, %v", out, err)
+	}
+
+	missing := filepath.Join(dir, "nope")
+	out, err = FileStatTool{}.Execute(map[string]interface{}{"path": missing})
+	if err != nil || out != missing+" does not exist" {
+		t.Errorf("Expected a missing file to be reported without an error, got %q, %v", out, err)
+	}
+}
+
+func TestListDirectory_Recursive(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "a", "b", "c"), 0755)
+	os.MkdirAll(filepath.Join(root, "node_modules", "pkg"), 0755)
+	os.WriteFile(filepath.Join(root, "top.go"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(root, "a", "mid.go"), []byte("xy"), 0644)
+	os.WriteFile(filepath.Join(root, "a", "notes.md"), []byte("z"), 0644)
+	os.WriteFile(filepath.Join(root, "a", "b", "c", "deep.go"), []byte("z"), 0644)
+	os.WriteFile(filepath.Join(root, "node_modules", "pkg", "index.js"), []byte("z"), 0644)
+
+	out, err := ListDirectoryTool{}.Execute(map[string]interface{}{"path": root, "recursive": true, "max_depth": 2.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Contents of " + root + " (depth 2):\n" +
+		"  [DIR]  a/\n" +
+		"    [DIR]  b/\n" +
+		"    [FILE] mid.go (2 bytes)\n" +
+		"    [FILE] notes.md (1 bytes)\n" +
+		"  [FILE] top.go (1 bytes)\n"
+	if out != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, out)
+	}
+
+	out, _ = ListDirectoryTool{}.Execute(map[string]interface{}{"path": root, "recursive": true, "max_depth": 5.0, "filter": "*.go", "include_ignored": true})
+	if !strings.Contains(out, "deep.go") || strings.Contains(out, "notes.md") || !strings.Contains(out, "node_modules/") {
+		t.Errorf("Expected the filter to apply to files and include_ignored to show node_modules, got\n%s", out)
+	}
+
+	out, _ = ListDirectoryTool{MaxEntries: 2}.Execute(map[string]interface{}{"path": root, "recursive": true})
+	if !strings.Contains(out, "…and 4 more") {
+		t.Errorf("Expected the listing to be capped with a count of the rest, got\n%s", out)
+	}
+}
+
+func TestRunCommand_ExecuteStream(t *testing.T) {
+	var lines []string
+	out, err := RunCommandTool{}.ExecuteStream(map[string]interface{}{"command": "echo one; echo two >&2; printf three"}, func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lines, []string{"one", "two", "three"}) {
+		t.Errorf("Expected each line streamed, got %q", lines)
+	}
+	if out != "one\ntwo\nthree" {
+		t.Errorf("Expected the full output as the result, got %q", out)
+	}
+}
+
+func TestLineWriter_CarriageReturnsAndLongLines(t *testing.T) {
+	var lines []string
+	var buf bytes.Buffer
+	w := &lineWriter{w: &buf, onLine: func(line string) { lines = append(lines, line) }}
+	w.Write([]byte("10%\r50%\r"))
+	w.Write([]byte("\ndone\r"))
+	w.Write([]byte("\n" + strings.Repeat("x", maxStreamLineBytes+10)))
+	w.flush()
+
+	want := []string{"10%", "50%", "done", strings.Repeat("x", maxStreamLineBytes), strings.Repeat("x", 10)}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Expected progress updates split on \\r, \\r\\n as one break, and long lines capped, got %d lines: %.40q", len(lines), lines)
+	}
+}
@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidateArguments checks args against the JSON Schema in def.Parameters, covering the
+// subset the built-in tools use: required properties and the basic type of each known
+// property, and the allowed values of enum properties. Unknown properties are allowed,
+// since tools ignore them.
+func ValidateArguments(def ToolDefinition, args map[string]interface{}) error {
+	schema, ok := def.Parameters.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	var problems []string
+	for _, name := range requiredProperties(schema["required"]) {
+		if _, ok := args[name]; !ok {
+			problems = append(problems, fmt.Sprintf("missing required '%s'", name))
+		}
+	}
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, _ := properties[name].(map[string]interface{})
+		want, _ := prop["type"].(string)
+		if want != "" && !hasSchemaType(args[name], want) {
+			problem := fmt.Sprintf("'%s' must be a %s, got %s", name, want, jsonTypeName(args[name]))
+			if s, ok := args[name].(string); ok && (want == "number" || want == "integer") {
+				if _, err := strconv.ParseFloat(s, 64); err == nil {
+					problem += fmt.Sprintf(" (pass %s without quotes)", s)
+				}
+			}
+			problems = append(problems, problem)
+			continue
+		}
+		// An empty string is how models leave an optional enum unset, and tools treat it so
+		if allowed := enumValues(prop["enum"]); len(allowed) > 0 && args[name] != "" && !slices.Contains(allowed, fmt.Sprint(args[name])) {
+			problems = append(problems, fmt.Sprintf("'%s' must be one of %s, got %q", name, strings.Join(allowed, ", "), fmt.Sprint(args[name])))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// requiredProperties accepts "required" as built in Go ([]string) or decoded from JSON ([]interface{})
+func requiredProperties(v interface{}) []string {
+	switch required := v.(type) {
+	case []string:
+		return required
+	case []interface{}:
+		names := make([]string, 0, len(required))
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// enumValues accepts "enum" as built in Go or decoded from JSON, as strings for comparison
+func enumValues(v interface{}) []string {
+	switch values := v.(type) {
+	case []string:
+		return values
+	case []interface{}:
+		out := make([]string, 0, len(values))
+		for _, value := range values {
+			out = append(out, fmt.Sprint(value))
+		}
+		return out
+	}
+	return nil
+}
+
+func hasSchemaType(v interface{}, want string) bool {
+	switch want {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		switch v.(type) {
+		case float64, float32, int, int64:
+			return true
+		}
+		return false
+	case "integer":
+		switch n := v.(type) {
+		case float64:
+			return n == float64(int64(n))
+		case int, int64:
+			return true
+		}
+		return false
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	}
+	return true
+}
+
+// jsonTypeName names v's type the way the schema would
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, float32, int, int64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
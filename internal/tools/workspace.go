@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workspace confines file tools to a directory tree. A nil *Workspace allows any path.
+type Workspace struct {
+	Root string // Absolute, symlink-free directory tools may touch
+}
+
+// NewWorkspace resolves dir to an absolute, symlink-free root
+func NewWorkspace(dir string) (*Workspace, error) {
+	root, err := resolvePath(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace %s: %v", dir, err)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace %s: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("workspace %s is not a directory", dir)
+	}
+	return &Workspace{Root: root}, nil
+}
+
+// Check returns an error if path, once made absolute and with symlinks resolved, lies
+// outside the workspace. Paths that don't exist yet are judged by their nearest existing
+// parent, so a new file can't be created through a symlinked directory either.
+func (w *Workspace) Check(path string) error {
+	if w == nil || w.Root == "" {
+		return nil
+	}
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return fmt.Errorf("invalid path %s: %v", path, err)
+	}
+	rel, err := filepath.Rel(w.Root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path escapes workspace: %s is outside %s", path, w.Root)
+	}
+	return nil
+}
+
+// resolvePath makes path absolute and resolves symlinks in its longest existing prefix
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) || filepath.Dir(dir) == dir {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+	}
+}
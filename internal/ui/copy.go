@@ -0,0 +1,64 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// writeClipboard puts text on the system clipboard; tests replace it
+var writeClipboard = clipboard.WriteAll
+
+// lastResponse returns the content of the newest assistant message, without its prefix
+func (m model) lastResponse() (string, bool) {
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if content, ok := strings.CutPrefix(ansi.Strip(m.messages[i]), "[📎] "); ok {
+			return content, true
+		}
+	}
+	return "", false
+}
+
+// firstCodeBlock returns the body of the first fenced code block in text
+func firstCodeBlock(text string) (string, bool) {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		fence := trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`~"))]
+		if len(fence) < 3 || strings.Trim(fence, fence[:1]) != "" {
+			continue
+		}
+		var body []string
+		for _, l := range lines[i+1:] {
+			if t := strings.TrimSpace(l); strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+				return strings.Join(body, "\n"), true
+			}
+			body = append(body, l)
+		}
+		// An unclosed fence runs to the end, as it would while a response is still streaming
+		return strings.Join(body, "\n"), true
+	}
+	return "", false
+}
+
+// copyResponse copies the last response, or only its first code block, to the clipboard and
+// returns the status line to show
+func (m model) copyResponse(codeOnly bool) string {
+	text, ok := m.lastResponse()
+	if !ok {
+		return styleStatus.Render("[📋] Nothing to copy yet")
+	}
+	what := "response"
+	if codeOnly {
+		if text, ok = firstCodeBlock(text); !ok {
+			return styleStatus.Render("[📋] The last response has no code block")
+		}
+		what = "code block"
+	}
+	if err := writeClipboard(text); err != nil {
+		return styleStatus.Render(fmt.Sprintf("[❌] Error copying to clipboard: %v", err))
+	}
+	return styleStatus.Render(fmt.Sprintf("[📋] Copied %s (%d lines)", what, strings.Count(text, "\n")+1))
+}
@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cellwebb/clippy-go/internal/tools"
+)
+
+// toolParam is one parameter of a tool's JSON Schema, flattened for display
+type toolParam struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+	Enum        []string
+}
+
+// toolParams lists a tool's parameters from its definition, required ones first
+func toolParams(def tools.ToolDefinition) []toolParam {
+	schema, ok := def.Parameters.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	required := make(map[string]bool)
+	switch r := schema["required"].(type) {
+	case []string:
+		for _, name := range r {
+			required[name] = true
+		}
+	case []interface{}:
+		for _, name := range r {
+			if name, ok := name.(string); ok {
+				required[name] = true
+			}
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]interface{})
+	var params []toolParam
+	for name, p := range props {
+		prop, _ := p.(map[string]interface{})
+		param := toolParam{Name: name, Required: required[name]}
+		param.Type, _ = prop["type"].(string)
+		param.Description, _ = prop["description"].(string)
+		switch enum := prop["enum"].(type) {
+		case []string:
+			param.Enum = enum
+		case []interface{}:
+			for _, v := range enum {
+				param.Enum = append(param.Enum, fmt.Sprint(v))
+			}
+		}
+		params = append(params, param)
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].Required != params[j].Required {
+			return params[i].Required
+		}
+		return params[i].Name < params[j].Name
+	})
+	return params
+}
+
+// describeTools renders /tools describe: a summary of every tool, or one tool in detail
+func describeTools(available []tools.Tool, name string) string {
+	if name != "" {
+		for _, t := range available {
+			if def := t.Definition(); def.Name == name {
+				return describeTool(def)
+			}
+		}
+		return styleStatus.Render(fmt.Sprintf("[❌] Unknown tool: %s (see /tools describe)", name))
+	}
+
+	report := fmt.Sprintf("\n%s[🧰] TOOLS%s\n", styleHeader.Render(""), styleHeader.Render(""))
+	for _, t := range available {
+		def := t.Definition()
+		var names []string
+		for _, p := range toolParams(def) {
+			if p.Required {
+				names = append(names, p.Name)
+			} else {
+				names = append(names, "["+p.Name+"]")
+			}
+		}
+		report += fmt.Sprintf("%s%s(%s)\n", styleStatus.Render("  "), styleClippy.Render(def.Name), strings.Join(names, ", "))
+		report += fmt.Sprintf("%s%s\n", styleStatus.Render("    "), def.Description)
+	}
+	report += styleStatus.Render("  Use /tools describe <name> for parameter details.")
+	return report
+}
+
+// describeTool renders one tool's description and parameters
+func describeTool(def tools.ToolDefinition) string {
+	report := fmt.Sprintf("\n%s[🧰] %s%s\n", styleHeader.Render(""), def.Name, styleHeader.Render(""))
+	report += fmt.Sprintf("%s%s\n", styleStatus.Render("  "), def.Description)
+
+	params := toolParams(def)
+	if len(params) == 0 {
+		report += styleStatus.Render("  No parameters.")
+		return report
+	}
+	report += fmt.Sprintf("\n%sParameters:\n", styleStatus.Render("  "))
+	for _, p := range params {
+		kind := p.Type
+		if p.Required {
+			kind += ", required"
+		} else {
+			kind += ", optional"
+		}
+		report += fmt.Sprintf("%s%s (%s): %s\n", styleStatus.Render("    "), styleClippy.Render(p.Name), kind, p.Description)
+		if len(p.Enum) > 0 {
+			report += fmt.Sprintf("%sOne of: %s\n", styleStatus.Render("      "), strings.Join(p.Enum, ", "))
+		}
+	}
+	return strings.TrimSuffix(report, "\n")
+}
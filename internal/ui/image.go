@@ -0,0 +1,37 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// attachImage loads the image at path (relative to the working directory) into the next
+// turn and returns the status line to show
+func (m *model) attachImage(path string) string {
+	if path == "" {
+		return styleStatus.Render("[🖼️] Usage: /image <path>")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(m.agent.WorkDir, path)
+	}
+	img, err := llm.LoadImage(path)
+	if err != nil {
+		return styleStatus.Render(fmt.Sprintf("[❌] %v", err))
+	}
+	m.agent.NextTurn.Images = append(m.agent.NextTurn.Images, img)
+
+	status := fmt.Sprintf("[🖼️] Attached %s (%s); it goes with your next message", filepath.Base(path), img.MediaType)
+	if n := len(m.agent.NextTurn.Images); n > 1 {
+		status += fmt.Sprintf(" along with %d other image(s)", n-1)
+	}
+	if cfg := m.agent.GetConfig(); !llm.SupportsImages(cfg) {
+		name := cfg.Model
+		if name == "" {
+			name = "the current model"
+		}
+		status += fmt.Sprintf(". Heads up: %s doesn't take images, so only your text will be sent", name)
+	}
+	return styleStatus.Render(status)
+}
@@ -0,0 +1,102 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// inspectPreviewLen is how much of each message /inspect shows
+const inspectPreviewLen = 60
+
+// handleInspect runs an /inspect subcommand and returns the text to display
+func (m *model) handleInspect(args []string) string {
+	if len(args) == 0 {
+		return m.inspectReport()
+	}
+
+	switch args[0] {
+	case "tool":
+		if len(args) != 3 || (args[2] != "on" && args[2] != "off") {
+			return styleStatus.Render("[⚙️] Usage: /inspect tool <name> on|off")
+		}
+		name := args[1]
+		known := false
+		for _, t := range m.agent.GetToolDefinitions() {
+			if t.Definition().Name == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return styleStatus.Render(fmt.Sprintf("[❌] Unknown tool: %s", name))
+		}
+		if args[2] == "off" {
+			if m.agent.NextTurn.DisabledTools == nil {
+				m.agent.NextTurn.DisabledTools = make(map[string]bool)
+			}
+			m.agent.NextTurn.DisabledTools[name] = true
+		} else {
+			delete(m.agent.NextTurn.DisabledTools, name)
+		}
+		return styleStatus.Render(fmt.Sprintf("[🔍] %s turned %s for the next turn", name, args[2]))
+	case "model":
+		if len(args) != 2 {
+			return styleStatus.Render("[⚙️] Usage: /inspect model <name>")
+		}
+		m.agent.NextTurn.Model = args[1]
+		return styleStatus.Render(fmt.Sprintf("[🔍] Next turn will use model: %s", args[1]))
+	case "reset":
+		m.agent.NextTurn.DisabledTools = nil
+		m.agent.NextTurn.Model = ""
+		return styleStatus.Render("[🔍] Next-turn overrides cleared")
+	default:
+		return styleStatus.Render("[⚙️] Usage: /inspect [tool <name> on|off | model <name> | reset]")
+	}
+}
+
+// inspectReport renders the request the next message will be sent with
+func (m model) inspectReport() string {
+	enabled, cfg := m.agent.PendingRequest()
+
+	report := fmt.Sprintf("\n%s[🔍] NEXT REQUEST%s\n", styleHeader.Render(""), styleHeader.Render(""))
+	report += fmt.Sprintf("%sProvider: %s\n", styleStatus.Render("  "), styleClippy.Render(cfg.Provider))
+	modelName := cfg.Model
+	if m.agent.NextTurn.Model != "" {
+		modelName += " (override)"
+	}
+	report += fmt.Sprintf("%sModel: %s\n", styleStatus.Render("  "), styleClippy.Render(modelName))
+	report += fmt.Sprintf("%sStream: %s\n", styleStatus.Render("  "), styleClippy.Render(fmt.Sprintf("%t", cfg.Stream)))
+
+	history := m.agent.GetHistory()
+	report += fmt.Sprintf("%sMessages: %d + your next input\n", styleStatus.Render("  "), len(history))
+	for i, msg := range history {
+		content := strings.Join(strings.Fields(msg.Content), " ")
+		if len([]rune(content)) > inspectPreviewLen {
+			content = string([]rune(content)[:inspectPreviewLen]) + "…"
+		}
+		if len(msg.ToolCalls) > 0 {
+			var names []string
+			for _, tc := range msg.ToolCalls {
+				names = append(names, tc.Name)
+			}
+			content += fmt.Sprintf(" [calls: %s]", strings.Join(names, ", "))
+		}
+		role := msg.Role
+		if msg.Example {
+			role += " (example)"
+		}
+		report += fmt.Sprintf("%s%d. %s: %s\n", styleStatus.Render("    "), i+1, role, content)
+	}
+
+	var enabledNames []string
+	for _, t := range enabled {
+		enabledNames = append(enabledNames, t.Definition().Name)
+	}
+	report += fmt.Sprintf("%sTools (%d of %d): %s\n", styleStatus.Render("  "), len(enabled), len(m.agent.GetToolDefinitions()), styleClippy.Render(strings.Join(enabledNames, ", ")))
+	if len(m.agent.NextTurn.DisabledTools) > 0 {
+		report += fmt.Sprintf("%sDisabled for next turn: %s\n", styleStatus.Render("  "), stylePrompt.Render(strings.Join(sortedKeys(m.agent.NextTurn.DisabledTools), ", ")))
+	}
+
+	report += styleStatus.Render("  Tweak with /inspect tool <name> on|off, /inspect model <name>, or /inspect reset. Overrides apply to your next message only.")
+	return report
+}
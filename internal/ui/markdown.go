@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	glamouransi "github.com/charmbracelet/glamour/ansi"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// codeBlockTheme is the chroma style for fenced code blocks; its pinks and purples suit the palette
+const codeBlockTheme = "dracula"
+
+// maxMarkdownCache is how many rendered messages markdownRenderer keeps; the oldest go first
+const maxMarkdownCache = 256
+
+// markdownRenderer renders assistant messages as Markdown. Building a glamour renderer is
+// slow and the viewport is redrawn on every keystroke, so the renderer is rebuilt only when
+// the width or theme changes, and the latest messages' output is cached.
+type markdownRenderer struct {
+	width    int
+	theme    Theme
+	renderer *glamour.TermRenderer
+	cache    map[string]string
+	order    []string // Cache keys, oldest first
+}
+
+// render returns text rendered as Markdown and wrapped to width, or false if rendering failed
+func (r *markdownRenderer) render(text string, width int) (string, bool) {
+	if r.renderer == nil || r.width != width || r.theme != currentTheme {
+		renderer, err := glamour.NewTermRenderer(
+			glamour.WithStyles(markdownStyle(currentTheme)),
+			glamour.WithWordWrap(width),
+			glamour.WithColorProfile(lipgloss.ColorProfile()),
+		)
+		if err != nil {
+			return "", false
+		}
+		r.renderer, r.width, r.theme = renderer, width, currentTheme
+		r.cache = make(map[string]string)
+		r.order = nil
+	}
+	if out, ok := r.cache[text]; ok {
+		return out, true
+	}
+	out, err := r.renderer.Render(text)
+	if err != nil {
+		return "", false
+	}
+	out = strings.Trim(out, "\n")
+	if len(r.order) >= maxMarkdownCache {
+		delete(r.cache, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.cache[text] = out
+	r.order = append(r.order, text)
+	return out, true
+}
+
+// markdownStyle adapts glamour's dark style to the theme: no document margin, since the
+// viewport already has a border, and headings, links and inline code in the theme's colors
+func markdownStyle(t Theme) glamouransi.StyleConfig {
+	s := styles.DarkStyleConfig
+	s.Document = glamouransi.StyleBlock{Margin: uintPtr(0)}
+
+	s.Heading.StylePrimitive.Color = stringPtr(t.Prompt)
+	s.H1 = glamouransi.StyleBlock{StylePrimitive: glamouransi.StylePrimitive{Prefix: "# "}}
+	s.H6.StylePrimitive.Color = stringPtr(t.Status)
+
+	s.Link.Color = stringPtr(t.User)
+	s.LinkText.Color = stringPtr(t.Prompt)
+	s.Code.StylePrimitive.Color = stringPtr(t.User)
+	s.Item.Color = stringPtr(t.Clippy)
+	s.Enumeration.Color = stringPtr(t.Clippy)
+	s.HorizontalRule.Color = stringPtr(t.Border)
+	s.BlockQuote.StylePrimitive.Color = stringPtr(t.Status)
+
+	s.CodeBlock = glamouransi.StyleCodeBlock{
+		StyleBlock: glamouransi.StyleBlock{Margin: uintPtr(0)},
+		Theme:      codeBlockTheme,
+	}
+	return s
+}
+
+func stringPtr(s string) *string { return &s }
+func uintPtr(u uint) *uint       { return &u }
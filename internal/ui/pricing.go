@@ -0,0 +1,131 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// modelPrice is what a model costs in dollars per million prompt and completion tokens, and
+// per million prompt tokens read from the provider's cache
+type modelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+	Cached     float64 `json:"cached"`
+}
+
+// defaultPricing lists published API rates. Dated and -latest variants match by prefix, so
+// "gpt-4o-2024-08-06" is priced as "gpt-4o".
+var defaultPricing = map[string]modelPrice{
+	"gpt-4o":            {2.50, 10, 1.25},
+	"gpt-4o-mini":       {0.15, 0.60, 0.075},
+	"gpt-4.1":           {2, 8, 0.50},
+	"gpt-4.1-mini":      {0.40, 1.60, 0.10},
+	"gpt-4.1-nano":      {0.10, 0.40, 0.025},
+	"gpt-4-turbo":       {10, 30, 10},
+	"gpt-4":             {30, 60, 30},
+	"gpt-3.5-turbo":     {0.50, 1.50, 0.50},
+	"o1":                {15, 60, 7.50},
+	"o1-mini":           {1.10, 4.40, 0.55},
+	"o3":                {2, 8, 0.50},
+	"o3-mini":           {1.10, 4.40, 0.55},
+	"o4-mini":           {1.10, 4.40, 0.275},
+	"claude-opus-4":     {15, 75, 1.50},
+	"claude-sonnet-4":   {3, 15, 0.30},
+	"claude-3-7-sonnet": {3, 15, 0.30},
+	"claude-3-5-sonnet": {3, 15, 0.30},
+	"claude-3-5-haiku":  {0.80, 4, 0.08},
+	"claude-3-opus":     {15, 75, 1.50},
+	"claude-3-haiku":    {0.25, 1.25, 0.03},
+}
+
+// pricingPath is where rate overrides are read from
+func pricingPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".clippy", "pricing.json")
+}
+
+// loadPricing returns the default rates with any from path layered on top. The file maps
+// model names to {"prompt": ..., "completion": ..., "cached": ...} in dollars per million
+// tokens; cached is optional and defaults to the prompt rate.
+func loadPricing(path string) (map[string]modelPrice, error) {
+	pricing := make(map[string]modelPrice, len(defaultPricing))
+	for name, price := range defaultPricing {
+		pricing[name] = price
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return pricing, err
+	}
+	var overrides map[string]struct {
+		Prompt     float64  `json:"prompt"`
+		Completion float64  `json:"completion"`
+		Cached     *float64 `json:"cached"`
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return pricing, fmt.Errorf("invalid pricing %s: %v", path, err)
+	}
+	for name, price := range overrides {
+		if price.Prompt < 0 || price.Completion < 0 || (price.Cached != nil && *price.Cached < 0) {
+			return pricing, fmt.Errorf("invalid pricing for %s in %s: rates can't be negative", name, path)
+		}
+	}
+	for name, price := range overrides {
+		cached := price.Prompt
+		if price.Cached != nil {
+			cached = *price.Cached
+		}
+		pricing[name] = modelPrice{Prompt: price.Prompt, Completion: price.Completion, Cached: cached}
+	}
+	return pricing, nil
+}
+
+// priceFor looks up a model's rates: an exact match, else the longest name the model
+// starts with. Local ollama models are free.
+func priceFor(pricing map[string]modelPrice, provider, model string) (modelPrice, bool) {
+	if provider == "ollama" {
+		return modelPrice{}, true
+	}
+	if price, ok := pricing[model]; ok {
+		return price, true
+	}
+	best := ""
+	for name := range pricing {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return modelPrice{}, false
+	}
+	return pricing[best], true
+}
+
+// estimateCost prices the session's tokens at the model's rates, or "unknown" if the model
+// isn't in the table. cachedTokens are the part of promptTokens read from the cache.
+func estimateCost(pricing map[string]modelPrice, provider, model string, promptTokens, cachedTokens, completionTokens int) string {
+	price, ok := priceFor(pricing, provider, model)
+	if !ok {
+		return "unknown"
+	}
+	fresh := promptTokens - cachedTokens
+	cost := (float64(fresh)*price.Prompt + float64(cachedTokens)*price.Cached + float64(completionTokens)*price.Completion) / 1e6
+	return fmt.Sprintf("$%.4f", cost)
+}
+
+// rateSummary describes a model's rates for /status
+func rateSummary(pricing map[string]modelPrice, provider, model string) string {
+	price, ok := priceFor(pricing, provider, model)
+	switch {
+	case !ok:
+		return fmt.Sprintf("unknown (add %s to %s)", model, pricingPath())
+	case provider == "ollama":
+		return "free (local)"
+	}
+	return fmt.Sprintf("$%.2f prompt / $%.2f cached / $%.2f completion per 1M tokens", price.Prompt, price.Cached, price.Completion)
+}
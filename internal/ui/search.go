@@ -0,0 +1,169 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxInputHistory caps how many past inputs are kept between sessions
+const maxInputHistory = 500
+
+// inputHistoryPath is where submitted inputs are kept for ctrl+r search
+func inputHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".clippy", "input_history.json")
+}
+
+// loadInputHistory reads past inputs, oldest first; a missing file is an empty history
+func loadInputHistory(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var history []string
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("invalid input history %s: %v", path, err)
+	}
+	return history, nil
+}
+
+// saveInputHistory writes the most recent maxInputHistory inputs to path
+func saveInputHistory(path string, history []string) error {
+	if path == "" {
+		return fmt.Errorf("could not determine home directory")
+	}
+	if len(history) > maxInputHistory {
+		history = history[len(history)-maxInputHistory:]
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// recordInput adds a submitted input to the history, skipping immediate repeats, and ends
+// any up/down browsing
+func (m *model) recordInput(input string) {
+	m.historyIdx = -1
+	m.historyDraft = ""
+	if n := len(m.inputHistory); n > 0 && m.inputHistory[n-1] == input {
+		return
+	}
+	m.inputHistory = append(m.inputHistory, input)
+}
+
+// recallOlder replaces the input with the previous history entry, saving the draft the
+// first time so recallNewer can bring it back. Reports false if there's nothing older.
+func (m *model) recallOlder() bool {
+	if len(m.inputHistory) == 0 || m.historyIdx == 0 {
+		return false
+	}
+	if m.historyIdx < 0 {
+		m.historyDraft = m.textArea.Value()
+		m.historyIdx = len(m.inputHistory)
+	}
+	m.historyIdx--
+	m.textArea.SetValue(m.inputHistory[m.historyIdx])
+	m.resizeTextarea()
+	return true
+}
+
+// recallNewer steps forward through the history, ending at the saved draft. Reports false
+// when not browsing the history.
+func (m *model) recallNewer() bool {
+	if m.historyIdx < 0 {
+		return false
+	}
+	m.historyIdx++
+	if m.historyIdx >= len(m.inputHistory) {
+		m.historyIdx = -1
+		m.textArea.SetValue(m.historyDraft)
+		m.historyDraft = ""
+	} else {
+		m.textArea.SetValue(m.inputHistory[m.historyIdx])
+	}
+	m.resizeTextarea()
+	return true
+}
+
+// startSearch enters reverse-incremental search, remembering the input to restore on cancel
+func (m *model) startSearch() {
+	m.searching = true
+	m.searchQuery = ""
+	m.searchIdx = -1
+	m.searchOrig = m.textArea.Value()
+	m.suggestions = nil
+}
+
+// findMatch returns the newest input before index from that contains the query, or -1
+func (m model) findMatch(from int) int {
+	for i := min(from, len(m.inputHistory)) - 1; i >= 0; i-- {
+		if strings.Contains(m.inputHistory[i], m.searchQuery) {
+			return i
+		}
+	}
+	return -1
+}
+
+// searchMatch returns the input the search currently points at
+func (m model) searchMatch() string {
+	if m.searchIdx < 0 {
+		return ""
+	}
+	return m.inputHistory[m.searchIdx]
+}
+
+// updateSearch handles keys in search mode: typing narrows the match, ctrl+r finds an older
+// one, enter accepts it into the input, and esc or ctrl+c restores what was there before
+func (m model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.searching = false
+		if m.searchIdx >= 0 {
+			m.textArea.SetValue(m.searchMatch())
+		}
+		m.resizeTextarea()
+	case tea.KeyEsc, tea.KeyCtrlC, tea.KeyCtrlG:
+		m.searching = false
+		m.textArea.SetValue(m.searchOrig)
+		m.resizeTextarea()
+	case tea.KeyCtrlR:
+		if m.searchIdx >= 0 {
+			if older := m.findMatch(m.searchIdx); older >= 0 {
+				m.searchIdx = older
+			}
+		}
+	case tea.KeyBackspace:
+		if m.searchQuery != "" {
+			runes := []rune(m.searchQuery)
+			m.searchQuery = string(runes[:len(runes)-1])
+			m.searchIdx = m.findMatch(len(m.inputHistory))
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.searchQuery += string(msg.Runes)
+		m.searchIdx = m.findMatch(len(m.inputHistory))
+	}
+	return m, nil
+}
+
+// searchView renders the search prompt shown in place of the input
+func (m model) searchView() string {
+	label := "reverse-i-search"
+	if m.searchIdx < 0 && m.searchQuery != "" {
+		label = "failing reverse-i-search"
+	}
+	match := strings.ReplaceAll(m.searchMatch(), "\n", " ⏎ ")
+	return styleStatus.Render(fmt.Sprintf("(%s)'%s': ", label, m.searchQuery)) + styleUser.Render(match)
+}
@@ -0,0 +1,240 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// session is a saved conversation: the agent's history plus what the UI shows and counts for it
+type session struct {
+	history          []llm.Message
+	messages         []string
+	lines            map[int]lineInfo
+	totalTokens      int
+	promptTokens     int
+	completionTokens int
+	cachedTokens     int
+	toolCounts       map[string]int
+}
+
+// snapshot deep-copies the active conversation into a session
+func (m model) snapshot() session {
+	toolCounts := make(map[string]int, len(m.toolCounts))
+	for name, n := range m.toolCounts {
+		toolCounts[name] = n
+	}
+	lines := make(map[int]lineInfo, len(m.lines))
+	for i, info := range m.lines {
+		lines[i] = info
+	}
+	return session{
+		history:          m.agent.CloneHistory(),
+		messages:         append([]string(nil), m.messages...),
+		lines:            lines,
+		totalTokens:      m.totalTokens,
+		promptTokens:     m.promptTokens,
+		completionTokens: m.completionTokens,
+		cachedTokens:     m.cachedTokens,
+		toolCounts:       toolCounts,
+	}
+}
+
+// restore makes s the active conversation
+func (m *model) restore(s session) {
+	m.agent.History = s.history
+	m.messages = s.messages
+	m.lines = s.lines
+	m.totalTokens = s.totalTokens
+	m.promptTokens = s.promptTokens
+	m.completionTokens = s.completionTokens
+	m.cachedTokens = s.cachedTokens
+	m.toolCounts = s.toolCounts
+}
+
+// fork parks the active conversation and continues in a copy of it
+func (m *model) fork() string {
+	if m.sessions == nil {
+		m.sessions = []session{{}}
+	}
+	original := m.sessionIdx + 1
+	m.sessions[m.sessionIdx] = m.snapshot()
+	m.sessions = append(m.sessions, session{})
+	m.sessionIdx = len(m.sessions) - 1
+	// The fork gets its own copy so the parked original never sees its changes
+	m.restore(m.snapshot())
+	return styleStatus.Render(fmt.Sprintf("[🍴] Forked into session %d; /sessions %d goes back to the original", m.sessionIdx+1, original))
+}
+
+// handleSessions lists the sessions, or switches to the one numbered in args
+func (m *model) handleSessions(args []string) string {
+	if len(args) == 0 {
+		if len(m.sessions) == 0 {
+			return styleStatus.Render("[⚙️] Only one session so far; /fork starts another")
+		}
+		list := "Sessions:\n"
+		for i, s := range m.sessions {
+			marker := "  "
+			count := len(s.messages)
+			if i == m.sessionIdx {
+				marker = "> "
+				count = len(m.messages)
+			}
+			list += fmt.Sprintf("%s%d - %d messages\n", marker, i+1, count)
+		}
+		return list
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if len(args) > 1 || err != nil || n < 1 || n > max(len(m.sessions), 1) {
+		return styleStatus.Render("[⚙️] Usage: /sessions [number]")
+	}
+	if n-1 == m.sessionIdx {
+		return styleStatus.Render(fmt.Sprintf("[⚙️] Already in session %d", n))
+	}
+	m.sessions[m.sessionIdx] = m.snapshot()
+	m.sessionIdx = n - 1
+	m.restore(m.sessions[m.sessionIdx])
+	return styleStatus.Render(fmt.Sprintf("[🍴] Switched to session %d", n))
+}
+
+// sessionsDir is where /save, /load, and quitting keep saved conversations
+func sessionsDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".clippy", "sessions")
+}
+
+// SessionPath resolves a saved session name to its file; paths to .json files are used as-is
+func SessionPath(name string) (string, error) {
+	if strings.HasSuffix(name, ".json") && strings.ContainsRune(name, filepath.Separator) {
+		return name, nil
+	}
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid session name %q", name)
+	}
+	dir := sessionsDir()
+	if dir == "" {
+		return "", fmt.Errorf("could not determine home directory")
+	}
+	return filepath.Join(dir, strings.TrimSuffix(name, ".json")+".json"), nil
+}
+
+// timestampName names a session saved without an explicit name
+func timestampName(t time.Time) string {
+	return t.Format("2006-01-02T15-04-05")
+}
+
+// saveSession writes the conversation under name (a timestamp when empty) and reports where
+func (m model) saveSession(name string) (string, error) {
+	if name == "" {
+		name = timestampName(time.Now())
+	}
+	path, err := SessionPath(name)
+	if err != nil {
+		return "", err
+	}
+	return path, m.agent.SaveSession(path)
+}
+
+// saveOnQuit keeps the conversation for next time when auto-save is on, unless nothing was said
+func (m model) saveOnQuit() {
+	if m.autoSave && len(m.agent.Conversation()) > 0 {
+		m.saveSession("")
+	}
+}
+
+// requestQuit quits, first asking for confirmation if that's enabled and the conversation
+// would otherwise be lost
+func (m *model) requestQuit() tea.Cmd {
+	if m.confirmQuit && !m.autoSave && m.unsaved && !m.quitPending {
+		m.quitPending = true
+		m.messages = append(m.messages, styleStatus.Render("[⚠️] Really quit? Unsaved changes — y/n"))
+		m.updateViewport()
+		return nil
+	}
+	m.saveOnQuit()
+	saveInputHistory(inputHistoryPath(), m.inputHistory)
+	m.quitting = true
+	return tea.Quit
+}
+
+// loadSession replaces the conversation with a saved one and re-renders the transcript
+func (m *model) loadSession(name string) string {
+	path, err := SessionPath(name)
+	if err == nil {
+		err = m.agent.LoadSession(path)
+	}
+	if err != nil {
+		return styleStatus.Render(fmt.Sprintf("[❌] Error loading session: %v", err))
+	}
+	m.messages, m.lines = renderHistory(m.agent.Conversation())
+	m.unsaved = false
+	return styleStatus.Render(fmt.Sprintf("[💾] Loaded session from %s", path))
+}
+
+// exportMarkdown writes the conversation to path as Markdown, adding the .md extension if missing
+func (m model) exportMarkdown(path string) (string, error) {
+	if filepath.Ext(path) != ".md" {
+		path += ".md"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := m.agent.ExportMarkdown(f); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return path, nil
+}
+
+// renderHistory rebuilds the transcript lines for a conversation, with what's known about
+// each line by index: its time, and for a tool call the result it got
+func renderHistory(conversation []llm.Message) ([]string, map[int]lineInfo) {
+	results := make(map[string]string)
+	for _, msg := range conversation {
+		if msg.Role == "tool" {
+			results[msg.ToolCallID] = msg.Content
+		}
+	}
+
+	var messages []string
+	lines := make(map[int]lineInfo)
+	for _, msg := range conversation {
+		switch msg.Role {
+		case "user":
+			messages = append(messages, styleUser.Render("[You] ")+msg.Content)
+		case "assistant":
+			for _, tc := range msg.ToolCalls {
+				entry := toolEntry{name: tc.Name, args: tc.Arguments, result: results[tc.ID]}
+				messages = append(messages, entry.render(false))
+				lines[len(messages)-1] = lineInfo{time: msg.Time, tool: &entry}
+			}
+			if msg.Content == "" || len(msg.ToolCalls) > 0 {
+				continue
+			}
+			messages = append(messages, styleClippy.Render("[📎] ")+msg.Content)
+		default:
+			continue
+		}
+		if !msg.Time.IsZero() {
+			lines[len(messages)-1] = lineInfo{time: msg.Time}
+		}
+	}
+	return messages, lines
+}
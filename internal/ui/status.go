@@ -0,0 +1,372 @@
+package ui
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cellwebb/clippy-go/internal/llm"
+)
+
+// statusReport renders the /status overview of config, usage, and tools
+func (m model) statusReport() string {
+	// Get config status
+	cfg := m.agent.GetConfig()
+	statusMsg := fmt.Sprintf("\n%s[⚙️] CONFIG STATUS%s\n", styleHeader.Render(""), styleHeader.Render(""))
+	statusMsg += fmt.Sprintf("%sProvider: %s\n", styleStatus.Render("  "), styleClippy.Render(cfg.Provider))
+	if cfg.Profile != "" {
+		statusMsg += fmt.Sprintf("%sProfile: %s\n", styleStatus.Render("  "), styleClippy.Render(fmt.Sprintf("%s (%s)", cfg.Profile, llm.DefaultConfigPath())))
+	}
+	modelName := cfg.Model
+	if modelName != "" && modelName == llm.DefaultModels[cfg.Provider] {
+		modelName += fmt.Sprintf(" (default for %s)", cfg.Provider)
+	}
+	statusMsg += fmt.Sprintf("%sModel: %s\n", styleStatus.Render("  "), styleClippy.Render(modelName))
+	statusMsg += fmt.Sprintf("%sRate: %s\n", styleStatus.Render("  "), styleClippy.Render(rateSummary(m.pricing, cfg.Provider, cfg.Model)))
+	if cfg.BaseURL != "" {
+		statusMsg += fmt.Sprintf("%sBase URL: %s\n", styleStatus.Render("  "), styleClippy.Render(cfg.BaseURL))
+	} else {
+		switch cfg.Provider {
+		case "openai":
+			statusMsg += fmt.Sprintf("%sBase URL: %s\n", styleStatus.Render("  "), styleClippy.Render("https://api.openai.com/v1"))
+		case "azure":
+			statusMsg += fmt.Sprintf("%sBase URL: %s\n", styleStatus.Render("  "), styleClippy.Render(cfg.AzureEndpoint))
+		case "anthropic":
+			statusMsg += fmt.Sprintf("%sBase URL: %s\n", styleStatus.Render("  "), styleClippy.Render("https://api.anthropic.com/v1"))
+		case "ollama":
+			statusMsg += fmt.Sprintf("%sBase URL: %s\n", styleStatus.Render("  "), styleClippy.Render(llm.DefaultOllamaURL))
+		default:
+			statusMsg += fmt.Sprintf("%sBase URL: %s\n", styleStatus.Render("  "), styleClippy.Render("default"))
+		}
+	}
+	maxTokens := "provider default"
+	if cfg.MaxTokens > 0 {
+		maxTokens = fmt.Sprintf("%d", cfg.MaxTokens)
+	} else if cfg.Provider == "anthropic" {
+		maxTokens = fmt.Sprintf("%d (default)", llm.DefaultAnthropicMaxTokens)
+	}
+	statusMsg += fmt.Sprintf("%sMax tokens: %s\n", styleStatus.Render("  "), styleClippy.Render(maxTokens))
+	if cfg.Seed != nil {
+		seed := fmt.Sprintf("%d", *cfg.Seed)
+		if cfg.Provider != "openai" && cfg.Provider != "azure" {
+			seed += fmt.Sprintf(" (ignored by %s)", cfg.Provider)
+		}
+		statusMsg += fmt.Sprintf("%sSeed: %s\n", styleStatus.Render("  "), styleClippy.Render(seed))
+	}
+	statusMsg += fmt.Sprintf("%sWorking directory: %s\n", styleStatus.Render("  "), styleClippy.Render(m.agent.WorkDir))
+	if m.agent.Workspace != nil && m.agent.Workspace.Root != m.agent.WorkDir {
+		statusMsg += fmt.Sprintf("%sWorkspace: %s\n", styleStatus.Render("  "), styleClippy.Render(m.agent.Workspace.Root))
+	}
+	if m.agent.ReadOnly {
+		statusMsg += fmt.Sprintf("%sRead-only: %s\n", styleStatus.Render("  "), styleClippy.Render("on"))
+	}
+	if m.agent.DryRun {
+		statusMsg += fmt.Sprintf("%sDry run: %s\n", styleStatus.Render("  "), styleClippy.Render("on"))
+	}
+	if cfg.DebugLog != "" {
+		statusMsg += fmt.Sprintf("%sDebug log: %s\n", styleStatus.Render("  "), styleClippy.Render(cfg.DebugLog))
+	}
+	if cfg.APIKey != "" {
+		statusMsg += fmt.Sprintf("%sAPI Key: %s (%s...%s)\n", styleStatus.Render("  "), styleClippy.Render("***configured***"), cfg.APIKey[:4], cfg.APIKey[len(cfg.APIKey)-4:])
+	} else {
+		statusMsg += fmt.Sprintf("%sAPI Key: %s\n", styleStatus.Render("  "), styleClippy.Render("not set"))
+	}
+
+	// Message breakdown
+	statusMsg += fmt.Sprintf("\n%s[📊] MESSAGE BREAKDOWN%s\n", styleHeader.Render(""), styleHeader.Render(""))
+
+	systemCount := 0
+	userCount := 0
+	assistantCount := 0
+	toolCount := 0
+	systemTokens := 0
+	userTokens := 0
+	assistantTokens := 0
+	toolTokens := 0
+
+	for _, msg := range m.agent.GetHistory() {
+		if msg.Example {
+			continue
+		}
+		switch msg.Role {
+		case "system":
+			systemCount++
+			if msg.Usage != nil {
+				systemTokens += msg.Usage.TotalTokens
+			}
+		case "user":
+			userCount++
+			if msg.Usage != nil {
+				userTokens += msg.Usage.TotalTokens
+			}
+		case "assistant":
+			assistantCount++
+			if msg.Usage != nil {
+				assistantTokens += msg.Usage.TotalTokens
+			}
+		case "tool":
+			toolCount++
+			if msg.Usage != nil {
+				toolTokens += msg.Usage.TotalTokens
+			}
+		}
+	}
+
+	statusMsg += fmt.Sprintf("%sSystem messages: %s%d%s (%s%d%s tokens)\n",
+		styleStatus.Render("  "), stylePrompt.Render(""), systemCount, styleStatus.Render(""),
+		styleHeader.Render(""), systemTokens, styleStatus.Render(""))
+	statusMsg += fmt.Sprintf("%sUser messages: %s%d%s (%s%d%s tokens)\n",
+		styleStatus.Render("  "), styleUser.Render(""), userCount, styleStatus.Render(""),
+		styleHeader.Render(""), userTokens, styleStatus.Render(""))
+	statusMsg += fmt.Sprintf("%sAssistant messages: %s%d%s (%s%d%s tokens)\n",
+		styleStatus.Render("  "), styleClippy.Render(""), assistantCount, styleStatus.Render(""),
+		styleHeader.Render(""), assistantTokens, styleStatus.Render(""))
+	statusMsg += fmt.Sprintf("%sTool calls/responses: %s%d%s (%s%d%s tokens)\n",
+		styleStatus.Render("  "), stylePrompt.Render(""), toolCount, styleStatus.Render(""),
+		styleHeader.Render(""), toolTokens, styleStatus.Render(""))
+	statusMsg += fmt.Sprintf("%sTotal messages: %s%d%s\n", styleStatus.Render("  "), styleHeader.Render(""), systemCount+userCount+assistantCount+toolCount, styleStatus.Render(""))
+
+	// Token usage
+	statusMsg += fmt.Sprintf("\n%s[🪙] TOKEN USAGE%s\n", styleHeader.Render(""), styleHeader.Render(""))
+	if m.totalTokens > 0 {
+		if m.lastUsage != nil && m.lastUsage.Usage != nil {
+			statusMsg += fmt.Sprintf("%sLast call - Prompt: %s%d%s | Completion: %s%d%s | Total: %s%d%s\n",
+				styleStatus.Render("  "),
+				stylePrompt.Render(""), m.lastUsage.Usage.PromptTokens, styleStatus.Render(""),
+				styleClippy.Render(""), m.lastUsage.Usage.CompletionTokens, styleStatus.Render(""),
+				styleHeader.Render(""), m.lastUsage.Usage.TotalTokens, styleStatus.Render(""))
+		}
+		statusMsg += fmt.Sprintf("%sSession total: %s%d%s tokens\n",
+			styleStatus.Render("  "),
+			styleHeader.Render(""), m.totalTokens, styleStatus.Render(""))
+		if m.cachedTokens > 0 {
+			statusMsg += fmt.Sprintf("%sPrompt tokens - cached: %s%d%s | fresh: %s%d%s (%d%% from cache)\n",
+				styleStatus.Render("  "),
+				stylePrompt.Render(""), m.cachedTokens, styleStatus.Render(""),
+				styleClippy.Render(""), m.promptTokens-m.cachedTokens, styleStatus.Render(""),
+				m.cachedTokens*100/max(m.promptTokens, 1))
+		}
+
+		// Calculate average tokens per message
+		if userCount > 0 {
+			avgTokens := m.totalTokens / userCount
+			statusMsg += fmt.Sprintf("%sAverage per exchange: %s%d%s tokens\n",
+				styleStatus.Render("  "), styleHeader.Render(""), avgTokens, styleStatus.Render(""))
+		}
+
+		estimatedCost := estimateCost(m.pricing, cfg.Provider, cfg.Model, m.promptTokens, m.cachedTokens, m.completionTokens)
+		statusMsg += fmt.Sprintf("%sEstimated cost: %s%s%s\n",
+			styleStatus.Render("  "), styleHeader.Render(""), estimatedCost, styleStatus.Render(""))
+	} else {
+		statusMsg += fmt.Sprintf("%sNo tokens used yet in this session\n", styleStatus.Render("  "))
+	}
+
+	// Last tools used
+	if m.lastUsage != nil && len(m.lastUsage.ToolsUsed) > 0 {
+		statusMsg += fmt.Sprintf("\n%s[🔧] RECENT TOOLS%s\n", styleHeader.Render(""), styleHeader.Render(""))
+		statusMsg += fmt.Sprintf("%sLast used: %s\n", styleStatus.Render("  "), styleClippy.Render(strings.Join(m.lastUsage.ToolsUsed, ", ")))
+
+		if len(m.toolCounts) > 0 {
+			statusMsg += fmt.Sprintf("%sUsage frequency: ", styleStatus.Render("  "))
+			var toolFreq []string
+			for _, tool := range sortedKeys(m.toolCounts) {
+				toolFreq = append(toolFreq, fmt.Sprintf("%s%s:%d", styleClippy.Render(tool), styleStatus.Render(""), m.toolCounts[tool]))
+			}
+			statusMsg += strings.Join(toolFreq, " | ") + "\n"
+		}
+	}
+
+	// Available tools count
+	statusMsg += fmt.Sprintf("\n%s[🛠️] TOOLS AVAILABLE%s\n", styleHeader.Render(""), styleHeader.Render(""))
+	toolDefs := m.agent.GetToolDefinitions()
+	statusMsg += fmt.Sprintf("%sTotal tools: %s%d%s\n", styleStatus.Render("  "), stylePrompt.Render(""), len(toolDefs), styleStatus.Render(""))
+
+	// List available tools
+	statusMsg += fmt.Sprintf("%sAvailable: ", styleStatus.Render("  "))
+	var toolNames []string
+	for _, tool := range toolDefs {
+		toolNames = append(toolNames, tool.Definition().Name)
+	}
+	statusMsg += styleClippy.Render(strings.Join(toolNames, ", ")) + "\n"
+
+	// Session stats
+	statusMsg += fmt.Sprintf("\n%s[📈] SESSION STATS%s\n", styleHeader.Render(""), styleHeader.Render(""))
+	elapsed := time.Since(m.startTime)
+	statusMsg += fmt.Sprintf("%sSession duration: %s%s%s (started %s)\n", styleStatus.Render("  "), styleClippy.Render(""),
+		formatElapsed(elapsed), styleStatus.Render(""), m.startTime.Format("2006-01-02 15:04:05"))
+	if m.totalTokens > 0 && elapsed >= time.Second {
+		statusMsg += fmt.Sprintf("%sThroughput: %s%.0f%s tokens/min\n", styleStatus.Render("  "), styleClippy.Render(""),
+			float64(m.totalTokens)/elapsed.Minutes(), styleStatus.Render(""))
+	}
+	if m.agent.LLM != nil {
+		statusMsg += fmt.Sprintf("%sLLM Status: %sConnected%s\n", styleStatus.Render("  "), styleClippy.Render(""), styleStatus.Render(""))
+	} else {
+		statusMsg += fmt.Sprintf("%sLLM Status: %sNot configured%s\n", styleStatus.Render("  "), stylePrompt.Render(""), styleStatus.Render(""))
+	}
+
+	return statusMsg
+}
+
+// modelInfo renders /model info: the active model's limits and how full its context is
+func (m model) modelInfo() string {
+	cfg := m.agent.GetConfig()
+	limits, _ := llm.LimitsFor(cfg.Model)
+	orUnknown := func(tokens int) string {
+		if tokens == 0 {
+			return "unknown"
+		}
+		return fmt.Sprintf("%d tokens", tokens)
+	}
+	info := fmt.Sprintf("[🧠] Model: %s\n", cfg.Model)
+	info += fmt.Sprintf("  Context window: %s\n", orUnknown(limits.ContextWindow))
+	info += fmt.Sprintf("  Max output: %s\n", orUnknown(limits.MaxOutput))
+	// The latest call's prompt and reply are what the context holds now; a run's usage
+	// totals add up every call in its tool loop, so they would overstate it
+	var last *llm.Usage
+	history := m.agent.GetHistory()
+	for i := len(history) - 1; i >= 0 && last == nil; i-- {
+		if history[i].Role == "assistant" {
+			last = history[i].Usage
+		}
+	}
+	switch {
+	case last == nil:
+		info += "  Context used: no requests yet"
+	case limits.ContextWindow == 0:
+		info += fmt.Sprintf("  Context used: %d tokens", last.TotalTokens)
+	default:
+		info += fmt.Sprintf("  Context used: %d tokens (%.1f%% of the window)", last.TotalTokens, float64(last.TotalTokens)*100/float64(limits.ContextWindow))
+	}
+	return info
+}
+
+// sessionStats is a snapshot of the numbers /status reports, used for /stats export
+type sessionStats struct {
+	Start             time.Time
+	Duration          time.Duration
+	UserMessages      int
+	AssistantMessages int
+	ToolMessages      int
+	PromptTokens      int
+	CompletionTokens  int
+	TotalTokens       int
+	EstimatedCost     string
+	Models            []string
+	Tools             map[string]int
+}
+
+// statsCSVHeader names the columns written by (sessionStats).csvRow
+var statsCSVHeader = []string{
+	"start_time", "duration_seconds", "user_messages", "assistant_messages", "tool_messages",
+	"prompt_tokens", "completion_tokens", "total_tokens", "estimated_cost", "models", "tools",
+}
+
+// sessionStats collects the current session's stats as of now
+func (m model) sessionStats(now time.Time) sessionStats {
+	cfg := m.agent.GetConfig()
+	stats := sessionStats{
+		Start:            m.startTime,
+		Duration:         now.Sub(m.startTime),
+		PromptTokens:     m.promptTokens,
+		CompletionTokens: m.completionTokens,
+		TotalTokens:      m.totalTokens,
+		EstimatedCost:    estimateCost(m.pricing, cfg.Provider, cfg.Model, m.promptTokens, m.cachedTokens, m.completionTokens),
+		Models:           m.modelsUsed,
+		Tools:            m.toolCounts,
+	}
+	for _, msg := range m.agent.GetHistory() {
+		if msg.Example {
+			continue
+		}
+		switch msg.Role {
+		case "user":
+			stats.UserMessages++
+		case "assistant":
+			stats.AssistantMessages++
+		case "tool":
+			stats.ToolMessages++
+		}
+	}
+	return stats
+}
+
+// csvRow formats the stats in statsCSVHeader column order
+func (s sessionStats) csvRow() []string {
+	var tools []string
+	for _, name := range sortedKeys(s.Tools) {
+		tools = append(tools, fmt.Sprintf("%s:%d", name, s.Tools[name]))
+	}
+	return []string{
+		s.Start.Format(time.RFC3339),
+		strconv.Itoa(int(s.Duration.Seconds())),
+		strconv.Itoa(s.UserMessages),
+		strconv.Itoa(s.AssistantMessages),
+		strconv.Itoa(s.ToolMessages),
+		strconv.Itoa(s.PromptTokens),
+		strconv.Itoa(s.CompletionTokens),
+		strconv.Itoa(s.TotalTokens),
+		s.EstimatedCost,
+		strings.Join(s.Models, ";"),
+		strings.Join(tools, ";"),
+	}
+}
+
+// formatElapsed shows a duration compactly, like 1h23m, 5m or 42s
+func formatElapsed(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+// appendStatsCSV appends the stats as a row to path, writing the header for a new file
+func appendStatsCSV(path string, stats sessionStats) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	writeHeader := err != nil || info.Size() == 0
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if writeHeader {
+		w.Write(statsCSVHeader)
+	}
+	w.Write(stats.csvRow())
+	w.Flush()
+	return w.Error()
+}
+
+// defaultStatsPath is where /stats export writes when no path is given
+func defaultStatsPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "clippy_stats.csv"
+	}
+	return filepath.Join(home, ".clippy", "stats.csv")
+}
+
+// sortedKeys returns the map's keys in alphabetical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Theme holds the colors the UI styles are built from
+type Theme struct {
+	Prompt string `json:"prompt"`
+	User   string `json:"user"`
+	Clippy string `json:"clippy"`
+	Status string `json:"status"`
+	Header string `json:"header"`
+	Border string `json:"border"`
+
+	// Layout: how far assistant messages are indented, and which side user messages sit on
+	ClippyIndent int    `json:"clippy_indent,omitempty"`
+	UserAlign    string `json:"user_align,omitempty"` // "left" (default) or "right"
+}
+
+// defaultTheme is the original vaporwave palette
+var defaultTheme = Theme{
+	Prompt: ColorPink,
+	User:   ColorCyan,
+	Clippy: ColorYellow,
+	Status: ColorPurple,
+	Header: ColorPink,
+	Border: ColorBorder,
+}
+
+// themeElements lists the names accepted by /theme set, in display order
+var themeElements = []string{"prompt", "user", "clippy", "status", "header", "border"}
+
+// maxClippyIndent keeps an indented response from squeezing out the text itself
+const maxClippyIndent = 20
+
+// colorPattern accepts hex colors (#RGB or #RRGGBB) and ANSI color numbers
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[0-9]{1,3})$`)
+
+// currentTheme is the theme the styles were last built from
+var currentTheme = defaultTheme
+
+// color returns the theme color for an element name
+func (t Theme) color(element string) (string, bool) {
+	switch element {
+	case "prompt":
+		return t.Prompt, true
+	case "user":
+		return t.User, true
+	case "clippy":
+		return t.Clippy, true
+	case "status":
+		return t.Status, true
+	case "header":
+		return t.Header, true
+	case "border":
+		return t.Border, true
+	}
+	return "", false
+}
+
+// withColor returns a copy of the theme with one element's color replaced
+func (t Theme) withColor(element, color string) (Theme, error) {
+	if _, ok := t.color(element); !ok {
+		return t, fmt.Errorf("unknown element %q (use %s)", element, strings.Join(themeElements, ", "))
+	}
+	if !colorPattern.MatchString(color) {
+		return t, fmt.Errorf("invalid color %q (use #RRGGBB or an ANSI number)", color)
+	}
+	switch element {
+	case "prompt":
+		t.Prompt = color
+	case "user":
+		t.User = color
+	case "clippy":
+		t.Clippy = color
+	case "status":
+		t.Status = color
+	case "header":
+		t.Header = color
+	case "border":
+		t.Border = color
+	}
+	return t, nil
+}
+
+// userAlign returns the user message alignment, defaulting to left
+func (t Theme) userAlign() string {
+	if t.UserAlign == "" {
+		return "left"
+	}
+	return t.UserAlign
+}
+
+// applyTheme rebuilds every lipgloss style from the theme
+func applyTheme(t Theme) {
+	currentTheme = t
+	stylePrompt = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Prompt)).Bold(true)
+	styleUser = lipgloss.NewStyle().Foreground(lipgloss.Color(t.User))
+	styleClippy = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Clippy))
+	styleStatus = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Status)).Italic(true)
+	styleTool = lipgloss.NewStyle().Foreground(lipgloss.Color(t.User)).Faint(true)
+	styleToolError = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Prompt)).Bold(true)
+	styleHeader = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(t.Header)).
+		Bold(true).
+		Align(lipgloss.Center).
+		BorderStyle(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(t.Border)).
+		Padding(0, 1)
+	styleFooter = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(t.Status)).
+		Faint(true)
+}
+
+// applyTheme rebuilds the styles, including the ones the textarea holds copies of
+func (m *model) applyTheme(t Theme) {
+	applyTheme(t)
+	inputStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(t.User))
+	m.textArea.FocusedStyle.Base = inputStyle
+	m.textArea.FocusedStyle.Text = inputStyle
+	m.textArea.FocusedStyle.Placeholder = inputStyle.Faint(true)
+	m.textArea.BlurredStyle.Base = inputStyle
+	m.textArea.BlurredStyle.Text = inputStyle
+	m.textArea.BlurredStyle.Placeholder = inputStyle.Faint(true)
+	m.spinner.Style = lipgloss.NewStyle().Foreground(lipgloss.Color(t.Prompt))
+}
+
+// themePreview renders a sample of every styled element in the current theme
+func themePreview() string {
+	preview := fmt.Sprintf("\n%s[🎨] THEME PREVIEW%s\n", styleHeader.Render(""), styleHeader.Render(""))
+	preview += fmt.Sprintf("  prompt (%s): %s\n", currentTheme.Prompt, stylePrompt.Render("> Type a message..."))
+	preview += fmt.Sprintf("  user   (%s): %s\n", currentTheme.User, styleUser.Render("[You] Can you help me refactor this?"))
+	preview += fmt.Sprintf("  clippy (%s): %s\n", currentTheme.Clippy, styleClippy.Render("[📎] It looks like you're writing a letter!"))
+	preview += fmt.Sprintf("  status (%s): %s\n", currentTheme.Status, styleStatus.Render("Ready | Messages: 3"))
+	preview += fmt.Sprintf("  header (%s, border %s):\n%s\n", currentTheme.Header, currentTheme.Border, styleHeader.Render("V A P O R W A V E   C L I P P Y"))
+	preview += fmt.Sprintf("  layout: clippy indent %d, user align %s\n", currentTheme.ClippyIndent, currentTheme.userAlign())
+	preview += styleStatus.Render("  Change a color with /theme set <element> <color>, /theme reset to restore defaults, /save-config to keep it.")
+	return preview
+}
+
+// themePath is where /save-config stores the theme
+func themePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".clippy", "theme.json")
+}
+
+// saveTheme writes the theme as JSON to path
+func saveTheme(path string, t Theme) error {
+	if path == "" {
+		return fmt.Errorf("could not determine home directory")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// loadTheme reads a saved theme, filling unset elements from the default
+func loadTheme(path string) (Theme, error) {
+	t := defaultTheme
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return defaultTheme, err
+	}
+	for _, element := range themeElements {
+		if color, _ := t.color(element); !colorPattern.MatchString(color) {
+			return defaultTheme, fmt.Errorf("invalid %s color %q in %s", element, color, path)
+		}
+	}
+	if t.ClippyIndent < 0 || t.ClippyIndent > maxClippyIndent {
+		return defaultTheme, fmt.Errorf("invalid clippy_indent %d in %s (use 0-%d)", t.ClippyIndent, path, maxClippyIndent)
+	}
+	if align := t.userAlign(); align != "left" && align != "right" {
+		return defaultTheme, fmt.Errorf("invalid user_align %q in %s (use left or right)", t.UserAlign, path)
+	}
+	return t, nil
+}
@@ -0,0 +1,85 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cellwebb/clippy-go/internal/tools"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// maxVerboseLines caps how much of one tool result is shown when tool output is expanded
+const maxVerboseLines = 500
+
+// lineInfo is what the transcript knows about an entry in messages beyond its text
+type lineInfo struct {
+	time time.Time  // When it was sent or received (zero if unknown)
+	tool *toolEntry // Set for a tool call, which renders collapsed or, with /verbose, in full
+}
+
+// toolEntry is a finished tool call and its result
+type toolEntry struct {
+	name    string
+	args    map[string]interface{}
+	result  string
+	isError bool
+}
+
+// render shows the call as one summary line, followed by the full result when verbose
+func (e toolEntry) render(verbose bool) string {
+	mark, style := "✓", styleTool
+	if e.isError {
+		mark, style = "❌", styleToolError
+	}
+	line := style.Render(fmt.Sprintf("[%s] %s → %s", mark, tools.FormatToolExecution(e.name, e.args), e.outcome()))
+	result := strings.TrimRight(e.result, "\n")
+	if !verbose || result == "" {
+		return line
+	}
+	lines := strings.Split(result, "\n")
+	if len(lines) > maxVerboseLines {
+		more := len(lines) - maxVerboseLines
+		lines = append(lines[:maxVerboseLines], fmt.Sprintf("… %d more lines", more))
+	}
+	return line + "\n" + styleStatus.Render("    "+strings.Join(lines, "\n    "))
+}
+
+// outcome summarizes the result: its size, or for a failure the start of the error
+func (e toolEntry) outcome() string {
+	result := strings.TrimRight(e.result, "\n")
+	if e.isError {
+		first, _, _ := strings.Cut(result, "\n")
+		return ansi.Truncate(first, 80, "…")
+	}
+	switch n := strings.Count(result, "\n") + 1; {
+	case result == "":
+		return "no output"
+	case n == 1:
+		return "1 line"
+	default:
+		return fmt.Sprintf("%d lines", n)
+	}
+}
+
+// addTool appends a finished tool call to the transcript
+func (m *model) addTool(e toolEntry) {
+	m.messages = append(m.messages, e.render(false))
+	m.lines[len(m.messages)-1] = lineInfo{time: time.Now(), tool: &e}
+}
+
+// stamp records t as the time of the message just appended
+func (m *model) stamp(t time.Time) {
+	i := len(m.messages) - 1
+	info := m.lines[i]
+	info.time = t
+	m.lines[i] = info
+}
+
+// formatStamp shows the time of day, with the date for messages from before today
+func formatStamp(t, now time.Time) string {
+	if y, mo, d := t.Date(); y != now.Year() || mo != now.Month() || d != now.Day() {
+		return t.Format("Jan 2 15:04:05")
+	}
+	return t.Format("15:04:05")
+}
@@ -1,8 +1,15 @@
 package ui
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/cellwebb/clippy-go/internal/agent"
@@ -14,6 +21,8 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/reflow/indent"
 	"github.com/muesli/reflow/wordwrap"
 )
 
@@ -27,26 +36,21 @@ const (
 	ColorBorder = "#B967FF"
 )
 
+// Styles are rebuilt from the active Theme by applyTheme
 var (
-	stylePrompt = lipgloss.NewStyle().Foreground(lipgloss.Color(ColorPink)).Bold(true)
-	styleUser   = lipgloss.NewStyle().Foreground(lipgloss.Color(ColorCyan))
-	styleClippy = lipgloss.NewStyle().Foreground(lipgloss.Color(ColorYellow))
-	styleStatus = lipgloss.NewStyle().Foreground(lipgloss.Color(ColorPurple)).Italic(true)
-	styleTool   = lipgloss.NewStyle().Foreground(lipgloss.Color(ColorCyan)).Faint(true)
-	styleToolError = lipgloss.NewStyle().Foreground(lipgloss.Color(ColorPink)).Bold(true)
-	styleHeader = lipgloss.NewStyle().
-			Foreground(lipgloss.Color(ColorPink)).
-			Bold(true).
-			Align(lipgloss.Center).
-			BorderStyle(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color(ColorBorder)).
-			Padding(0, 1)
-	styleFooter = lipgloss.NewStyle().
-			Foreground(lipgloss.Color(ColorPurple)).
-			Faint(true)
+	stylePrompt    lipgloss.Style
+	styleUser      lipgloss.Style
+	styleClippy    lipgloss.Style
+	styleStatus    lipgloss.Style
+	styleTool      lipgloss.Style
+	styleToolError lipgloss.Style
+	styleHeader    lipgloss.Style
+	styleFooter    lipgloss.Style
 )
 
-
+func init() {
+	applyTheme(defaultTheme)
+}
 
 type model struct {
 	agent         *agent.Agent
@@ -64,12 +68,64 @@ type model struct {
 	showHelp      bool
 	lastUsage     *agent.Response
 	totalTokens   int
+	tokensUsed    int // Agent.TokensUsed as of the last response; the agent updates it mid-request
 	suggestions   []string
 	suggestionIdx int
+	focus         bool // Hide the status bar, footer, and suggestions; any key exits
+	autoScroll    bool // Follow new messages when already at the bottom of the viewport
+	markdown      bool // Render assistant messages as Markdown
+	md            *markdownRenderer
+	newBelow      bool // New content arrived below while the user was scrolled up
+	autoSave      bool // Save the conversation to ~/.clippy/sessions when quitting
+	confirmQuit   bool // Ask before quitting with an unsaved conversation (autoSave off)
+	quitPending   bool // The quit confirmation is showing; y or another quit key confirms
+	unsaved       bool // The conversation changed since it was last saved or loaded
+
+	// Session analytics for /status and /stats export
+	startTime        time.Time
+	promptTokens     int
+	completionTokens int
+	cachedTokens     int // Prompt tokens served from the provider's cache
+	modelsUsed       []string
+	toolCounts       map[string]int
+	pricing          map[string]modelPrice // Rates for estimated cost, with ~/.clippy/pricing.json overrides
+
+	models []string // Model IDs from the last /model fetch, for completing /model <name>
+
+	// What's known about entries in messages, by index
+	lines      map[int]lineInfo
+	timestamps bool // Show when each message was sent or received
+	verbose    bool // Expand tool calls to show their full results
+
+	// Simulated typing for non-streaming responses
+	typing       bool
+	typingChunks []string // Words still to reveal
+	typingIdx    int      // Index in messages of the response being typed
+
+	// Events pushed from the agent while a request runs, e.g. streamed content
+	events     chan tea.Msg
+	streamText string // Content streamed so far for the current response
+	streamIdx  int    // Index in messages of the streaming response, or -1
+
+	cancelRequest context.CancelFunc // Cancels the in-flight agent request (Esc)
+	confirmReply  chan bool          // Answers the agent's pending destructive tool prompt, or nil
+
+	// Past inputs, oldest first, and the ctrl+r reverse search over them
+	inputHistory []string
+	searching    bool
+	searchQuery  string
+	searchIdx    int    // Index in inputHistory of the current match, or -1
+	searchOrig   string // Input to restore if the search is cancelled
+	historyIdx   int    // Index in inputHistory of the input recalled with up/down, or -1
+	historyDraft string // Unsent input to restore when down steps past the newest entry
+
+	// Conversations started by /fork; the active one lives in agent and the fields above
+	sessions   []session
+	sessionIdx int
 }
 
 var availableCommands = []string{
-	"/quit", "/exit", "/clear", "/new", "/reset", "/help", "/provider", "/model", "/status",
+	"/quit", "/exit", "/clear", "/new", "/reset", "/help", "/provider", "/model", "/status", "/stats", "/typing", "/inspect", "/theme", "/theme-preview", "/save-config", "/focus", "/tools", "/fork", "/sessions", "/save", "/load", "/autoscroll", "/export", "/readonly", "/redact", "/compact", "/compact-tool-results", "/dryrun", "/markdown", "/json", "/timestamps", "/verbose", "/copy", "/system", "/image", "/maxturns", "/budget",
 }
 
 func InitialModel(agt *agent.Agent) model {
@@ -95,17 +151,83 @@ func InitialModel(agt *agent.Agent) model {
 	ta.BlurredStyle.Placeholder = cyanStyle.Faint(true)
 	ta.KeyMap.InsertNewline.SetEnabled(true) // Allow newlines with Ctrl+Enter or Shift+Enter
 
-	return model{
-		agent:    agt,
-		messages: []string{},
-		textArea: ta,
-		spinner:  s,
-		help:     help.New(),
+	m := model{
+		agent:       agt,
+		messages:    []string{},
+		textArea:    ta,
+		spinner:     s,
+		help:        help.New(),
+		startTime:   time.Now(),
+		toolCounts:  make(map[string]int),
+		typing:      os.Getenv("CLIPPY_TYPING") == "1",
+		autoScroll:  os.Getenv("CLIPPY_AUTOSCROLL") != "0",
+		markdown:    os.Getenv("CLIPPY_MARKDOWN") != "0",
+		md:          &markdownRenderer{},
+		lines:       make(map[int]lineInfo),
+		timestamps:  os.Getenv("CLIPPY_TIMESTAMPS") == "1",
+		verbose:     os.Getenv("CLIPPY_VERBOSE") == "1",
+		autoSave:    os.Getenv("CLIPPY_AUTOSAVE") != "0",
+		confirmQuit: os.Getenv("CLIPPY_CONFIRM_QUIT") == "1",
+		events:      make(chan tea.Msg, 64),
+		streamIdx:   -1,
+		historyIdx:  -1,
 	}
+	m.inputHistory, _ = loadInputHistory(inputHistoryPath())
+	pricing, pricingErr := loadPricing(pricingPath())
+	m.pricing = pricing
+	// Show a conversation loaded before the UI started
+	if msgs, lines := renderHistory(agt.Conversation()); len(msgs) > 0 {
+		m.messages, m.lines = msgs, lines
+	}
+	// A bad pricing file falls back to the default rates, but the user should know why
+	if pricingErr != nil && !os.IsNotExist(pricingErr) {
+		m.messages = append(m.messages, styleToolError.Render(fmt.Sprintf("[⚠️] Using default pricing: %v", pricingErr)))
+	}
+	events := m.events
+	agt.SetStreamCallback(func(chunk llm.StreamChunk) {
+		events <- streamChunkMsg(chunk)
+	})
+	agt.SetToolCallback(func(exec agent.ToolExecution) {
+		switch {
+		case exec.Done:
+			events <- toolExecMsg{toolName: exec.Name, arguments: exec.Arguments, error: exec.IsError}
+		case exec.Streaming:
+			events <- toolOutputMsg{toolName: exec.Name, arguments: exec.Arguments, line: exec.Output}
+		default:
+			events <- toolStartMsg{toolName: exec.Name, arguments: exec.Arguments}
+		}
+	})
+	if os.Getenv("CLIPPY_AUTO_APPROVE") != "1" {
+		agt.SetConfirmFunc(func(desc string) bool {
+			reply := make(chan bool, 1)
+			events <- confirmMsg{desc: desc, reply: reply}
+			return <-reply
+		})
+	}
+	if t, err := loadTheme(themePath()); err == nil {
+		m.applyTheme(t)
+	}
+	return m
 }
 
 func (m model) Init() tea.Cmd {
-	return m.spinner.Tick
+	return tea.Batch(m.spinner.Tick, waitForEvent(m.events))
+}
+
+// streamChunkMsg carries partial content from a streamed response
+type streamChunkMsg llm.StreamChunk
+
+// confirmMsg asks the user to approve a destructive tool call; the agent waits on reply
+type confirmMsg struct {
+	desc  string
+	reply chan bool
+}
+
+// waitForEvent delivers the next event the agent pushes while a request runs
+func waitForEvent(events chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-events
+	}
 }
 
 type responseMsg struct {
@@ -113,20 +235,30 @@ type responseMsg struct {
 	usage   *agent.Response
 }
 
-type toolExecMsg struct {
-	toolName string
-	result   string
-	error    bool
+// toolStartMsg reports a tool call the agent is starting
+type toolStartMsg struct {
+	toolName  string
+	arguments map[string]interface{}
 }
 
-type toolStartMsg struct {
-	toolName string
+// toolOutputMsg carries a line a running tool printed
+type toolOutputMsg struct {
+	toolName  string
+	arguments map[string]interface{}
+	line      string
+}
+
+// toolExecMsg reports a tool call the agent finished
+type toolExecMsg struct {
+	toolName  string
 	arguments map[string]interface{}
+	error     bool
 }
 
-func (m model) getAgentResponse(input string) tea.Cmd {
+func (m model) getAgentResponse(ctx context.Context, input string) tea.Cmd {
+	agt := m.agent
 	return func() tea.Msg {
-		resp := m.agent.GetResponse(input)
+		resp := agt.GetResponseContext(ctx, input)
 		return responseMsg{
 			content: resp.Content,
 			usage:   &resp,
@@ -142,40 +274,93 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
-		headerHeight := 5
-		footerHeight := 3
-		statusHeight := 1
-		inputHeight := m.textArea.Height()
-
 		m.width = msg.Width
 		m.height = msg.Height
 		m.textArea.SetWidth(msg.Width - 4) // Adjust textarea width to window
-		m.resizeTextarea() // Recalculate height after width change
-		inputHeight = m.textArea.Height() // Get updated height
+		m.resizeTextarea()                 // Recalculate height after width change
 
 		if !m.ready {
-			m.viewport = viewport.New(msg.Width, msg.Height-headerHeight-footerHeight-statusHeight-inputHeight)
-			m.viewport.YPosition = headerHeight
+			m.viewport = viewport.New(msg.Width, 0)
 			m.ready = true
-		} else {
-			m.viewport.Width = msg.Width
-			m.viewport.Height = msg.Height - headerHeight - footerHeight - statusHeight - inputHeight
 		}
+		m.layout()
+		m.updateViewport() // Rewrap for the new width, and show a resumed conversation
 
 	case tea.KeyMsg:
+		// Any key leaves focus mode
+		if m.focus {
+			m.focus = false
+			m.layout()
+			return m, nil
+		}
+		if m.quitPending {
+			switch msg.String() {
+			case "y", "Y", "ctrl+c", "esc":
+				return m, m.requestQuit()
+			case "n", "N":
+				m.quitPending = false
+				m.messages = append(m.messages, styleStatus.Render("[⚙️] Staying put!"))
+				m.updateViewport()
+				return m, nil
+			}
+			// Any other key dismisses the prompt and is handled as usual
+			m.quitPending = false
+		}
+		if m.confirmReply != nil {
+			switch msg.String() {
+			case "y", "Y":
+				m.answerConfirm(true)
+			case "n", "N":
+				m.answerConfirm(false)
+			}
+		}
 		if m.loading {
+			// Esc abandons the in-flight request; other keys wait for it. Input stays locked
+			// until the agent has actually stopped (a running tool batch finishes first), so a
+			// new turn can't overlap the cancelled one.
+			if msg.String() == "esc" && m.cancelRequest != nil {
+				if m.confirmReply != nil {
+					m.answerConfirm(false)
+				}
+				m.cancelRequest()
+				m.cancelRequest = nil
+				m.toolStatus = "Cancelling..."
+				if m.streamIdx >= 0 {
+					m.messages = m.messages[:m.streamIdx]
+					m.streamIdx = -1
+					m.streamText = ""
+				}
+				m.messages = append(m.messages, styleStatus.Render("[✋] Cancelled"))
+				m.updateViewport()
+			}
 			return m, nil
 		}
+		if m.searching {
+			return m.updateSearch(msg)
+		}
 
 		switch msg.String() {
 		case "ctrl+c", "esc":
 			if !m.loading {
-				m.quitting = true
-				return m, tea.Quit
+				return m, m.requestQuit()
 			}
 		case "?":
 			m.showHelp = !m.showHelp
 
+		case "ctrl+r":
+			m.startSearch()
+			return m, nil
+
+		case "ctrl+y":
+			m.messages = append(m.messages, m.copyResponse(false))
+			m.updateViewport()
+			return m, nil
+
+		case "ctrl+o":
+			m.verbose = !m.verbose
+			m.updateViewport()
+			return m, nil
+
 		case "up":
 			if len(m.suggestions) > 0 {
 				m.suggestionIdx--
@@ -184,10 +369,21 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				return m, nil
 			}
+			// Like a shell, up from the first line recalls the previous input
+			if (m.textArea.Value() == "" || m.textArea.Line() == 0) && m.recallOlder() {
+				return m, nil
+			}
 			// Forward to textarea if no suggestions
 			var cmd tea.Cmd
 			m.textArea, cmd = m.textArea.Update(msg)
 			return m, cmd
+		case "down":
+			if len(m.suggestions) == 0 && m.textArea.Line() == m.textArea.LineCount()-1 && m.recallNewer() {
+				return m, nil
+			}
+			var cmd tea.Cmd
+			m.textArea, cmd = m.textArea.Update(msg)
+			return m, cmd
 		case "tab":
 			if len(m.suggestions) > 0 {
 				m.textArea.SetValue(m.suggestions[m.suggestionIdx])
@@ -213,6 +409,20 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			m.viewport.ScrollDown(scrollAmount)
 			return m, nil
+		case "home", "end":
+			// With text in the input these move the cursor, so only an empty input scrolls
+			if m.textArea.Value() != "" {
+				break
+			}
+			fallthrough
+		case "ctrl+home", "ctrl+end":
+			if strings.HasSuffix(msg.String(), "home") {
+				m.viewport.GotoTop()
+			} else {
+				m.viewport.GotoBottom()
+				m.newBelow = false
+			}
+			return m, nil
 
 		case "ctrl+enter":
 			// Handle newline in textarea
@@ -228,13 +438,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// If suggestions are showing but input already matches exactly, execute it
 			if len(m.suggestions) > 0 {
 				// Check if input is already an exact match
-				isExactMatch := false
-				for _, cmd := range availableCommands {
-					if input == cmd {
-						isExactMatch = true
-						break
-					}
-				}
+				isExactMatch := slices.Contains(m.suggestions, input)
 
 				// If not an exact match, select the suggestion
 				if !isExactMatch {
@@ -254,18 +458,22 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if input == "" {
 				return m, nil
 			}
+			m.recordInput(input)
 
 			// Handle slash commands
 			if input == "/quit" || input == "/exit" {
-				m.quitting = true
-				return m, tea.Quit
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				return m, m.requestQuit()
 			}
 			if input == "/clear" || input == "/new" || input == "/reset" {
 				m.messages = []string{}
+				m.lines = make(map[int]lineInfo)
 				m.textArea.SetValue("")
 				m.textArea.SetHeight(1)
 				m.viewport.SetContent("")
 				m.agent.ClearHistory()
+				m.unsaved = false
 				return m, nil
 			}
 
@@ -273,14 +481,27 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				parts := strings.Fields(input)
 				if len(parts) > 1 {
 					provider := parts[1]
-					// Update provider
+					// Each provider speaks its own API, so switching builds a new one. A model
+					// left at the old provider's default moves to the new provider's default.
 					cfg := m.agent.GetConfig()
+					if cfg.Model == llm.DefaultModels[cfg.Provider] {
+						cfg.Model = ""
+					}
 					cfg.Provider = provider
-					m.agent.UpdateConfig(cfg)
-					m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] Provider set to: %s", provider)))
+					if p, err := llm.NewProvider(cfg); err != nil {
+						m.messages = append(m.messages, styleToolError.Render(fmt.Sprintf("[❌] Provider not changed: %v", err)))
+					} else {
+						m.agent.SetProvider(p)
+						// The model list came from the old provider; /models fetches the new one's
+						m.models = nil
+						m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] Provider set to: %s (model: %s)", provider, p.GetConfig().Model)))
+						if warning := modelMismatch(provider, p.GetConfig().Model); warning != "" {
+							m.messages = append(m.messages, styleToolError.Render("[⚠️] "+warning))
+						}
+					}
 				} else {
 					// List providers
-					m.messages = append(m.messages, styleStatus.Render("[⚙️] Available providers: openai, anthropic"))
+					m.messages = append(m.messages, styleStatus.Render("[⚙️] Available providers: openai, azure, anthropic, ollama"))
 				}
 				m.textArea.SetValue("")
 				m.textArea.SetHeight(1)
@@ -288,6 +509,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 
+			if input == "/model info" {
+				m.messages = append(m.messages, styleStatus.Render(m.modelInfo()))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
 			if strings.HasPrefix(input, "/model") {
 				parts := strings.Fields(input)
 				if len(parts) > 1 {
@@ -297,6 +526,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					cfg.Model = modelName
 					m.agent.UpdateConfig(cfg)
 					m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] Model set to: %s", modelName)))
+					if warning := modelMismatch(cfg.Provider, modelName); warning != "" {
+						m.messages = append(m.messages, styleToolError.Render("[⚠️] "+warning))
+					}
 					m.textArea.SetValue("")
 					m.textArea.SetHeight(1)
 					m.updateViewport()
@@ -305,196 +537,505 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					// Fetch models
 					m.loading = true
 					m.toolStatus = "Fetching models..."
-					return m, tea.Batch(m.spinner.Tick, fetchModelsCmd())
+					return m, tea.Batch(m.spinner.Tick, fetchModelsCmd(m.agent.LLM))
 				}
 			}
 			if input == "/help" {
 				helpMsg := "Help:\n"
 				helpMsg += "/help - Show this help message\n"
-				helpMsg += "/quit or /exit - Exit the application\n"
+				helpMsg += "/quit or /exit - Exit the application (saves the conversation to ~/.clippy/sessions unless CLIPPY_AUTOSAVE=0)\n"
 				helpMsg += "/clear, /new, /reset - Clear the chat history\n"
 				helpMsg += "/status - Show connection and usage status\n"
-				helpMsg += "/provider [name] - Set or show LLM provider (openai, anthropic)\n"
+				helpMsg += "/tools describe [name] - List what Clippy's tools do, or one tool's parameters\n"
+				helpMsg += "/inspect - Show the next request; tweak it with /inspect tool <name> on|off, /inspect model <name>, /inspect reset\n"
+				helpMsg += "/theme-preview - Show every styled element in the current theme\n"
+				helpMsg += "/theme set <element> <color> - Change a theme color live (/theme reset restores defaults)\n"
+				helpMsg += "/save-config - Save the current theme for future sessions\n"
+				helpMsg += "/save [name] - Save this conversation (quitting saves one automatically)\n"
+				helpMsg += "/load <name> - Replace this conversation with a saved one\n"
+				helpMsg += "/export <file>.md - Write this conversation to a Markdown file\n"
+				helpMsg += "/system [prompt|reset] - Show or replace the system prompt (reset restores the Clippy persona)\n"
+				helpMsg += "/image <path> - Attach an image to your next message (for vision models like gpt-4o and Claude)\n"
+				helpMsg += "/copy [code] - Copy the last response, or just its first code block, to the clipboard\n"
+				helpMsg += "/fork - Copy this conversation into a new session to try a different direction\n"
+				helpMsg += "/sessions [number] - List sessions, or switch to one\n"
+				helpMsg += "/focus - Hide the status bar and footer for distraction-free reading (any key exits)\n"
+				helpMsg += "/readonly [on|off] - Withhold tools that change files or run commands\n"
+				helpMsg += "/compact - Summarize everything before the latest exchange into a short note to free up context\n"
+				helpMsg += fmt.Sprintf("/compact-tool-results [keep] - Replace older tool outputs with short summaries (keeps the last %d by default)\n", agent.DefaultKeepToolResults)
+				helpMsg += "/dryrun [on|off] - Describe file changes and commands (with diffs) instead of performing them\n"
+				helpMsg += "/redact [on|off] - Mask API keys, tokens, and other secrets in tool output (on by default)\n"
+				helpMsg += fmt.Sprintf("/maxturns [n] - Show or set how many tool steps Clippy may take per message (default %d)\n", agent.DefaultMaxToolTurns)
+				helpMsg += "/budget [n|off] - Show or set a token budget; Clippy stops taking requests once it's used up\n"
+				helpMsg += "/autoscroll [on|off] - Follow new messages when scrolled to the bottom\n"
+				helpMsg += "/markdown [on|off] - Render Clippy's replies as Markdown with highlighted code blocks\n"
+				helpMsg += "/json [on|off] - Ask for replies as a single JSON object and pretty-print them\n"
+				helpMsg += "/typing [on|off] - Reveal responses word by word when not streaming\n"
+				helpMsg += "/timestamps [on|off] - Show when each message was sent and answered\n"
+				helpMsg += "/verbose [on|off] - Show tool calls' full output instead of a one-line summary\n"
+				helpMsg += "/stats export [file.csv] - Append session stats as a CSV row (default ~/.clippy/stats.csv)\n"
+				helpMsg += "/provider [name] - Set or show LLM provider (openai, azure, anthropic, ollama)\n"
 				helpMsg += "/model [name] - Set, show, or fetch available models\n"
+				helpMsg += "/model info - Show the model's context window and max output, and how full the context is\n"
 				helpMsg += "\nKeyboard shortcuts:\n"
 				helpMsg += "Enter - Send message\n"
 				helpMsg += "Ctrl+Enter - Add new line without sending\n"
 				helpMsg += "Tab - Auto-complete commands\n"
 				helpMsg += "PgUp/PgDown - Scroll history\n"
+				helpMsg += "Home/End - Jump to the top or bottom of the history (Ctrl+Home/Ctrl+End while typing)\n"
+				helpMsg += "Up/Down - Recall previous inputs (from the first or last line of the input)\n"
+				helpMsg += "Ctrl+Y - Copy the last response to the clipboard\n"
+				helpMsg += "Ctrl+O - Expand or collapse tool output\n"
+				helpMsg += "Ctrl+R - Search past inputs (Ctrl+R again for older matches, Enter to accept)\n"
+				helpMsg += "Esc (while waiting) - Cancel the pending response\n"
+				helpMsg += "y/n - Approve or deny a file change or command when Clippy asks\n"
 				helpMsg += "Ctrl+C or Esc - Exit\n"
-				
+
 				m.messages = append(m.messages, helpMsg)
 				m.textArea.SetValue("")
 				m.textArea.SetHeight(1)
 				m.updateViewport()
 				return m, nil
 			}
-			
-			if input == "/status" {
-				// Get config status
-				cfg := m.agent.GetConfig()
-				statusMsg := fmt.Sprintf("\n%s[⚙️] CONFIG STATUS%s\n", styleHeader.Render(""), styleHeader.Render(""))
-				statusMsg += fmt.Sprintf("%sProvider: %s\n", styleStatus.Render("  "), styleClippy.Render(cfg.Provider))
-				statusMsg += fmt.Sprintf("%sModel: %s\n", styleStatus.Render("  "), styleClippy.Render(cfg.Model))
-				if cfg.BaseURL != "" {
-					statusMsg += fmt.Sprintf("%sBase URL: %s\n", styleStatus.Render("  "), styleClippy.Render(cfg.BaseURL))
+
+			if strings.HasPrefix(input, "/stats") {
+				parts := strings.Fields(input)
+				if len(parts) < 2 || parts[1] != "export" {
+					m.messages = append(m.messages, styleStatus.Render("[⚙️] Usage: /stats export [file.csv]"))
 				} else {
-					switch cfg.Provider {
-					case "openai":
-						statusMsg += fmt.Sprintf("%sBase URL: %s\n", styleStatus.Render("  "), styleClippy.Render("https://api.openai.com/v1"))
-					case "anthropic":
-						statusMsg += fmt.Sprintf("%sBase URL: %s\n", styleStatus.Render("  "), styleClippy.Render("https://api.anthropic.com/v1"))
-					default:
-						statusMsg += fmt.Sprintf("%sBase URL: %s\n", styleStatus.Render("  "), styleClippy.Render("default"))
+					path := defaultStatsPath()
+					if len(parts) > 2 {
+						path = parts[2]
+					}
+					if err := appendStatsCSV(path, m.sessionStats(time.Now())); err != nil {
+						m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[❌] Error exporting stats: %v", err)))
+					} else {
+						m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[📈] Session stats appended to %s", path)))
 					}
 				}
-				if cfg.APIKey != "" {
-					statusMsg += fmt.Sprintf("%sAPI Key: %s (%s...%s)\n", styleStatus.Render("  "), styleClippy.Render("***configured***"), cfg.APIKey[:4], cfg.APIKey[len(cfg.APIKey)-4:])
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if strings.HasPrefix(input, "/inspect") {
+				m.messages = append(m.messages, m.handleInspect(strings.Fields(input)[1:]))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/tools" || strings.HasPrefix(input, "/tools ") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 && parts[1] != "describe" || len(parts) > 3 {
+					m.messages = append(m.messages, styleStatus.Render("[⚙️] Usage: /tools describe [name]"))
 				} else {
-					statusMsg += fmt.Sprintf("%sAPI Key: %s\n", styleStatus.Render("  "), styleClippy.Render("not set"))
-				}
-				
-				// Message breakdown
-				statusMsg += fmt.Sprintf("\n%s[📊] MESSAGE BREAKDOWN%s\n", styleHeader.Render(""), styleHeader.Render(""))
-				
-				systemCount := 0
-				userCount := 0
-				assistantCount := 0
-				toolCount := 0
-				systemTokens := 0
-				userTokens := 0
-				assistantTokens := 0
-				toolTokens := 0
-				
-				for _, msg := range m.agent.GetHistory() {
-					switch msg.Role {
-					case "system":
-						systemCount++
-						if msg.Usage != nil {
-							systemTokens += msg.Usage.TotalTokens
-						}
-					case "user":
-						userCount++
-						if msg.Usage != nil {
-							userTokens += msg.Usage.TotalTokens
-						}
-					case "assistant":
-						assistantCount++
-						if msg.Usage != nil {
-							assistantTokens += msg.Usage.TotalTokens
-						}
-					case "tool":
-						toolCount++
-						if msg.Usage != nil {
-							toolTokens += msg.Usage.TotalTokens
-						}
+					name := ""
+					if len(parts) == 3 {
+						name = parts[2]
 					}
+					m.messages = append(m.messages, describeTools(m.agent.GetToolDefinitions(), name))
+				}
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/save" || strings.HasPrefix(input, "/save ") {
+				parts := strings.Fields(input)
+				name := ""
+				if len(parts) > 1 {
+					name = parts[1]
 				}
-				
-				statusMsg += fmt.Sprintf("%sSystem messages: %s%d%s (%s%d%s tokens)\n", 
-					styleStatus.Render("  "), stylePrompt.Render(""), systemCount, styleStatus.Render(""), 
-					styleHeader.Render(""), systemTokens, styleStatus.Render(""))
-				statusMsg += fmt.Sprintf("%sUser messages: %s%d%s (%s%d%s tokens)\n", 
-					styleStatus.Render("  "), styleUser.Render(""), userCount, styleStatus.Render(""), 
-					styleHeader.Render(""), userTokens, styleStatus.Render(""))
-				statusMsg += fmt.Sprintf("%sAssistant messages: %s%d%s (%s%d%s tokens)\n", 
-					styleStatus.Render("  "), styleClippy.Render(""), assistantCount, styleStatus.Render(""), 
-					styleHeader.Render(""), assistantTokens, styleStatus.Render(""))
-				statusMsg += fmt.Sprintf("%sTool calls/responses: %s%d%s (%s%d%s tokens)\n", 
-					styleStatus.Render("  "), stylePrompt.Render(""), toolCount, styleStatus.Render(""), 
-					styleHeader.Render(""), toolTokens, styleStatus.Render(""))
-				statusMsg += fmt.Sprintf("%sTotal messages: %s%d%s\n", styleStatus.Render("  "), styleHeader.Render(""), len(m.agent.GetHistory()), styleStatus.Render(""))
-				
-				// Token usage
-				statusMsg += fmt.Sprintf("\n%s[🪙] TOKEN USAGE%s\n", styleHeader.Render(""), styleHeader.Render(""))
-				if m.totalTokens > 0 {
-					if m.lastUsage != nil && m.lastUsage.Usage != nil {
-						statusMsg += fmt.Sprintf("%sLast call - Prompt: %s%d%s | Completion: %s%d%s | Total: %s%d%s\n", 
-							styleStatus.Render("  "), 
-							stylePrompt.Render(""), m.lastUsage.Usage.PromptTokens, styleStatus.Render(""),
-							styleClippy.Render(""), m.lastUsage.Usage.CompletionTokens, styleStatus.Render(""),
-							styleHeader.Render(""), m.lastUsage.Usage.TotalTokens, styleStatus.Render(""))
+				if path, err := m.saveSession(name); err != nil {
+					m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[❌] Error saving session: %v", err)))
+				} else {
+					m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[💾] Session saved to %s", path)))
+					m.unsaved = false
+				}
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/load" || strings.HasPrefix(input, "/load ") {
+				parts := strings.Fields(input)
+				var msg string
+				if len(parts) != 2 {
+					msg = styleStatus.Render("[⚙️] Usage: /load <name>")
+				} else {
+					msg = m.loadSession(parts[1])
+				}
+				m.messages = append(m.messages, msg)
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/export" || strings.HasPrefix(input, "/export ") {
+				parts := strings.Fields(input)
+				if len(parts) != 2 {
+					m.messages = append(m.messages, styleStatus.Render("[⚙️] Usage: /export <file>.md"))
+				} else if path, err := m.exportMarkdown(parts[1]); err != nil {
+					m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[❌] Error exporting conversation: %v", err)))
+				} else {
+					m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[📝] Conversation exported to %s", path)))
+				}
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/system" || strings.HasPrefix(input, "/system ") {
+				prompt := strings.TrimSpace(strings.TrimPrefix(input, "/system"))
+				switch prompt {
+				case "":
+					current := m.agent.SystemPrompt()
+					if current == "" {
+						current = "(none)"
+					}
+					m.messages = append(m.messages, styleStatus.Render("[🧠] System prompt: ")+current)
+				case "reset":
+					m.agent.SetSystemPrompt(agent.DefaultSystemPrompt)
+					m.messages = append(m.messages, styleStatus.Render("[🧠] System prompt restored to the default Clippy persona"))
+				default:
+					m.agent.SetSystemPrompt(prompt)
+					m.messages = append(m.messages, styleStatus.Render("[🧠] System prompt updated; it applies from the next message"))
+				}
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/image" || strings.HasPrefix(input, "/image ") {
+				m.messages = append(m.messages, m.attachImage(strings.TrimSpace(strings.TrimPrefix(input, "/image"))))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/copy" || input == "/copy code" {
+				m.messages = append(m.messages, m.copyResponse(input == "/copy code"))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/fork" {
+				m.messages = append(m.messages, m.fork())
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/sessions" || strings.HasPrefix(input, "/sessions ") {
+				msg := m.handleSessions(strings.Fields(input)[1:])
+				m.messages = append(m.messages, msg)
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/focus" {
+				m.focus = true
+				m.suggestions = nil
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.layout()
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/theme-preview" {
+				m.messages = append(m.messages, themePreview())
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if strings.HasPrefix(input, "/theme") {
+				parts := strings.Fields(input)
+				switch {
+				case len(parts) == 4 && parts[1] == "set":
+					t, err := currentTheme.withColor(parts[2], parts[3])
+					if err != nil {
+						m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[❌] %v", err)))
+					} else {
+						m.applyTheme(t)
+						m.messages = append(m.messages, themePreview())
 					}
-					statusMsg += fmt.Sprintf("%sSession total: %s%d%s tokens\n", 
-						styleStatus.Render("  "), 
-						styleHeader.Render(""), m.totalTokens, styleStatus.Render(""))
-					
-					// Calculate average tokens per message
-					if userCount > 0 {
-						avgTokens := m.totalTokens / userCount
-						statusMsg += fmt.Sprintf("%sAverage per exchange: %s%d%s tokens\n", 
-							styleStatus.Render("  "), styleHeader.Render(""), avgTokens, styleStatus.Render(""))
+				case len(parts) == 2 && parts[1] == "reset":
+					m.applyTheme(defaultTheme)
+					m.messages = append(m.messages, themePreview())
+				default:
+					m.messages = append(m.messages, styleStatus.Render("[⚙️] Usage: /theme set <"+strings.Join(themeElements, "|")+"> <color> or /theme reset"))
+				}
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/save-config" {
+				path := themePath()
+				if err := saveTheme(path, currentTheme); err != nil {
+					m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[❌] Error saving config: %v", err)))
+				} else {
+					m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[💾] Theme saved to %s", path)))
+				}
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if strings.HasPrefix(input, "/readonly") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 && (parts[1] == "on" || parts[1] == "off") {
+					m.agent.ReadOnly = parts[1] == "on"
+				}
+				state := "off"
+				if m.agent.ReadOnly {
+					state = "on (Clippy can look but not touch)"
+				}
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[🔒] Read-only mode: %s", state)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/compact" {
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.loading = true
+				m.toolStatus = "Summarizing earlier conversation..."
+				return m, tea.Batch(m.spinner.Tick, summarizeCmd(m.agent))
+			}
+
+			if input == "/compact-tool-results" || strings.HasPrefix(input, "/compact-tool-results ") {
+				parts := strings.Fields(input)
+				keep := -1
+				if len(parts) > 1 {
+					n, err := strconv.Atoi(parts[1])
+					if err != nil || n < 0 || len(parts) > 2 {
+						m.messages = append(m.messages, styleStatus.Render("[🗜️] Usage: /compact-tool-results [keep]"))
+						m.textArea.SetValue("")
+						m.textArea.SetHeight(1)
+						m.updateViewport()
+						return m, nil
 					}
-					
-					// estimated cost (rough calculations)
-					var estimatedCost string
-					switch cfg.Provider {
-					case "openai":
-						// Rough estimates for GPT-4
-						cost := float64(m.totalTokens) * 0.00003 // $0.03 per 1K tokens
-						estimatedCost = fmt.Sprintf("$%.4f", cost)
-					case "anthropic":
-						// Rough estimates for Claude
-						cost := float64(m.totalTokens) * 0.00003 // $0.03 per 1K tokens
-						estimatedCost = fmt.Sprintf("$%.4f", cost)
+					keep = n
+				}
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.loading = true
+				m.toolStatus = "Compacting tool results..."
+				return m, tea.Batch(m.spinner.Tick, compactCmd(m.agent, keep))
+			}
+
+			if strings.HasPrefix(input, "/dryrun") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 && (parts[1] == "on" || parts[1] == "off") {
+					m.agent.DryRun = parts[1] == "on"
+				}
+				state := "off"
+				if m.agent.DryRun {
+					state = "on (file changes and commands are described, not performed)"
+				}
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[🧪] Dry run: %s", state)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if strings.HasPrefix(input, "/redact") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 && (parts[1] == "on" || parts[1] == "off") {
+					m.agent.Redact = parts[1] == "on"
+				}
+				state := "off (tool output is shown unmasked)"
+				if m.agent.Redact {
+					state = "on"
+				}
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[🙈] Secret masking: %s", state)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/maxturns" || strings.HasPrefix(input, "/maxturns ") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 {
+					n, err := strconv.Atoi(parts[1])
+					if err != nil || n < 1 || len(parts) > 2 {
+						m.messages = append(m.messages, styleStatus.Render("[⚙️] Usage: /maxturns <n> (a positive number)"))
+						m.textArea.SetValue("")
+						m.textArea.SetHeight(1)
+						m.updateViewport()
+						return m, nil
+					}
+					m.agent.MaxToolTurns = n
+				}
+				limit := m.agent.MaxToolTurns
+				if limit <= 0 {
+					limit = agent.DefaultMaxToolTurns
+				}
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] Max tool steps per message: %d", limit)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/budget" || strings.HasPrefix(input, "/budget ") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 {
+					n, err := strconv.Atoi(parts[1])
+					switch {
+					case parts[1] == "off":
+						m.agent.TokenBudget = 0
+					case err != nil || n < 1 || len(parts) > 2:
+						m.messages = append(m.messages, styleStatus.Render("[⚙️] Usage: /budget <n> (a positive number of tokens) or /budget off"))
+						m.textArea.SetValue("")
+						m.textArea.SetHeight(1)
+						m.updateViewport()
+						return m, nil
 					default:
-						estimatedCost = "unknown"
+						m.agent.TokenBudget = n
 					}
-					statusMsg += fmt.Sprintf("%sEstimated cost: %s%s%s\n", 
-						styleStatus.Render("  "), styleHeader.Render(""), estimatedCost, styleStatus.Render(""))
-				} else {
-					statusMsg += fmt.Sprintf("%sNo tokens used yet in this session\n", styleStatus.Render("  "))
-				}
-				
-				// Last tools used
-				if m.lastUsage != nil && len(m.lastUsage.ToolsUsed) > 0 {
-					statusMsg += fmt.Sprintf("\n%s[🔧] RECENT TOOLS%s\n", styleHeader.Render(""), styleHeader.Render(""))
-					statusMsg += fmt.Sprintf("%sLast used: %s\n", styleStatus.Render("  "), styleClippy.Render(strings.Join(m.lastUsage.ToolsUsed, ", ")))
-					
-					// Count tool usage frequency
-					toolUsage := make(map[string]int)
-					for _, msg := range m.agent.GetHistory() {
-						if msg.Role == "tool" {
-							// Extract tool name from content if possible, or track by tool call
-							for _, tc := range msg.ToolCalls {
-								toolUsage[tc.Name]++
-							}
-						}
+				}
+				budget := "none"
+				if m.agent.TokenBudget > 0 {
+					budget = fmt.Sprintf("%d / %d tokens used", m.tokensUsed, m.agent.TokenBudget)
+					if m.agent.BudgetExceeded() {
+						budget += " (exceeded; raise it to keep going)"
 					}
-					
-					if len(toolUsage) > 0 {
-						statusMsg += fmt.Sprintf("%sUsage frequency: ", styleStatus.Render("  "))
-						var toolFreq []string
-						for tool, count := range toolUsage {
-							toolFreq = append(toolFreq, fmt.Sprintf("%s%s:%d", styleClippy.Render(tool), styleStatus.Render(""), count))
-						}
-						statusMsg += strings.Join(toolFreq, " | ") + "\n"
+				}
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[🪙] Token budget: %s", budget)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if strings.HasPrefix(input, "/autoscroll") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 && (parts[1] == "on" || parts[1] == "off") {
+					m.autoScroll = parts[1] == "on"
+				}
+				state := "off"
+				if m.autoScroll {
+					state = "on"
+				}
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] Auto-scroll: %s", state)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if strings.HasPrefix(input, "/markdown") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 && (parts[1] == "on" || parts[1] == "off") {
+					m.markdown = parts[1] == "on"
+				}
+				state := "off"
+				if m.markdown {
+					state = "on"
+				}
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] Markdown rendering: %s", state)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if strings.HasPrefix(input, "/json") {
+				parts := strings.Fields(input)
+				cfg := m.agent.GetConfig()
+				if len(parts) > 1 && (parts[1] == "on" || parts[1] == "off") {
+					cfg.ResponseFormat = ""
+					if parts[1] == "on" {
+						cfg.ResponseFormat = llm.ResponseFormatJSON
 					}
+					m.agent.UpdateConfig(cfg)
 				}
-				
-				// Available tools count
-				statusMsg += fmt.Sprintf("\n%s[🛠️] TOOLS AVAILABLE%s\n", styleHeader.Render(""), styleHeader.Render(""))
-				toolDefs := m.agent.GetToolDefinitions()
-				statusMsg += fmt.Sprintf("%sTotal tools: %s%d%s\n", styleStatus.Render("  "), stylePrompt.Render(""), len(toolDefs), styleStatus.Render(""))
-				
-				// List available tools
-				statusMsg += fmt.Sprintf("%sAvailable: ", styleStatus.Render("  "))
-				var toolNames []string
-				for _, tool := range toolDefs {
-					toolNames = append(toolNames, tool.Definition().Name)
-				}
-				statusMsg += styleClippy.Render(strings.Join(toolNames, ", ")) + "\n"
-				
-				// Session stats
-				statusMsg += fmt.Sprintf("\n%s[📈] SESSION STATS%s\n", styleHeader.Render(""), styleHeader.Render(""))
-				statusMsg += fmt.Sprintf("%sSession duration: %sActive%s\n", styleStatus.Render("  "), styleClippy.Render(""), styleStatus.Render(""))
-				if m.agent.LLM != nil {
-					statusMsg += fmt.Sprintf("%sLLM Status: %sConnected%s\n", styleStatus.Render("  "), styleClippy.Render(""), styleStatus.Render(""))
-				} else {
-					statusMsg += fmt.Sprintf("%sLLM Status: %sNot configured%s\n", styleStatus.Render("  "), stylePrompt.Render(""), styleStatus.Render(""))
+				state := "off"
+				if cfg.ResponseFormat == llm.ResponseFormatJSON {
+					state = "on (replies are a single JSON object)"
+				}
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] JSON output: %s", state)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if strings.HasPrefix(input, "/verbose") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 && (parts[1] == "on" || parts[1] == "off") {
+					m.verbose = parts[1] == "on"
+				}
+				state := "off (tool calls show a one-line summary)"
+				if m.verbose {
+					state = "on (tool calls show their full output)"
 				}
-				
-				m.messages = append(m.messages, statusMsg)
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] Verbose tool output: %s", state)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if strings.HasPrefix(input, "/timestamps") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 && (parts[1] == "on" || parts[1] == "off") {
+					m.timestamps = parts[1] == "on"
+				}
+				state := "off"
+				if m.timestamps {
+					state = "on"
+				}
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] Timestamps: %s", state)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if strings.HasPrefix(input, "/typing") {
+				parts := strings.Fields(input)
+				if len(parts) > 1 && (parts[1] == "on" || parts[1] == "off") {
+					m.typing = parts[1] == "on"
+				}
+				state := "off"
+				if m.typing {
+					state = "on"
+				}
+				m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] Typing simulation: %s", state)))
+				m.textArea.SetValue("")
+				m.textArea.SetHeight(1)
+				m.updateViewport()
+				return m, nil
+			}
+
+			if input == "/status" {
+				m.messages = append(m.messages, m.statusReport())
 				m.textArea.SetValue("")
 				m.textArea.SetHeight(1)
 				m.updateViewport()
@@ -503,9 +1044,15 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			// Add user message
 			m.messages = append(m.messages, styleUser.Render("[You] ")+input)
+			m.stamp(time.Now())
 			m.updateViewport()
+			// Sending means the user wants to see the reply
+			m.viewport.GotoBottom()
+			m.newBelow = false
 
-			cmd := m.getAgentResponse(input)
+			ctx, cancel := context.WithCancel(context.Background())
+			m.cancelRequest = cancel
+			cmd := m.getAgentResponse(ctx, input)
 			m.textArea.SetValue("")
 			m.textArea.SetHeight(1)
 			m.loading = true
@@ -528,29 +1075,126 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if msg.err != nil {
 			m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[❌] Error fetching models: %v", msg.err)))
 		} else {
+			m.models = msg.models
 			m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[⚙️] Available models: %s", strings.Join(msg.models, ", "))))
 		}
 		m.updateViewport()
 		return m, nil
 
+	case compactMsg:
+		m.loading = false
+		m.toolStatus = ""
+		if msg.result.Compacted > 0 {
+			m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[🗜️] Compacted %d tool results, reclaiming ~%d tokens", msg.result.Compacted, msg.result.Reclaimed())))
+		}
+		if msg.err != nil {
+			m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[❌] Error compacting tool results: %v", msg.err)))
+		} else if msg.result.Compacted == 0 {
+			m.messages = append(m.messages, styleStatus.Render("[🗜️] No older tool results worth compacting"))
+		}
+		m.updateViewport()
+		return m, nil
+
+	case summarizeMsg:
+		m.loading = false
+		m.toolStatus = ""
+		switch {
+		case msg.err != nil:
+			m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[❌] Error summarizing conversation: %v", msg.err)))
+		case msg.result.Compacted == 0:
+			m.messages = append(m.messages, styleStatus.Render("[🗜️] Nothing before the latest exchange to summarize"))
+		default:
+			m.unsaved = true
+			m.messages = append(m.messages, styleStatus.Render(fmt.Sprintf("[🗜️] Summarized %d earlier messages, reclaiming ~%d tokens", msg.result.Compacted, msg.result.Reclaimed())))
+		}
+		m.updateViewport()
+		return m, nil
+
+	case confirmMsg:
+		m.confirmReply = msg.reply
+		m.toolStatus = "Waiting for approval (y/n)..."
+		m.messages = append(m.messages, styleToolError.Render(fmt.Sprintf("[⚠️] Allow %s? y/n", msg.desc)))
+		m.updateViewport()
+		return m, waitForEvent(m.events)
+
+	case toolStartMsg:
+		if m.loading {
+			m.toolStatus = tools.FormatToolExecution(msg.toolName, msg.arguments)
+		}
+		return m, waitForEvent(m.events)
+
+	case toolOutputMsg:
+		// Show the latest line after the call, so long commands visibly make progress
+		if m.loading {
+			if line := strings.TrimSpace(ansi.Strip(msg.line)); line != "" {
+				// Kept to one line so the status bar doesn't jump around
+				status := fmt.Sprintf("%s › %s", tools.FormatToolExecution(msg.toolName, msg.arguments), line)
+				m.toolStatus = ansi.Truncate(status, max(m.width-8, 20), "…")
+			}
+		}
+		return m, waitForEvent(m.events)
+
+	case toolExecMsg:
+		if m.loading {
+			mark := "✓"
+			if msg.error {
+				mark = "❌"
+			}
+			m.toolStatus = fmt.Sprintf("%s %s, thinking...", mark, tools.FormatToolExecution(msg.toolName, msg.arguments))
+		}
+		return m, waitForEvent(m.events)
+
+	case streamChunkMsg:
+		// Chunks can trail the final response or a cancel; drop any that arrive after them
+		if m.loading && m.cancelRequest != nil && len(m.typingChunks) == 0 {
+			if msg.Done {
+				// Text that preceded tool calls is superseded by the final response
+				if msg.Message != nil && len(msg.Message.ToolCalls) > 0 {
+					m.streamText = ""
+				}
+			} else {
+				m.streamText += msg.Content
+			}
+			if m.streamIdx < 0 {
+				m.messages = append(m.messages, "")
+				m.streamIdx = len(m.messages) - 1
+			}
+			m.messages[m.streamIdx] = styleClippy.Render("[📎] ") + m.streamText
+			m.toolStatus = "Streaming..."
+			m.updateViewport()
+		}
+		return m, waitForEvent(m.events)
+
 	case responseMsg:
+		// Already shown as cancelled when Esc was pressed; now the agent is done with it
+		// The request is over, so the agent's running total is safe to read
+		m.tokensUsed = m.agent.TokensUsed
+		if msg.usage != nil && msg.usage.Cancelled {
+			m.loading = false
+			m.toolStatus = ""
+			m.streamIdx = -1
+			m.streamText = ""
+			return m, nil
+		}
+		if m.cancelRequest != nil {
+			m.cancelRequest()
+			m.cancelRequest = nil
+		}
 		m.loading = false
 		m.toolStatus = ""
+		m.unsaved = true
+
+		// The final response replaces the streamed preview
+		if m.streamIdx >= 0 {
+			m.messages = m.messages[:m.streamIdx]
+			m.streamIdx = -1
+			m.streamText = ""
+		}
 
 		// Show detailed tool execution information
 		if msg.usage != nil && len(msg.usage.ToolExecutions) > 0 {
 			for _, exec := range msg.usage.ToolExecutions {
-				// Create a description of the tool execution
-				desc := tools.FormatToolExecution(exec.Name, exec.Arguments)
-				
-				// Style based on success/error
-				var execMsg string
-				if exec.IsError {
-					execMsg = styleToolError.Render(fmt.Sprintf("[❌] %s", desc))
-				} else {
-					execMsg = styleTool.Render(fmt.Sprintf("[✓] %s", desc))
-				}
-				m.messages = append(m.messages, execMsg)
+				m.addTool(toolEntry{name: exec.Name, args: exec.Arguments, result: exec.Result, isError: exec.IsError})
 			}
 		}
 
@@ -566,13 +1210,53 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
-		m.messages = append(m.messages, styleClippy.Render("[📎] ")+content)
+		if m.agent.GetConfig().ResponseFormat == llm.ResponseFormatJSON {
+			content = m.prettyJSON(content)
+		}
+
+		var typingCmd tea.Cmd
+		if m.typing && content != "" && !m.agent.GetConfig().Stream {
+			// Reveal the response word by word; input stays locked until it finishes
+			m.messages = append(m.messages, styleClippy.Render("[📎] "))
+			m.typingIdx = len(m.messages) - 1
+			m.stamp(time.Now())
+			m.typingChunks = splitWordChunks(content)
+			m.loading = true
+			m.toolStatus = "Typing..."
+			typingCmd = typingTick()
+		} else {
+			m.messages = append(m.messages, styleClippy.Render("[📎] ")+content)
+			m.stamp(time.Now())
+		}
 		if msg.usage != nil && msg.usage.Usage != nil {
 			m.totalTokens += msg.usage.Usage.TotalTokens
+			m.promptTokens += msg.usage.Usage.PromptTokens
+			m.completionTokens += msg.usage.Usage.CompletionTokens
+			m.cachedTokens += msg.usage.Usage.CachedTokens
 			m.lastUsage = msg.usage
 		}
+		if msg.usage != nil {
+			for _, name := range msg.usage.ToolsUsed {
+				m.toolCounts[name]++
+			}
+		}
+		m.recordModelUsed(m.agent.GetConfig().Model)
 		m.updateViewport()
-		return m, nil
+		return m, typingCmd
+
+	case typingTickMsg:
+		if len(m.typingChunks) == 0 {
+			return m, nil
+		}
+		m.messages[m.typingIdx] += m.typingChunks[0]
+		m.typingChunks = m.typingChunks[1:]
+		m.updateViewport()
+		if len(m.typingChunks) == 0 {
+			m.loading = false
+			m.toolStatus = ""
+			return m, nil
+		}
+		return m, typingTick()
 
 	case spinner.TickMsg:
 		m.spinner, cmd = m.spinner.Update(msg)
@@ -586,6 +1270,33 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// answerConfirm replies to the pending destructive tool prompt and notes the decision
+func (m *model) answerConfirm(allow bool) {
+	m.confirmReply <- allow
+	m.confirmReply = nil
+	if allow {
+		m.toolStatus = "Working..."
+		m.messages = append(m.messages, styleStatus.Render("[✓] Approved"))
+	} else {
+		m.toolStatus = "Thinking..."
+		m.messages = append(m.messages, styleStatus.Render("[✗] Denied"))
+	}
+	m.updateViewport()
+}
+
+// recordModelUsed remembers each distinct model the session talked to
+func (m *model) recordModelUsed(name string) {
+	if name == "" {
+		return
+	}
+	for _, used := range m.modelsUsed {
+		if used == name {
+			return
+		}
+	}
+	m.modelsUsed = append(m.modelsUsed, name)
+}
+
 func (m *model) updateSuggestions() {
 	input := m.textArea.Value()
 	if !strings.HasPrefix(input, "/") {
@@ -595,6 +1306,11 @@ func (m *model) updateSuggestions() {
 	}
 
 	m.suggestions = []string{}
+	if name, ok := strings.CutPrefix(input, "/model "); ok {
+		m.suggestions = modelSuggestions(m.models, name)
+		m.suggestionIdx = 0
+		return
+	}
 	for _, cmd := range availableCommands {
 		if strings.HasPrefix(cmd, input) {
 			m.suggestions = append(m.suggestions, cmd)
@@ -603,7 +1319,69 @@ func (m *model) updateSuggestions() {
 	m.suggestionIdx = 0
 }
 
-// wrapText wraps text to the specified width, preserving newlines
+// maxModelSuggestions caps the /model completions shown, since providers list hundreds of models
+const maxModelSuggestions = 8
+
+// modelMismatch warns when a model plainly belongs to another provider, e.g. a Claude model
+// sent to OpenAI. Proxies and Ollama can serve any name, so only well-known families are checked.
+func modelMismatch(provider, model string) string {
+	owner := ""
+	switch {
+	case strings.HasPrefix(model, "claude-"):
+		owner = "anthropic"
+	case strings.HasPrefix(model, "gpt-"), strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "o4"):
+		owner = "openai"
+	}
+	if owner == "" || owner == provider || provider == "ollama" || (owner == "openai" && provider == "azure") {
+		return ""
+	}
+	return fmt.Sprintf("%s looks like a model for %s; requests to %s will likely fail (use /provider %s or /model <name>)", model, owner, provider, owner)
+}
+
+// modelSuggestions completes "/model <partial>" from models: names starting with partial
+// first, then names containing it anywhere, ignoring case
+func modelSuggestions(models []string, partial string) []string {
+	partial = strings.ToLower(strings.TrimSpace(partial))
+	var prefixed, containing []string
+	for _, name := range models {
+		lower := strings.ToLower(name)
+		switch {
+		case lower == partial:
+			// Already complete, so nothing to suggest
+			return nil
+		case strings.HasPrefix(lower, partial):
+			prefixed = append(prefixed, "/model "+name)
+		case strings.Contains(lower, partial):
+			containing = append(containing, "/model "+name)
+		}
+	}
+	suggestions := append(prefixed, containing...)
+	return suggestions[:min(len(suggestions), maxModelSuggestions)]
+}
+
+// budgetWarnPercent is how much of the token budget can be used before the status bar warns
+const budgetWarnPercent = 80
+
+// budgetWarning reports whether usage is past budgetWarnPercent of the token budget
+func (m model) budgetWarning() bool {
+	return m.agent.TokenBudget > 0 && m.tokensUsed*100 > m.agent.TokenBudget*budgetWarnPercent
+}
+
+// prettyJSON indents a JSON reply, fenced as a json code block when Markdown rendering is on
+// so it's highlighted. Replies that aren't valid JSON are returned unchanged.
+func (m model) prettyJSON(content string) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(strings.TrimSpace(content)), "", "  "); err != nil {
+		return content
+	}
+	if m.markdown {
+		return "```json\n" + out.String() + "\n```"
+	}
+	return out.String()
+}
+
+// wrapText wraps text to the specified width in runes, preserving newlines. It works on
+// runes rather than bytes so emoji and other multibyte characters are never split.
 func wrapText(text string, width int) string {
 	if width <= 0 {
 		return text
@@ -620,10 +1398,11 @@ func wrapText(text string, width int) string {
 		}
 
 		// Wrap each line
-		for len(line) > width {
+		runes := []rune(line)
+		for len(runes) > width {
 			// Find the last space before the width limit
 			breakPoint := width
-			for ; breakPoint > 0 && !unicode.IsSpace(rune(line[breakPoint])); breakPoint-- {
+			for ; breakPoint > 0 && !unicode.IsSpace(runes[breakPoint]); breakPoint-- {
 			}
 
 			if breakPoint == 0 {
@@ -631,12 +1410,12 @@ func wrapText(text string, width int) string {
 				breakPoint = width
 			}
 
-			wrappedLines = append(wrappedLines, strings.TrimSpace(line[:breakPoint]))
-			line = strings.TrimSpace(line[breakPoint:])
+			wrappedLines = append(wrappedLines, strings.TrimSpace(string(runes[:breakPoint])))
+			runes = []rune(strings.TrimSpace(string(runes[breakPoint:])))
 		}
 
-		if len(line) > 0 {
-			wrappedLines = append(wrappedLines, line)
+		if len(runes) > 0 {
+			wrappedLines = append(wrappedLines, string(runes))
 		}
 	}
 
@@ -687,6 +1466,22 @@ func (m *model) resizeTextarea() {
 	m.textArea.SetHeight(lines)
 }
 
+// layout gives the viewport whatever height the header, status bar, input, and footer leave
+func (m *model) layout() {
+	headerHeight := 5
+	footerHeight := 3
+	statusHeight := 1
+	if m.focus {
+		footerHeight = 0
+		statusHeight = 0
+	}
+	inputHeight := m.textArea.Height()
+
+	m.viewport.YPosition = headerHeight
+	m.viewport.Width = m.width
+	m.viewport.Height = m.height - headerHeight - footerHeight - statusHeight - inputHeight
+}
+
 func (m *model) updateViewport() {
 	width := m.width - 6 // Account for borders and padding
 	if width < 0 {
@@ -694,13 +1489,82 @@ func (m *model) updateViewport() {
 	}
 
 	var wrappedMessages []string
-	for _, msg := range m.messages {
-		wrappedMessages = append(wrappedMessages, wordwrap.String(msg, width))
+	now := time.Now()
+	for i, msg := range m.messages {
+		info := m.lines[i]
+		if info.tool != nil {
+			msg = info.tool.render(m.verbose)
+		}
+		// A message still streaming or being typed changes every redraw, so it stays plain
+		// until it's complete rather than filling the Markdown cache with partial versions
+		inProgress := i == m.streamIdx || (len(m.typingChunks) > 0 && i == m.typingIdx)
+		out, ok := "", false
+		if m.markdown && !inProgress {
+			out, ok = m.layoutMarkdown(msg, width)
+		}
+		if !ok {
+			out = layoutMessage(msg, width)
+		}
+		if !info.time.IsZero() && m.timestamps {
+			out = styleStatus.Faint(true).Render(formatStamp(info.time, now)) + "\n" + out
+		}
+		wrappedMessages = append(wrappedMessages, out)
 	}
 
 	content := strings.Join(wrappedMessages, "\n\n")
+
+	// Only follow new content if the user hasn't scrolled up to read something
+	follow := m.autoScroll && m.viewport.AtBottom()
 	m.viewport.SetContent(content)
-	m.viewport.GotoBottom()
+	if follow {
+		m.viewport.GotoBottom()
+		m.newBelow = false
+	} else if !m.viewport.AtBottom() {
+		m.newBelow = true
+	}
+}
+
+// layoutMessage wraps a message to width, offsetting it by role as the theme's layout asks
+func layoutMessage(msg string, width int) string {
+	plain := ansi.Strip(msg)
+	switch {
+	case strings.HasPrefix(plain, "[📎] ") && currentTheme.ClippyIndent > 0:
+		n := currentTheme.ClippyIndent
+		if n >= width {
+			return wordwrap.String(msg, width)
+		}
+		return indent.String(wordwrap.String(msg, width-n), uint(n))
+	case strings.HasPrefix(plain, "[You] ") && currentTheme.userAlign() == "right":
+		return lipgloss.NewStyle().Width(width).Align(lipgloss.Right).Render(wordwrap.String(msg, width))
+	}
+	return wordwrap.String(msg, width)
+}
+
+// layoutMarkdown renders an assistant message's content as Markdown, hanging it under the
+// "[📎] " prefix. It reports false for other messages, or if rendering fails.
+func (m *model) layoutMarkdown(msg string, width int) (string, bool) {
+	const prefix = "[📎] "
+	plain := ansi.Strip(msg)
+	if !strings.HasPrefix(plain, prefix) || m.md == nil {
+		return "", false
+	}
+	n := 0
+	if currentTheme.ClippyIndent > 0 && currentTheme.ClippyIndent < width {
+		n = currentTheme.ClippyIndent
+	}
+	hang := lipgloss.Width(prefix)
+	if width-n-hang < 10 {
+		return "", false
+	}
+	body, ok := m.md.render(strings.TrimPrefix(plain, prefix), width-n-hang)
+	if !ok {
+		return "", false
+	}
+	out := styleClippy.Render(prefix) + strings.ReplaceAll(body, "\n", "\n"+strings.Repeat(" ", hang))
+	if n > 0 {
+		out = indent.String(out, uint(n))
+	}
+	return out, true
 }
 
 func (m model) View() string {
@@ -733,20 +1597,36 @@ func (m model) View() string {
 		statusText = fmt.Sprintf("%s %s", m.spinner.View(), m.toolStatus)
 	} else {
 		usageInfo := ""
-		if m.totalTokens > 0 {
+		if m.agent.TokenBudget > 0 {
+			usageInfo = fmt.Sprintf(" | Tokens: %d / %d", m.tokensUsed, m.agent.TokenBudget)
+		} else if m.totalTokens > 0 {
 			usageInfo = fmt.Sprintf(" | Tokens: %d", m.totalTokens)
 		}
 		statusText = fmt.Sprintf("Ready | Messages: %d%s | Use mouse wheel to scroll through history", len(m.messages)/2, usageInfo)
 	}
-	statusBar := styleStatus.Width(m.width - 2).Render(statusText)
-		// Input area
+	if m.newBelow && !m.viewport.AtBottom() {
+		statusText += " | ↓ new messages"
+	}
+	statusStyle := styleStatus
+	if m.budgetWarning() {
+		statusStyle = styleToolError
+	}
+	statusBar := statusStyle.Width(m.width - 2).Render(statusText)
+	// Input area
 	var inputBox string
-	if m.loading {
+	if m.searching {
+		inputBox = lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color(ColorBorder)).
+			Width(m.width-2).
+			Padding(0, 1).
+			Render(m.searchView())
+	} else if m.loading {
 		inputArea := stylePrompt.Render("> ") + "⏳ Working..."
 		inputBox = lipgloss.NewStyle().
 			BorderStyle(lipgloss.RoundedBorder()).
 			BorderForeground(lipgloss.Color(ColorBorder)).
-			Width(m.width - 2).
+			Width(m.width-2).
 			Padding(0, 1).
 			Render(inputArea)
 	} else {
@@ -767,7 +1647,7 @@ func (m model) View() string {
 		inputBox = lipgloss.NewStyle().
 			BorderStyle(lipgloss.RoundedBorder()).
 			BorderForeground(lipgloss.Color(ColorBorder)).
-			Width(m.width - 2).
+			Width(m.width-2).
 			Padding(0, 1).
 			Render(textareaContent)
 	}
@@ -799,6 +1679,14 @@ func (m model) View() string {
 	}
 	footer := styleFooter.Width(m.width - 2).Render(footerText)
 
+	if m.focus {
+		return lipgloss.JoinVertical(lipgloss.Left,
+			header,
+			viewportContent,
+			inputBox,
+		)
+	}
+
 	// Combine all sections
 	if suggestionsView != "" {
 		return lipgloss.JoinVertical(lipgloss.Left,
@@ -820,14 +1708,72 @@ func (m model) View() string {
 	)
 }
 
+// typingDelay is the pause between words when simulating typing
+const typingDelay = 30 * time.Millisecond
+
+// typingTickMsg reveals the next word of a simulated-typing response
+type typingTickMsg struct{}
+
+func typingTick() tea.Cmd {
+	return tea.Tick(typingDelay, func(time.Time) tea.Msg {
+		return typingTickMsg{}
+	})
+}
+
+// splitWordChunks splits text into words that keep their trailing whitespace,
+// so joining the chunks reproduces the text exactly
+func splitWordChunks(text string) []string {
+	var chunks []string
+	start := 0
+	inSpace := false
+	for i, r := range text {
+		isSpace := unicode.IsSpace(r)
+		if !isSpace && inSpace && i > start {
+			chunks = append(chunks, text[start:i])
+			start = i
+		}
+		inSpace = isSpace
+	}
+	if start < len(text) {
+		chunks = append(chunks, text[start:])
+	}
+	return chunks
+}
+
 type modelsMsg struct {
 	models []string
 	err    error
 }
 
-func fetchModelsCmd() tea.Cmd {
+// compactMsg reports the outcome of /compact-tool-results
+type compactMsg struct {
+	result agent.CompactResult
+	err    error
+}
+
+func compactCmd(a *agent.Agent, keep int) tea.Cmd {
+	return func() tea.Msg {
+		result, err := a.CompactToolResults(context.Background(), keep)
+		return compactMsg{result: result, err: err}
+	}
+}
+
+// summarizeMsg reports the outcome of /compact
+type summarizeMsg struct {
+	result agent.CompactResult
+	err    error
+}
+
+func summarizeCmd(a *agent.Agent) tea.Cmd {
 	return func() tea.Msg {
-		models, err := llm.FetchModels()
+		result, err := a.SummarizeOldHistory(context.Background())
+		return summarizeMsg{result: result, err: err}
+	}
+}
+
+func fetchModelsCmd(provider llm.Provider) tea.Cmd {
+	return func() tea.Msg {
+		models, err := llm.FetchModels(context.Background(), provider)
 		return modelsMsg{models: models, err: err}
 	}
-}
\ No newline at end of file
+}
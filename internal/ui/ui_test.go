@@ -0,0 +1,1234 @@
+package ui
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/atotto/clipboard"
+	"github.com/cellwebb/clippy-go/internal/agent"
+	"github.com/cellwebb/clippy-go/internal/llm"
+	"github.com/cellwebb/clippy-go/internal/tools"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestSessionStats_CSVRow(t *testing.T) {
+	agt := agent.New(nil)
+	agt.History = append(agt.History,
+		llm.Message{Role: "user", Content: "hi"},
+		llm.Message{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "1", Name: "read_file"}}},
+		llm.Message{Role: "tool", Content: "file", ToolCallID: "1"},
+		llm.Message{Role: "assistant", Content: "done"},
+	)
+
+	m := InitialModel(agt)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	m.startTime = start
+	m.promptTokens = 100
+	m.completionTokens = 50
+	m.totalTokens = 150
+	m.recordModelUsed("gpt-4o")
+	m.recordModelUsed("gpt-4o")
+	m.recordModelUsed("gpt-4o-mini")
+	m.toolCounts["read_file"] = 2
+	m.toolCounts["list_directory"] = 1
+
+	stats := m.sessionStats(start.Add(90 * time.Second))
+	row := stats.csvRow()
+
+	if len(row) != len(statsCSVHeader) {
+		t.Fatalf("Expected %d columns, got %d: %v", len(statsCSVHeader), len(row), row)
+	}
+
+	expected := map[string]string{
+		"start_time":         "2024-01-02T03:04:05Z",
+		"duration_seconds":   "90",
+		"user_messages":      "1",
+		"assistant_messages": "2",
+		"tool_messages":      "1",
+		"prompt_tokens":      "100",
+		"completion_tokens":  "50",
+		"total_tokens":       "150",
+		"estimated_cost":     "unknown",
+		"models":             "gpt-4o;gpt-4o-mini",
+		"tools":              "list_directory:1;read_file:2",
+	}
+	for i, column := range statsCSVHeader {
+		if row[i] != expected[column] {
+			t.Errorf("Column %s: expected %q, got %q", column, expected[column], row[i])
+		}
+	}
+}
+
+func TestStatus_ShowsElapsedTimeAndThroughput(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		42 * time.Second:               "42s",
+		5*time.Minute + 10*time.Second: "5m",
+		83 * time.Minute:               "1h23m",
+	} {
+		if got := formatElapsed(d); got != want {
+			t.Errorf("formatElapsed(%v) = %q, want %q", d, got, want)
+		}
+	}
+
+	m := InitialModel(agent.New(nil))
+	m.startTime = time.Now().Add(-2 * time.Minute)
+	m.totalTokens = 3000
+	status := ansi.Strip(m.statusReport())
+	if !strings.Contains(status, "Session duration: 2m") || !strings.Contains(status, "Throughput: 1500 tokens/min") {
+		t.Errorf("Expected elapsed time and throughput in /status, got:\n%s", status)
+	}
+}
+
+func TestEstimateCost_UsesModelRates(t *testing.T) {
+	for _, tt := range []struct {
+		provider, model string
+		want            string
+	}{
+		{"openai", "gpt-4o-mini", "$0.0750"},
+		{"openai", "gpt-4o-mini-2024-07-18", "$0.0750"}, // Dated variants match by prefix
+		{"anthropic", "claude-3-5-sonnet-latest", "$1.8000"},
+		{"ollama", "llama3.2", "$0.0000"},
+		{"openai", "some-future-model", "unknown"},
+	} {
+		if got := estimateCost(defaultPricing, tt.provider, tt.model, 100_000, 0, 100_000); got != tt.want {
+			t.Errorf("estimateCost(%s) = %s, want %s", tt.model, got, tt.want)
+		}
+	}
+
+	// Cache reads are billed at the cheaper cached rate: 900k at $3, 100k at $0.30
+	if got := estimateCost(defaultPricing, "anthropic", "claude-sonnet-4", 1_000_000, 100_000, 0); got != "$2.7300" {
+		t.Errorf("Expected cached tokens at the cache-read rate, got %s", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	os.WriteFile(path, []byte(`{"some-future-model": {"prompt": 1, "completion": 2}}`), 0644)
+	pricing, err := loadPricing(path)
+	if err != nil {
+		t.Fatalf("loadPricing: %v", err)
+	}
+	// Without a cached rate, cache reads cost the prompt rate
+	if got := estimateCost(pricing, "openai", "some-future-model", 1_000_000, 400_000, 500_000); got != "$2.0000" {
+		t.Errorf("Expected the override rate to be used, got %s", got)
+	}
+	if _, ok := pricing["gpt-4o"]; !ok {
+		t.Error("Expected overrides to keep the default rates")
+	}
+}
+
+func TestInitialModel_WarnsAboutBadPricing(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if m := InitialModel(agent.New(nil)); len(m.messages) != 0 {
+		t.Errorf("Expected no warning without a pricing file, got %q", m.messages)
+	}
+
+	os.MkdirAll(filepath.Join(home, ".clippy"), 0755)
+	os.WriteFile(filepath.Join(home, ".clippy", "pricing.json"), []byte(`{"gpt-4o": {"prompt": -1}}`), 0644)
+	m := InitialModel(agent.New(nil))
+	if len(m.messages) != 1 || !strings.Contains(ansi.Strip(m.messages[0]), "Using default pricing: invalid pricing for gpt-4o") {
+		t.Errorf("Expected a warning about the pricing file, got %q", m.messages)
+	}
+	if m.pricing["gpt-4o"].Prompt != defaultPricing["gpt-4o"].Prompt {
+		t.Error("Expected the default rates to be kept")
+	}
+}
+
+func TestAppendStatsCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "stats.csv")
+	stats := sessionStats{Start: time.Now(), TotalTokens: 42, EstimatedCost: "unknown"}
+
+	if err := appendStatsCSV(path, stats); err != nil {
+		t.Fatalf("appendStatsCSV failed: %v", err)
+	}
+	if err := appendStatsCSV(path, stats); err != nil {
+		t.Fatalf("appendStatsCSV failed: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open CSV: %v", err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+
+	// Header once, then one row per export
+	if len(records) != 3 {
+		t.Fatalf("Expected header plus 2 rows, got %d records", len(records))
+	}
+	if records[0][0] != "start_time" {
+		t.Errorf("Expected header row first, got %v", records[0])
+	}
+	if records[2][7] != "42" {
+		t.Errorf("Expected total_tokens 42, got %q", records[2][7])
+	}
+}
+
+func TestSplitWordChunks(t *testing.T) {
+	text := "Hello  there,\nworld! 📎 done "
+	chunks := splitWordChunks(text)
+
+	if strings.Join(chunks, "") != text {
+		t.Errorf("Chunks don't reconstruct the text: %q", chunks)
+	}
+	if len(chunks) != 5 {
+		t.Errorf("Expected 5 word chunks, got %d: %q", len(chunks), chunks)
+	}
+}
+
+func TestWrapText_KeepsMultibyteRunesWhole(t *testing.T) {
+	line := "📎📎📎 こんにちは世界 café 📎 naïve 日本語のテキスト"
+	for width := 1; width <= len([]rune(line)); width++ {
+		wrapped := wrapText(line, width)
+		if !utf8.ValidString(wrapped) || strings.ContainsRune(wrapped, utf8.RuneError) {
+			t.Fatalf("width %d: wrapping split a rune: %q", width, wrapped)
+		}
+		for _, l := range strings.Split(wrapped, "\n") {
+			if n := utf8.RuneCountInString(l); n > width {
+				t.Errorf("width %d: line %q has %d runes", width, l, n)
+			}
+		}
+		if got := strings.Join(strings.Fields(wrapped), ""); got != strings.Join(strings.Fields(line), "") {
+			t.Errorf("width %d: wrapping lost text: %q", width, wrapped)
+		}
+	}
+}
+
+func TestTypingSimulation_RevealsFullMessage(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	m.typing = true
+
+	content := "Looks like you're writing some Go! Want help?"
+	updated, cmd := m.Update(responseMsg{content: content})
+	m = updated.(model)
+	if cmd == nil {
+		t.Fatal("Expected a typing command to be scheduled")
+	}
+	if !m.loading {
+		t.Error("Input should stay locked while typing")
+	}
+
+	expected := styleClippy.Render("[📎] ") + content
+	for i := 0; i < 100 && m.loading; i++ {
+		if m.messages[len(m.messages)-1] == expected {
+			break
+		}
+		updated, _ = m.Update(typingTickMsg{})
+		m = updated.(model)
+	}
+
+	if got := m.messages[len(m.messages)-1]; got != expected {
+		t.Errorf("Expected typed message %q, got %q", expected, got)
+	}
+	if m.loading {
+		t.Error("Typing should unlock input once the message is complete")
+	}
+}
+
+func TestStreaming_AppendsChunksThenFinalResponse(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	m.loading = true
+	m.cancelRequest = func() {}
+	m.messages = append(m.messages, styleUser.Render("[You] ")+"hi")
+
+	for _, part := range []string{"Hello", ", there"} {
+		updated, cmd := m.Update(streamChunkMsg{Content: part})
+		m = updated.(model)
+		if cmd == nil {
+			t.Fatal("Expected the UI to keep listening for stream events")
+		}
+	}
+	if got, want := m.messages[len(m.messages)-1], styleClippy.Render("[📎] ")+"Hello, there"; got != want {
+		t.Errorf("Expected streamed preview %q, got %q", want, got)
+	}
+
+	updated, _ := m.Update(responseMsg{content: "Hello, there"})
+	m = updated.(model)
+	if len(m.messages) != 2 {
+		t.Fatalf("Expected the final response to replace the preview, got %d messages", len(m.messages))
+	}
+	if m.streamIdx != -1 || m.streamText != "" {
+		t.Error("Expected stream state to reset after the response")
+	}
+
+	// Chunks trailing the response are ignored
+	updated, _ = m.Update(streamChunkMsg{Content: "late"})
+	m = updated.(model)
+	if len(m.messages) != 2 {
+		t.Errorf("Expected late chunks to be dropped, got %d messages", len(m.messages))
+	}
+}
+
+func TestThemeOverride_ChangesStyle(t *testing.T) {
+	t.Cleanup(func() { applyTheme(defaultTheme) })
+
+	m := InitialModel(agent.New(nil))
+	m.applyTheme(defaultTheme)
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("/theme set clippy #123456")})
+	m = updated.(model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+
+	if got := styleClippy.GetForeground(); got != lipgloss.Color("#123456") {
+		t.Errorf("Expected clippy foreground #123456, got %v", got)
+	}
+	if got := styleUser.GetForeground(); got != lipgloss.Color(ColorCyan) {
+		t.Errorf("Other elements should keep their colors, got user %v", got)
+	}
+	if currentTheme.Clippy != "#123456" {
+		t.Errorf("Expected current theme to record the override, got %q", currentTheme.Clippy)
+	}
+}
+
+func TestTheme_RejectsInvalidColor(t *testing.T) {
+	if _, err := defaultTheme.withColor("clippy", "not-a-color"); err == nil {
+		t.Error("Expected invalid color to be rejected")
+	}
+	if _, err := defaultTheme.withColor("sparkles", "#ffffff"); err == nil {
+		t.Error("Expected unknown element to be rejected")
+	}
+}
+
+func TestSaveAndLoadTheme(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "theme.json")
+	theme, _ := defaultTheme.withColor("border", "#abcdef")
+
+	if err := saveTheme(path, theme); err != nil {
+		t.Fatalf("saveTheme failed: %v", err)
+	}
+	loaded, err := loadTheme(path)
+	if err != nil {
+		t.Fatalf("loadTheme failed: %v", err)
+	}
+	if loaded != theme {
+		t.Errorf("Expected %+v, got %+v", theme, loaded)
+	}
+}
+
+func TestFocusMode_ReclaimsViewportHeight(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+	m = updated.(model)
+	normalHeight := m.viewport.Height
+
+	m.textArea.SetValue("/focus")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if !m.focus {
+		t.Fatal("Expected /focus to enable focus mode")
+	}
+	// The status bar (1 line) and footer (3 lines) are hidden
+	if got := m.viewport.Height; got != normalHeight+4 {
+		t.Errorf("Expected viewport height %d in focus mode, got %d", normalHeight+4, got)
+	}
+	if strings.Contains(m.View(), "Enter to send") {
+		t.Error("Footer should be hidden in focus mode")
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	m = updated.(model)
+	if m.focus {
+		t.Error("Expected any key to exit focus mode")
+	}
+	if m.viewport.Height != normalHeight {
+		t.Errorf("Expected viewport height %d after leaving focus, got %d", normalHeight, m.viewport.Height)
+	}
+	if m.textArea.Value() != "" {
+		t.Errorf("The key that exits focus mode shouldn't be typed, got %q", m.textArea.Value())
+	}
+}
+
+func TestToolsDescribe_ListsParameters(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	m.textArea.SetValue("/tools describe list_directory")
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+
+	out := m.messages[len(m.messages)-1]
+	for _, want := range []string{"list_directory", "path", "required", "sort", "filter", "optional"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in tool description:\n%s", want, out)
+		}
+	}
+
+	all := describeTools(m.agent.GetToolDefinitions(), "")
+	for _, tool := range m.agent.GetToolDefinitions() {
+		if !strings.Contains(all, tool.Definition().Name) {
+			t.Errorf("Expected %s in the tool summary", tool.Definition().Name)
+		}
+	}
+	if !strings.Contains(describeTools(m.agent.GetToolDefinitions(), "nope"), "Unknown tool") {
+		t.Error("Expected an unknown tool to be reported")
+	}
+}
+
+// fakeLLM answers every request with Reply, after first making ToolCalls if set, and
+// records what it was sent
+type fakeLLM struct {
+	Reply     string
+	ToolCalls []llm.ToolCall
+	Sent      [][]llm.Message
+}
+
+func (f *fakeLLM) Generate(ctx context.Context, messages []llm.Message, ts []tools.Tool) (*llm.Message, error) {
+	f.Sent = append(f.Sent, append([]llm.Message(nil), messages...))
+	if len(f.Sent) == 1 && len(f.ToolCalls) > 0 {
+		return &llm.Message{Role: "assistant", ToolCalls: f.ToolCalls}, nil
+	}
+	return &llm.Message{Role: "assistant", Content: f.Reply}, nil
+}
+
+func (f *fakeLLM) GenerateStream(ctx context.Context, messages []llm.Message, ts []tools.Tool) (<-chan llm.StreamChunk, error) {
+	return nil, fmt.Errorf("streaming not supported")
+}
+
+func (f *fakeLLM) UpdateConfig(cfg llm.Config) {}
+
+func (f *fakeLLM) GetConfig() llm.Config {
+	return llm.Config{}
+}
+
+func TestExamples_SentButNotRendered(t *testing.T) {
+	provider := &fakeLLM{Reply: "Sure thing!"}
+	agt := agent.New(provider)
+	agt.SetExamples([]agent.Example{{User: "EXAMPLE-QUESTION", Assistant: "EXAMPLE-ANSWER"}})
+
+	m := InitialModel(agt)
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+	m = updated.(model)
+
+	m.textArea.SetValue("hello")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	updated, _ = m.Update(m.getAgentResponse(context.Background(), "hello")())
+	m = updated.(model)
+
+	sent := provider.Sent[0]
+	if sent[1].Content != "EXAMPLE-QUESTION" || sent[2].Content != "EXAMPLE-ANSWER" {
+		t.Errorf("Expected the examples to be sent to the provider, got %+v", sent)
+	}
+	view := m.viewport.View()
+	if !strings.Contains(view, "Sure thing!") {
+		t.Errorf("Expected the reply in the viewport:\n%s", view)
+	}
+	if strings.Contains(view, "EXAMPLE") {
+		t.Errorf("Examples should not be rendered:\n%s", view)
+	}
+	if stats := m.sessionStats(time.Now()); stats.UserMessages != 1 || stats.AssistantMessages != 1 {
+		t.Errorf("Examples should not count as conversation messages, got %+v", stats)
+	}
+}
+
+func TestToolProgress_UpdatesStatusLive(t *testing.T) {
+	provider := &fakeLLM{Reply: "Done!", ToolCalls: []llm.ToolCall{{ID: "1", Name: "get_current_directory", Arguments: map[string]interface{}{}}}}
+	m := InitialModel(agent.New(provider))
+	m.textArea.SetValue("where am I?")
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+
+	result := make(chan tea.Msg, 1)
+	go func() { result <- m.getAgentResponse(context.Background(), "where am I?")() }()
+
+	desc := tools.FormatToolExecution("get_current_directory", map[string]interface{}{})
+	for _, want := range []string{desc, "✓ " + desc} {
+		updated, _ = m.Update(<-m.events)
+		m = updated.(model)
+		if !strings.Contains(m.toolStatus, want) {
+			t.Errorf("Expected status %q while the tool runs, got %q", want, m.toolStatus)
+		}
+	}
+	updated, _ = m.Update(<-result)
+	m = updated.(model)
+	if m.loading || m.toolStatus != "" {
+		t.Errorf("Expected the status cleared after the response, got %q", m.toolStatus)
+	}
+}
+
+// blockingLLM never answers until its request is cancelled
+type blockingLLM struct{}
+
+func (blockingLLM) Generate(ctx context.Context, messages []llm.Message, ts []tools.Tool) (*llm.Message, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingLLM) GenerateStream(ctx context.Context, messages []llm.Message, ts []tools.Tool) (<-chan llm.StreamChunk, error) {
+	return nil, fmt.Errorf("streaming not supported")
+}
+
+func (blockingLLM) UpdateConfig(cfg llm.Config) {}
+
+func (blockingLLM) GetConfig() llm.Config {
+	return llm.Config{}
+}
+
+func TestEsc_CancelsPendingRequest(t *testing.T) {
+	agt := agent.New(blockingLLM{})
+	m := InitialModel(agt)
+	historyLen := len(agt.History)
+
+	m.textArea.SetValue("take forever")
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if !m.loading || m.cancelRequest == nil {
+		t.Fatal("Expected a cancellable request to be pending")
+	}
+
+	// Run the request the way tea would, in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelRequest = cancel
+	result := make(chan tea.Msg, 1)
+	request := m.getAgentResponse(ctx, "take forever")
+	go func() { result <- request() }()
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = updated.(model)
+	if m.quitting || m.cancelRequest != nil {
+		t.Fatal("Esc should cancel the request, not wait or quit")
+	}
+	if got := m.messages[len(m.messages)-1]; !strings.Contains(got, "[✋] Cancelled") {
+		t.Errorf("Expected a cancelled notice, got %q", got)
+	}
+
+	// Input stays locked until the agent has stopped, so a new turn can't overlap it
+	if !m.loading || m.toolStatus != "Cancelling..." {
+		t.Errorf("Expected input to stay locked while cancelling, got loading %v, status %q", m.loading, m.toolStatus)
+	}
+	m.textArea.SetValue("next question")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if m.textArea.Value() != "next question" {
+		t.Error("Expected a new prompt to wait until cancelling finishes")
+	}
+
+	// A chunk already queued when Esc was pressed is dropped, not shown under the notice
+	count := len(m.messages)
+	updated, _ = m.Update(streamChunkMsg{Content: "late words"})
+	m = updated.(model)
+	if len(m.messages) != count || m.streamIdx != -1 {
+		t.Errorf("Expected a chunk after Esc to be ignored, got %q", m.messages[len(m.messages)-1])
+	}
+
+	select {
+	case msg := <-result:
+		count := len(m.messages)
+		updated, _ = m.Update(msg)
+		m = updated.(model)
+		if len(m.messages) != count {
+			t.Error("The cancelled response should not be rendered")
+		}
+		if m.loading {
+			t.Error("Expected input to unlock once the cancelled response arrives")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("The agent request did not stop after cancel")
+	}
+	if len(agt.History) != historyLen {
+		t.Errorf("Expected the cancelled turn to be dropped from history, got %d messages", len(agt.History))
+	}
+
+	// The next turn's reply lands after its own prompt, which stays in place
+	m.streamIdx = len(m.messages) - 1 // As a stale index from the cancelled turn would have been
+	updated, _ = m.Update(responseMsg{usage: &agent.Response{Cancelled: true}})
+	m = updated.(model)
+	m.messages = append(m.messages, styleUser.Render("[You] ")+"next question")
+	updated, _ = m.Update(responseMsg{content: "Here you go"})
+	m = updated.(model)
+	if n := len(m.messages); n < 2 || !strings.Contains(m.messages[n-2], "next question") || !strings.Contains(m.messages[n-1], "Here you go") {
+		t.Errorf("Expected the new prompt followed by its reply, got %q", m.messages)
+	}
+}
+
+func TestLayout_IndentsClippyMessages(t *testing.T) {
+	t.Cleanup(func() { applyTheme(defaultTheme) })
+	theme := defaultTheme
+	theme.ClippyIndent = 4
+	applyTheme(theme)
+
+	clippy := layoutMessage(styleClippy.Render("[📎] ")+"It looks like you're writing a letter!", 80)
+	if !strings.HasPrefix(clippy, "    ") {
+		t.Errorf("Expected clippy message indented by 4, got %q", clippy)
+	}
+	user := layoutMessage(styleUser.Render("[You] ")+"help", 80)
+	if strings.HasPrefix(user, " ") {
+		t.Errorf("User messages should stay flush left, got %q", user)
+	}
+
+	applyTheme(defaultTheme)
+	if got := layoutMessage(styleClippy.Render("[📎] ")+"hi", 80); strings.HasPrefix(got, " ") {
+		t.Errorf("Default layout should not indent, got %q", got)
+	}
+}
+
+func TestMarkdown_RendersAssistantMessagesOnly(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	m.markdown = true
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	m = updated.(model)
+
+	reply := "## Steps\n\n* first\n* second\n\n```go\nfunc main() {}\n```"
+	rendered, ok := m.layoutMarkdown(styleClippy.Render("[📎] ")+reply, 80)
+	if !ok {
+		t.Fatal("Expected the assistant message to render as Markdown")
+	}
+	plain := ansi.Strip(rendered)
+	if !strings.HasPrefix(plain, "[📎] ") || strings.Contains(plain, "```") || strings.Contains(plain, "* first") {
+		t.Errorf("Expected fences and list markers to be rendered, got %q", plain)
+	}
+	if !strings.Contains(plain, "func main() {}") || !strings.Contains(plain, "• first") {
+		t.Errorf("Expected code and list items in the output, got %q", plain)
+	}
+
+	if _, ok := m.layoutMarkdown(styleUser.Render("[You] ")+"# not a heading", 80); ok {
+		t.Error("User messages should stay plain")
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("/markdown off")})
+	m = updated.(model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if m.markdown {
+		t.Fatal("Expected /markdown off to disable rendering")
+	}
+	m.messages = append(m.messages, styleClippy.Render("[📎] ")+reply)
+	m.updateViewport()
+	if !strings.Contains(m.viewport.View(), "```go") {
+		t.Error("Expected raw Markdown with rendering off")
+	}
+}
+
+func TestMarkdown_SkipsStreamingMessageAndBoundsCache(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	m.markdown = true
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	m = updated.(model)
+	m.loading = true
+	m.cancelRequest = func() {}
+	for _, part := range []string{"## Plan", "\n\n* one", "\n* two"} {
+		updated, _ = m.Update(streamChunkMsg{Content: part})
+		m = updated.(model)
+	}
+	if len(m.md.cache) != 0 || !strings.Contains(m.viewport.View(), "## Plan") {
+		t.Errorf("Expected the streaming message to stay plain and uncached, got %d cached", len(m.md.cache))
+	}
+
+	for i := 0; i < maxMarkdownCache+10; i++ {
+		m.md.render(fmt.Sprintf("message %d", i), 80)
+	}
+	if len(m.md.cache) != maxMarkdownCache || len(m.md.order) != maxMarkdownCache {
+		t.Errorf("Expected the cache capped at %d entries, got %d", maxMarkdownCache, len(m.md.cache))
+	}
+	if _, ok := m.md.cache["message 0"]; ok {
+		t.Error("Expected the oldest entries to be evicted first")
+	}
+}
+
+func TestJSONMode_SetsFormatAndPrettyPrints(t *testing.T) {
+	provider := &llm.OpenAIProvider{}
+	m := InitialModel(agent.New(provider))
+	m.markdown = false
+	send := func(input string) {
+		m.textArea.SetValue(input)
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		m = updated.(model)
+	}
+
+	send("/json on")
+	if got := provider.GetConfig().ResponseFormat; got != llm.ResponseFormatJSON {
+		t.Fatalf("Expected /json on to request JSON, got format %q", got)
+	}
+	updated, _ := m.Update(responseMsg{content: `{"name":"clippy","tags":["a","b"]}`})
+	m = updated.(model)
+	want := "{\n  \"name\": \"clippy\",\n  \"tags\": [\n    \"a\",\n    \"b\"\n  ]\n}"
+	if last := m.messages[len(m.messages)-1]; !strings.HasSuffix(last, want) {
+		t.Errorf("Expected the reply to be indented, got %q", last)
+	}
+
+	send("/json off")
+	if got := provider.GetConfig().ResponseFormat; got != "" {
+		t.Errorf("Expected /json off to clear the format, got %q", got)
+	}
+}
+
+func TestBudget_SetsCapAndWarns(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	m = updated.(model)
+	m.textArea.SetValue("/budget 1000")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if m.agent.TokenBudget != 1000 {
+		t.Fatalf("Expected /budget 1000 to set the budget, got %d", m.agent.TokenBudget)
+	}
+
+	m.agent.TokensUsed = 500
+	updated, _ = m.Update(responseMsg{content: "Done"})
+	m = updated.(model)
+	if !strings.Contains(m.View(), "Tokens: 500 / 1000") || m.budgetWarning() {
+		t.Error("Expected usage against the budget in the status bar, without a warning at 50%")
+	}
+	m.agent.TokensUsed = 850
+	updated, _ = m.Update(responseMsg{content: "Done"})
+	m = updated.(model)
+	if !m.budgetWarning() {
+		t.Error("Expected a warning past 80% of the budget")
+	}
+
+	m.textArea.SetValue("/budget off")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if m.agent.TokenBudget != 0 || m.budgetWarning() {
+		t.Errorf("Expected /budget off to remove the budget, got %d", m.agent.TokenBudget)
+	}
+}
+
+func TestTimestamps_ShownWhenEnabled(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	m.markdown = false
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	m = updated.(model)
+	updated, _ = m.Update(responseMsg{content: "Hello there"})
+	m = updated.(model)
+	stamp := formatStamp(m.lines[len(m.messages)-1].time, time.Now())
+	if stamp == "" || strings.Contains(m.viewport.View(), stamp) {
+		t.Fatalf("Expected a stamped reply with timestamps hidden by default, got stamp %q", stamp)
+	}
+
+	m.textArea.SetValue("/timestamps on")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if !m.timestamps || !strings.Contains(m.viewport.View(), stamp) {
+		t.Errorf("Expected /timestamps on to show %s above the reply", stamp)
+	}
+
+	// Loaded conversations keep the times saved with each message
+	sent := time.Date(2025, 3, 1, 9, 30, 0, 0, time.Local)
+	msgs, lines := renderHistory([]llm.Message{
+		{Role: "user", Content: "hi", Time: sent},
+		{Role: "tool", Content: "ignored", Time: sent},
+		{Role: "assistant", Content: "hello"},
+	})
+	if len(msgs) != 2 || !lines[0].time.Equal(sent) || len(lines) != 1 {
+		t.Errorf("Expected only the user line stamped, got %v", lines)
+	}
+	if got := formatStamp(sent, sent.Add(time.Hour)); got != "09:30:00" {
+		t.Errorf("Expected just the time for today, got %q", got)
+	}
+	if got := formatStamp(sent, sent.AddDate(0, 0, 1)); got != "Mar 1 09:30:00" {
+		t.Errorf("Expected the date for older messages, got %q", got)
+	}
+}
+
+func TestToolOutput_CollapsedUntilVerbose(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	m.markdown = false
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+	m = updated.(model)
+	updated, _ = m.Update(responseMsg{content: "Done", usage: &agent.Response{ToolExecutions: []agent.ToolExecutionDetail{
+		{Name: "read_file", Arguments: map[string]interface{}{"path": "main.go"}, Result: "package main\n\nfunc main() {}\n"},
+		{Name: "read_file", Arguments: map[string]interface{}{"path": "gone.go"}, Result: "Error executing tool: no such file", IsError: true},
+	}}})
+	m = updated.(model)
+
+	view := ansi.Strip(m.viewport.View())
+	if !strings.Contains(view, "main.go → 3 lines") || !strings.Contains(view, "gone.go → Error executing tool: no such file") {
+		t.Errorf("Expected one-line summaries of each tool call, got:\n%s", view)
+	}
+	if strings.Contains(view, "func main() {}") {
+		t.Error("Expected the result to stay collapsed by default")
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	m = updated.(model)
+	if !m.verbose || !strings.Contains(ansi.Strip(m.viewport.View()), "func main() {}") {
+		t.Error("Expected Ctrl+O to expand tool output")
+	}
+	m.textArea.SetValue("/verbose off")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if m.verbose || strings.Contains(ansi.Strip(m.viewport.View()), "func main() {}") {
+		t.Error("Expected /verbose off to collapse tool output again")
+	}
+
+	// Loaded conversations pair each call with its result
+	msgs, lines := renderHistory([]llm.Message{
+		{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "call_1", Name: "list_directory", Arguments: map[string]interface{}{"path": "."}}}},
+		{Role: "tool", ToolCallID: "call_1", Content: "a.go\nb.go"},
+	})
+	if len(msgs) != 1 || lines[0].tool == nil || lines[0].tool.result != "a.go\nb.go" || !strings.Contains(ansi.Strip(msgs[0]), "→ 2 lines") {
+		t.Errorf("Expected the tool call rebuilt with its result, got %q", msgs)
+	}
+}
+
+func TestCopy_LastResponseAndCodeBlock(t *testing.T) {
+	var copied string
+	writeClipboard = func(text string) error { copied = text; return nil }
+	t.Cleanup(func() { writeClipboard = clipboard.WriteAll })
+
+	m := InitialModel(agent.New(nil))
+	if msg := ansi.Strip(m.copyResponse(false)); !strings.Contains(msg, "Nothing to copy") {
+		t.Errorf("Expected nothing to copy before any response, got %q", msg)
+	}
+
+	m.messages = append(m.messages,
+		styleClippy.Render("[📎] ")+"old answer",
+		styleUser.Render("[You] ")+"write hello world",
+		styleClippy.Render("[📎] ")+"Here you go:\n\n```go\nfmt.Println(\"hi\")\n```\n\nEnjoy!",
+		styleStatus.Render("[⚙️] Auto-scroll: on"),
+	)
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlY})
+	m = updated.(model)
+	if !strings.HasPrefix(copied, "Here you go:") || !strings.HasSuffix(copied, "Enjoy!") {
+		t.Errorf("Expected ctrl+y to copy the last response without its prefix, got %q", copied)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("/copy code")})
+	m = updated.(model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if copied != `fmt.Println("hi")` {
+		t.Errorf("Expected /copy code to copy only the code block, got %q", copied)
+	}
+}
+
+func TestFork_IsIndependent(t *testing.T) {
+	agt := agent.New(nil)
+	agt.History = append(agt.History,
+		llm.Message{Role: "user", Content: "hi"},
+		llm.Message{Role: "assistant", Content: "hello"},
+	)
+	m := InitialModel(agt)
+	m.messages = []string{"[You] hi", "[📎] hello"}
+	m.totalTokens = 42
+	m.toolCounts["read_file"] = 1
+
+	m.textArea.SetValue("/fork")
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if m.sessionIdx != 1 || len(m.sessions) != 2 {
+		t.Fatalf("Expected to be in the second of two sessions, got %d of %d", m.sessionIdx+1, len(m.sessions))
+	}
+	if m.totalTokens != 42 || len(agt.History) != 3 {
+		t.Errorf("Fork should copy counters and history, got %d tokens and %d messages", m.totalTokens, len(agt.History))
+	}
+
+	// Diverge in the fork
+	agt.History[1].Content = "changed"
+	agt.History = append(agt.History, llm.Message{Role: "user", Content: "what if"})
+	m.totalTokens = 100
+	m.toolCounts["read_file"] = 5
+
+	m.textArea.SetValue("/sessions 1")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if len(agt.History) != 3 || agt.History[1].Content != "hi" {
+		t.Errorf("Original history was affected by the fork: %+v", agt.History)
+	}
+	if m.totalTokens != 42 || m.toolCounts["read_file"] != 1 {
+		t.Errorf("Original counters were affected by the fork: %d tokens, %v", m.totalTokens, m.toolCounts)
+	}
+
+	m.textArea.SetValue("/sessions 2")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if len(agt.History) != 4 || m.totalTokens != 100 {
+		t.Errorf("Expected the fork's changes back, got %d messages and %d tokens", len(agt.History), m.totalTokens)
+	}
+}
+
+func TestSaveAndLoad_RerendersConversation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	agt := agent.New(nil)
+	agt.History = append(agt.History,
+		llm.Message{Role: "user", Content: "hi"},
+		llm.Message{Role: "assistant", Content: "hello there"},
+	)
+	m := InitialModel(agt)
+	if len(m.messages) != 2 {
+		t.Fatalf("Expected the existing conversation to be rendered, got %q", m.messages)
+	}
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+	m = updated.(model)
+
+	m.textArea.SetValue("/save demo")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	path, _ := SessionPath("demo")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected /save to write %s: %v", path, err)
+	}
+
+	agt.ClearHistory()
+	m.messages = nil
+	m.textArea.SetValue("/load demo")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+
+	if len(agt.Conversation()) != 2 {
+		t.Errorf("Expected the saved conversation back, got %+v", agt.Conversation())
+	}
+	if len(m.messages) != 3 || !strings.Contains(m.messages[1], "hello there") || !strings.Contains(m.viewport.View(), "hello there") {
+		t.Errorf("Expected the transcript re-rendered, got %q", m.messages)
+	}
+}
+
+func TestSessionPath_RejectsTraversal(t *testing.T) {
+	for _, name := range []string{"", "../secrets", ".hidden", "a/b"} {
+		if _, err := SessionPath(name); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestAutoScroll_KeepsPositionWhenScrolledUp(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	m.autoScroll = true
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	m = updated.(model)
+	for i := 0; i < 40; i++ {
+		m.messages = append(m.messages, fmt.Sprintf("message %d", i))
+	}
+	m.updateViewport()
+	if !m.viewport.AtBottom() {
+		t.Fatal("Expected new content to be followed while at the bottom")
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyPgUp})
+	m = updated.(model)
+	offset := m.viewport.YOffset
+
+	updated, _ = m.Update(responseMsg{content: "a new answer", usage: &agent.Response{}})
+	m = updated.(model)
+	if m.viewport.YOffset != offset {
+		t.Errorf("Expected scroll position %d to be kept, got %d", offset, m.viewport.YOffset)
+	}
+	if !strings.Contains(m.View(), "↓ new messages") {
+		t.Error("Expected a new messages indicator while scrolled up")
+	}
+
+	// Back at the bottom, new content is followed again
+	m.viewport.GotoBottom()
+	m.messages = append(m.messages, "another")
+	m.updateViewport()
+	if !m.viewport.AtBottom() || strings.Contains(m.View(), "↓ new messages") {
+		t.Error("Expected to follow new content and drop the indicator at the bottom")
+	}
+}
+
+func TestConfirmQuit_AsksThenQuits(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := InitialModel(agent.New(nil))
+	m.autoSave = false
+	m.confirmQuit = true
+	updated, _ := m.Update(responseMsg{content: "hello", usage: &agent.Response{}})
+	m = updated.(model)
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	m = updated.(model)
+	if m.quitting || cmd != nil {
+		t.Fatal("The first quit keypress should only ask")
+	}
+	if got := m.messages[len(m.messages)-1]; !strings.Contains(got, "Really quit?") {
+		t.Errorf("Expected a confirmation prompt, got %q", got)
+	}
+
+	updated, cmd = m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	m = updated.(model)
+	if !m.quitting || cmd == nil {
+		t.Error("The second quit keypress should quit")
+	}
+
+	// Saved conversations quit straight away
+	m = InitialModel(agent.New(nil))
+	m.autoSave = false
+	m.confirmQuit = true
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if !updated.(model).quitting {
+		t.Error("Expected to quit without asking when nothing is unsaved")
+	}
+}
+
+func TestConfirm_PromptsAndReplies(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	m.loading = true
+
+	reply := make(chan bool, 1)
+	updated, _ := m.Update(confirmMsg{desc: "🗑️  Deleting file: notes.txt", reply: reply})
+	m = updated.(model)
+	if got := m.messages[len(m.messages)-1]; !strings.Contains(got, "Allow 🗑️  Deleting file: notes.txt? y/n") {
+		t.Errorf("Expected an approval prompt, got %q", got)
+	}
+
+	// Other keys don't answer
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	m = updated.(model)
+	select {
+	case <-reply:
+		t.Fatal("Only y or n should answer the prompt")
+	default:
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	m = updated.(model)
+	if allowed := <-reply; allowed {
+		t.Error("Expected n to deny the call")
+	}
+	if m.confirmReply != nil || !m.loading {
+		t.Error("Expected the prompt cleared while the agent carries on")
+	}
+}
+
+func TestReverseSearch_NarrowsAsYouType(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := InitialModel(agent.New(nil))
+	m.inputHistory = []string{"list the go files", "/status", "explain main.go", "/help"}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+	m = updated.(model)
+	if !m.searching {
+		t.Fatal("Expected ctrl+r to start a search")
+	}
+
+	for _, tt := range []struct {
+		typed string
+		match string
+	}{
+		{"/", "/help"},
+		{"s", "/status"},
+		{"x", ""},
+	} {
+		updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(tt.typed)})
+		m = updated.(model)
+		if got := m.searchMatch(); got != tt.match {
+			t.Errorf("After typing %q, expected match %q, got %q", m.searchQuery, tt.match, got)
+		}
+	}
+
+	// Backspace widens the search again, and ctrl+r steps to older matches
+	for i := 0; i < 3; i++ {
+		updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+		m = updated.(model)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("go")})
+	m = updated.(model)
+	if got := m.searchMatch(); got != "explain main.go" {
+		t.Errorf("Expected the newest match for %q, got %q", m.searchQuery, got)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+	m = updated.(model)
+	if got := m.searchMatch(); got != "list the go files" {
+		t.Errorf("Expected ctrl+r to find the older match, got %q", got)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if m.searching || m.textArea.Value() != "list the go files" {
+		t.Errorf("Expected enter to accept the match into the input, got %q", m.textArea.Value())
+	}
+}
+
+func TestInputHistory_UpDownRecall(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := InitialModel(agent.New(nil))
+	m.inputHistory = []string{"first question", "second question"}
+	press := func(k tea.KeyType) {
+		updated, _ := m.Update(tea.KeyMsg{Type: k})
+		m = updated.(model)
+	}
+
+	m.textArea.SetValue("half-typed draft")
+	press(tea.KeyUp)
+	if got := m.textArea.Value(); got != "second question" {
+		t.Fatalf("Expected up to recall the newest input, got %q", got)
+	}
+	press(tea.KeyUp)
+	press(tea.KeyUp) // Already at the oldest; stays put
+	if got := m.textArea.Value(); got != "first question" {
+		t.Errorf("Expected up to reach the oldest input, got %q", got)
+	}
+	press(tea.KeyDown)
+	press(tea.KeyDown)
+	if got := m.textArea.Value(); got != "half-typed draft" {
+		t.Errorf("Expected down past the newest input to restore the draft, got %q", got)
+	}
+
+	// Slash-command suggestions keep priority over history
+	m.textArea.SetValue("/s")
+	m.updateSuggestions()
+	press(tea.KeyUp)
+	if got := m.textArea.Value(); got != "/s" || len(m.suggestions) == 0 {
+		t.Errorf("Expected up to move through suggestions, got input %q", got)
+	}
+}
+
+func TestModelSuggestions_CompleteFetchedModels(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := InitialModel(agent.New(nil))
+
+	// Nothing to complete until a /model fetch has filled the cache
+	m.textArea.SetValue("/model gp")
+	m.updateSuggestions()
+	if len(m.suggestions) != 0 {
+		t.Fatalf("Expected no suggestions before models are fetched, got %v", m.suggestions)
+	}
+
+	updated, _ := m.Update(modelsMsg{models: []string{"claude-sonnet", "gpt-4o", "gpt-4o-mini", "o1-gpt"}})
+	m = updated.(model)
+	m.textArea.SetValue("/model GPT")
+	m.updateSuggestions()
+	want := []string{"/model gpt-4o", "/model gpt-4o-mini", "/model o1-gpt"}
+	if !reflect.DeepEqual(m.suggestions, want) {
+		t.Fatalf("Expected prefix then substring matches %v, got %v", want, m.suggestions)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyTab})
+	m = updated.(model)
+	if got := m.textArea.Value(); got != "/model gpt-4o" {
+		t.Errorf("Expected tab to complete the first model, got %q", got)
+	}
+	if len(m.suggestions) != 0 {
+		t.Errorf("Expected no suggestions once the name is complete, got %v", m.suggestions)
+	}
+}
+
+func TestInputHistory_SavedAndLoaded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input_history.json")
+	history := make([]string, maxInputHistory+5)
+	for i := range history {
+		history[i] = fmt.Sprintf("input %d", i)
+	}
+	if err := saveInputHistory(path, history); err != nil {
+		t.Fatalf("saveInputHistory failed: %v", err)
+	}
+	loaded, err := loadInputHistory(path)
+	if err != nil {
+		t.Fatalf("loadInputHistory failed: %v", err)
+	}
+	if len(loaded) != maxInputHistory || loaded[len(loaded)-1] != history[len(history)-1] {
+		t.Errorf("Expected the newest %d inputs, got %d ending in %q", maxInputHistory, len(loaded), loaded[len(loaded)-1])
+	}
+}
+
+func TestHomeEnd_JumpsTranscript(t *testing.T) {
+	m := InitialModel(agent.New(nil))
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	m = updated.(model)
+	for i := 0; i < 40; i++ {
+		m.messages = append(m.messages, fmt.Sprintf("message %d", i))
+	}
+	m.updateViewport()
+	m.viewport.GotoBottom()
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyHome})
+	m = updated.(model)
+	if !m.viewport.AtTop() {
+		t.Error("Expected Home with an empty input to jump to the top")
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnd})
+	m = updated.(model)
+	if !m.viewport.AtBottom() {
+		t.Error("Expected End with an empty input to jump to the bottom")
+	}
+
+	// While typing, Home moves the cursor instead; Ctrl+Home still scrolls
+	m.textArea.SetValue("draft")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyHome})
+	m = updated.(model)
+	if m.viewport.AtTop() {
+		t.Error("Expected Home with text in the input to leave the transcript alone")
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlHome})
+	m = updated.(model)
+	if !m.viewport.AtTop() {
+		t.Error("Expected Ctrl+Home to jump to the top while typing")
+	}
+	if m.textArea.Value() != "draft" {
+		t.Errorf("Expected the input to be kept, got %q", m.textArea.Value())
+	}
+}
+
+func TestModelInfo_ShowsLimitsAndContextUsed(t *testing.T) {
+	provider, _ := llm.NewProvider(llm.Config{Provider: "openai", Model: "gpt-4o"})
+	agt := agent.New(provider)
+	agt.History = append(agt.History,
+		llm.Message{Role: "user", Content: "hi"},
+		llm.Message{Role: "assistant", Content: "hello", Usage: &llm.Usage{PromptTokens: 12000, CompletionTokens: 800, TotalTokens: 12800}},
+	)
+	m := InitialModel(agt)
+
+	m.textArea.SetValue("/model info")
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	info := m.messages[len(m.messages)-1]
+	for _, want := range []string{"gpt-4o", "Context window: 128000 tokens", "Max output: 16384 tokens", "12800 tokens (10.0% of the window)"} {
+		if !strings.Contains(info, want) {
+			t.Errorf("Expected /model info to contain %q, got %q", want, info)
+		}
+	}
+	if got := agt.GetConfig().Model; got != "gpt-4o" {
+		t.Errorf("Expected /model info to leave the model alone, got %q", got)
+	}
+
+	agt.UpdateConfig(llm.Config{Provider: "openai", Model: "mystery-model"})
+	if info := m.modelInfo(); !strings.Contains(info, "Context window: unknown") || !strings.Contains(info, "Max output: unknown") {
+		t.Errorf("Expected unknown limits for an unrecognized model, got %q", info)
+	}
+}
+
+func TestProviderCommand_GuardsInvalidCombos(t *testing.T) {
+	provider, _ := llm.NewProvider(llm.Config{Provider: "openai", APIKey: "sk-test"})
+	agt := agent.New(provider)
+	m := InitialModel(agt)
+	send := func(input string) string {
+		m.textArea.SetValue(input)
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		m = updated.(model)
+		return m.messages[len(m.messages)-1]
+	}
+
+	// A default model follows the provider, and the new provider speaks its own API, so the
+	// old provider's model list is dropped
+	m.models = []string{"gpt-4o", "gpt-4o-mini"}
+	send("/provider anthropic")
+	if m.models != nil {
+		t.Errorf("Expected the model list to be cleared, got %v", m.models)
+	}
+	cfg := agt.GetConfig()
+	if cfg.Provider != "anthropic" || cfg.Model != llm.DefaultModels["anthropic"] || cfg.APIKey != "sk-test" {
+		t.Errorf("Expected anthropic with its default model and the same key, got %+v", cfg)
+	}
+	if _, ok := agt.LLM.(*llm.AnthropicProvider); !ok {
+		t.Errorf("Expected an Anthropic provider, got %T", agt.LLM)
+	}
+
+	m.models = []string{"claude-sonnet-4-0"}
+	if out := send("/provider mystery"); !strings.Contains(out, "Provider not changed") || agt.GetConfig().Provider != "anthropic" {
+		t.Errorf("Expected an unknown provider to be refused, got %q", out)
+	}
+	if len(m.models) != 1 {
+		t.Error("Expected a refused switch to keep the model list")
+	}
+
+	if out := send("/model gpt-4o"); !strings.Contains(out, "gpt-4o looks like a model for openai") {
+		t.Errorf("Expected a warning for an OpenAI model on Anthropic, got %q", out)
+	}
+	if out := send("/provider openai"); !strings.Contains(out, "Provider set to: openai (model: gpt-4o)") {
+		t.Errorf("Expected a chosen model to be kept without a warning, got %q", out)
+	}
+}
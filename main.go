@@ -1,28 +1,71 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/cellwebb/clippy-go/internal/agent"
 	"github.com/cellwebb/clippy-go/internal/llm"
 	"github.com/cellwebb/clippy-go/internal/ui"
 	"github.com/charmbracelet/bubbletea"
 	"github.com/joho/godotenv"
+	"golang.org/x/term"
 )
 
 func main() {
 	// Load .env file
 	godotenv.Load()
 
-	// Load config
-	cfg := llm.LoadConfigFromEnv()
+	// Parse flags (env vars provide the defaults)
+	dir := flag.String("dir", os.Getenv("CLIPPY_DIR"), "Directory Clippy works in (defaults to the current directory)")
+	examples := flag.String("examples", os.Getenv("CLIPPY_EXAMPLES"), "JSON file of few-shot user/assistant examples to send ahead of the conversation")
+	session := flag.String("session", os.Getenv("CLIPPY_SESSION"), "Saved session (name in ~/.clippy/sessions or a .json path) to resume")
+	serveJSONL := flag.Bool("serve-jsonl", false, "Read {\"input\": ...} requests from stdin and write JSON-lines responses to stdout instead of starting the UI")
+	var prompt string
+	flag.StringVar(&prompt, "p", "", "Answer this prompt once, print the reply to stdout and exit instead of starting the UI (piped stdin is appended as context, or is the prompt on its own; add </dev/null if stdin is an open pipe with nothing to send)")
+	flag.StringVar(&prompt, "prompt", "", "Same as -p")
+	asJSON := flag.Bool("json", false, "With -p, print the full response (content, usage, tools used) as JSON")
+	flag.Parse()
+
+	// Load config: ~/.clippy/config.yaml, with CLIPPY_* variables taking precedence
+	cfg, err := llm.LoadConfigFromFile(llm.DefaultConfigPath())
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := agent.CheckEnv(); err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Replay recorded API responses instead of calling the provider (offline demos and testing)
+	if path := os.Getenv("CLIPPY_CASSETTE"); path != "" {
+		cassette, err := llm.LoadCassette(path)
+		if err != nil {
+			fmt.Printf("Error loading cassette: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.Transport = cassette
+	}
 
 	// Initialize LLM provider
 	var llmProvider llm.Provider
-	var err error
 	if cfg.Provider != "" {
 		llmProvider, err = llm.NewProvider(cfg)
+		if errors.Is(err, llm.ErrNoModel) {
+			fmt.Printf("Clippy needs to know which model to use with %s.\n", cfg.Provider)
+			fmt.Println("Set CLIPPY_MODEL in your environment or .env file (see .env.example), for example:")
+			fmt.Println("  CLIPPY_MODEL=gpt-4o-mini")
+			if cfg.Provider == "azure" {
+				fmt.Println("For Azure you can set CLIPPY_AZURE_DEPLOYMENT to your deployment name instead.")
+			}
+			os.Exit(1)
+		}
 		if err != nil {
 			fmt.Printf("Error initializing LLM provider: %v\n", err)
 			os.Exit(1)
@@ -31,6 +74,81 @@ func main() {
 
 	// Initialize agent
 	agt := agent.New(llmProvider)
+	if *dir != "" {
+		if err := agt.SetWorkDir(*dir); err != nil {
+			fmt.Printf("Error setting working directory: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// File tools stay inside the workspace, which defaults to the working directory
+	if workspace := os.Getenv("CLIPPY_WORKSPACE"); workspace != "" || *dir != "" {
+		if workspace == "" {
+			workspace = agt.WorkDir
+		}
+		if err := agt.SetWorkspace(workspace); err != nil {
+			fmt.Printf("Error setting workspace: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *examples != "" {
+		exs, err := agent.LoadExamples(*examples)
+		if err != nil {
+			fmt.Printf("Error loading examples: %v\n", err)
+			os.Exit(1)
+		}
+		agt.SetExamples(exs)
+	}
+	if *session != "" {
+		path, err := ui.SessionPath(*session)
+		if err == nil {
+			err = agt.LoadSession(path)
+		}
+		if err != nil {
+			fmt.Printf("Error loading session: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Piped input is a prompt too (`cat bug.txt | clippy`), or context for the -p prompt. Like
+	// any headless run it gets no destructive tools without CLIPPY_AUTO_APPROVE=1 (see below).
+	stdin, _ := os.Stdin.Stat()
+	if !*serveJSONL && !term.IsTerminal(int(os.Stdin.Fd())) && readsPipedInput(prompt, stdin) {
+		piped, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			os.Exit(1)
+		}
+		prompt = withPipedInput(prompt, string(piped))
+		// The UI needs a terminal, so with nothing to answer there's nothing to do
+		if prompt == "" {
+			fmt.Fprintln(os.Stderr, "Error: stdin is not a terminal and no prompt was given; pipe one in or pass -p \"...\"")
+			os.Exit(2)
+		}
+	}
+
+	// Headless modes have no one to approve destructive tool calls, so they're declined
+	// unless CLIPPY_AUTO_APPROVE=1
+	if (prompt != "" || *serveJSONL) && os.Getenv("CLIPPY_AUTO_APPROVE") != "1" {
+		agt.SetConfirmFunc(agent.DenyDestructive)
+	}
+
+	// Answer a single prompt for scripts
+	if prompt != "" {
+		if err := runPrompt(agt, prompt, *asJSON, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Act as a backend for editor integrations
+	if *serveJSONL {
+		if err := agt.ServeJSONL(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error serving JSON lines: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Start UI
 	p := tea.NewProgram(ui.InitialModel(agt), tea.WithMouseCellMotion())
@@ -39,3 +157,54 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// readsPipedInput reports whether stdin should be read for the prompt. Without -p it's the
+// prompt, so it's always read; with -p it's only read when something was piped or redirected
+// in, since a runner's stdin (a socket, say) may never reach EOF. A pipe that's left open
+// still blocks, which is what `</dev/null` is for.
+func readsPipedInput(prompt string, stdin os.FileInfo) bool {
+	if prompt == "" {
+		return true
+	}
+	if stdin == nil {
+		return false
+	}
+	return stdin.Mode()&os.ModeNamedPipe != 0 || stdin.Mode().IsRegular()
+}
+
+// withPipedInput appends what was piped on stdin to the -p prompt, or uses it as the prompt
+func withPipedInput(prompt, piped string) string {
+	piped = strings.TrimSpace(piped)
+	switch {
+	case piped == "":
+		return prompt
+	case prompt == "":
+		return piped
+	default:
+		return prompt + "\n\n" + piped
+	}
+}
+
+// runPrompt answers prompt once and writes the reply to w: the plain content, or with asJSON
+// the whole agent.Response. A turn that failed is returned as an error, so scripts see a
+// nonzero exit; with asJSON the response is still written first.
+func runPrompt(agt *agent.Agent, prompt string, asJSON bool, w io.Writer) error {
+	resp := agt.GetResponse(prompt)
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			return fmt.Errorf("failed to write response: %v", err)
+		}
+	}
+	if resp.Failed {
+		return errors.New(resp.Content)
+	}
+	if !asJSON {
+		if _, err := fmt.Fprintln(w, resp.Content); err != nil {
+			return fmt.Errorf("failed to write response: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cellwebb/clippy-go/internal/agent"
+	"github.com/cellwebb/clippy-go/internal/llm"
+	"github.com/cellwebb/clippy-go/internal/tools"
+)
+
+// mockLLM answers every request with Response, or fails with Err
+type mockLLM struct {
+	Response *llm.Message
+	Err      error
+}
+
+func (m *mockLLM) Generate(ctx context.Context, messages []llm.Message, ts []tools.Tool) (*llm.Message, error) {
+	return m.Response, m.Err
+}
+
+func (m *mockLLM) GenerateStream(ctx context.Context, messages []llm.Message, ts []tools.Tool) (<-chan llm.StreamChunk, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	chunks := make(chan llm.StreamChunk, 1)
+	chunks <- llm.StreamChunk{Done: true, Usage: m.Response.Usage, Message: m.Response}
+	close(chunks)
+	return chunks, nil
+}
+
+func (m *mockLLM) UpdateConfig(cfg llm.Config) {}
+
+func (m *mockLLM) GetConfig() llm.Config {
+	return llm.Config{}
+}
+
+func replyAgent() *agent.Agent {
+	return agent.New(&mockLLM{Response: &llm.Message{
+		Role:    "assistant",
+		Content: "It looks like you're writing a script!",
+		Usage:   &llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}})
+}
+
+func TestRunPrompt_PlainOutput(t *testing.T) {
+	var out bytes.Buffer
+	if err := runPrompt(replyAgent(), "hi", false, &out); err != nil {
+		t.Fatalf("runPrompt failed: %v", err)
+	}
+	if got := out.String(); got != "It looks like you're writing a script!\n" {
+		t.Errorf("Expected only the reply on stdout, got %q", got)
+	}
+}
+
+func TestRunPrompt_JSONOutput(t *testing.T) {
+	var out bytes.Buffer
+	if err := runPrompt(replyAgent(), "hi", true, &out); err != nil {
+		t.Fatalf("runPrompt failed: %v", err)
+	}
+	var resp agent.Response
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		t.Fatalf("Expected the response as JSON, got %q: %v", out.String(), err)
+	}
+	if resp.Content != "It looks like you're writing a script!" {
+		t.Errorf("Expected the reply as content, got %q", resp.Content)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 15 {
+		t.Errorf("Expected the usage in the JSON, got %+v", resp.Usage)
+	}
+	if resp.Failed {
+		t.Error("Expected a successful turn not to be marked failed")
+	}
+}
+
+func TestRunPrompt_FailedTurn(t *testing.T) {
+	tests := []struct {
+		name string
+		agt  *agent.Agent
+		want string
+	}{
+		{"no provider", agent.New(nil), "no brain"},
+		{"provider error", agent.New(&mockLLM{Err: errors.New("boom")}), "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runPrompt(tt.agt, "hi", false, &out)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Expected an error mentioning %q for a nonzero exit, got %v", tt.want, err)
+			}
+			if out.Len() != 0 {
+				t.Errorf("Expected nothing on stdout for a failed plain turn, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestRunPrompt_FailedTurnStillWritesJSON(t *testing.T) {
+	var out bytes.Buffer
+	err := runPrompt(agent.New(nil), "hi", true, &out)
+	if err == nil {
+		t.Fatal("Expected a failed turn to return an error")
+	}
+	var resp agent.Response
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		t.Fatalf("Expected the response as JSON even on failure, got %q: %v", out.String(), err)
+	}
+	if !resp.Failed {
+		t.Error("Expected the JSON to be marked failed")
+	}
+	if resp.Content != err.Error() {
+		t.Errorf("Expected the error to match the content, got %q and %q", err.Error(), resp.Content)
+	}
+}
+
+func TestWithPipedInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		prompt string
+		piped  string
+		want   string
+	}{
+		{"nothing piped", "explain main.go", "", "explain main.go"},
+		{"whitespace piped", "explain main.go", " \n\t\n", "explain main.go"},
+		{"nothing at all", "", "", ""},
+		{"whitespace only without a prompt", "", "\n\n", ""},
+		{"stdin is the prompt", "", "why does this panic?\n", "why does this panic?"},
+		{"stdin appended after -p", "summarize this log", "\nline one\nline two\n", "summarize this log\n\nline one\nline two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withPipedInput(tt.prompt, tt.piped); got != tt.want {
+				t.Errorf("withPipedInput(%q, %q) = %q, want %q", tt.prompt, tt.piped, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadsPipedInput(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	pipe, err := r.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	regular, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	devNull, err := os.Stat(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		prompt string
+		stdin  os.FileInfo
+		want   bool
+	}{
+		{"no prompt reads a pipe", "", pipe, true},
+		{"no prompt reads anything", "", devNull, true},
+		{"-p with a pipe", "hi", pipe, true},
+		{"-p with a redirected file", "hi", regular, true},
+		{"-p with a device", "hi", devNull, false},
+		{"-p with unknown stdin", "hi", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readsPipedInput(tt.prompt, tt.stdin); got != tt.want {
+				t.Errorf("readsPipedInput(%q) = %v, want %v", tt.prompt, got, tt.want)
+			}
+		})
+	}
+}